@@ -61,13 +61,81 @@ func main() {
 	s := grpc.NewServer()
 	reflection.Register(s)
 
-	var dir userspb.UserServiceServer
-	dir, err = users.NewDirectory(log, parsedURL)
-	if err != nil {
-		log.Error("Failed to create user directory", "error", err)
+	var opts []users.Option
+	var pageTokenKey []byte
+	if key := os.Getenv("PAGE_TOKEN_KEY"); key != "" {
+		pageTokenKey = []byte(key)
+		opts = append(opts, users.WithPageTokenKey(pageTokenKey))
+	}
+	strategy := users.IDStrategyRandom
+	if name := os.Getenv("ID_STRATEGY"); name != "" {
+		strategy, err = users.ParseIDStrategy(name)
+		if err != nil {
+			log.Error("Failed to parse ID_STRATEGY", "error", err)
+			return
+		}
+		opts = append(opts, users.WithIDStrategy(strategy))
+	}
+	if retention := os.Getenv("PURGE_RETENTION"); retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err != nil {
+			log.Error("Failed to parse PURGE_RETENTION", "error", err)
+			return
+		}
+		opts = append(opts, users.WithPurgeRetention(d))
+	}
+
+	webhookURL, outboxFile := os.Getenv("OUTBOX_WEBHOOK_URL"), os.Getenv("OUTBOX_FILE")
+	switch {
+	case webhookURL != "" && outboxFile != "":
+		log.Error("Only one of OUTBOX_WEBHOOK_URL and OUTBOX_FILE can be set")
 		return
+	case webhookURL != "":
+		opts = append(opts, users.WithPublisher(users.NewWebhookPublisher(webhookURL, nil)))
+	case outboxFile != "":
+		publisher, err := users.NewFilePublisher(outboxFile)
+		if err != nil {
+			log.Error("Failed to open OUTBOX_FILE", "error", err)
+			return
+		}
+		defer publisher.Close()
+		opts = append(opts, users.WithPublisher(publisher))
+	}
+
+	switch parsedURL.Scheme {
+	case "memory", "sqlite":
+		// The other services require Postgres.
+		log.Warn("Only serving the UserService", "scheme", parsedURL.Scheme)
+		var store users.Store
+		if parsedURL.Scheme == "sqlite" {
+			store, err = users.NewSQLiteStore(log, parsedURL, opts...)
+			if err != nil {
+				log.Error("Failed to open SQLite store", "error", err)
+				return
+			}
+		} else {
+			store = users.NewMemoryStore(opts...)
+		}
+		defer store.Close()
+		server, err := users.NewUserServer(store, pageTokenKey)
+		if err != nil {
+			log.Error("Failed to create user server", "error", err)
+			return
+		}
+		userspb.RegisterUserServiceServer(s, server)
+	default:
+		dir, err := users.NewDirectory(log, parsedURL, opts...)
+		if err != nil {
+			log.Error("Failed to create user directory", "error", err)
+			return
+		}
+		userspb.RegisterUserServiceServer(s, dir)
+		userspb.RegisterGroupServiceServer(s, dir)
+		userspb.RegisterOrgUnitServiceServer(s, dir)
+		userspb.RegisterRoleServiceServer(s, dir)
+		userspb.RegisterAuditServiceServer(s, dir)
+		userspb.RegisterWebhookServiceServer(s, dir)
 	}
-	userspb.RegisterUserServiceServer(s, dir)
 
 	// Serve gRPC Server
 	go func() {
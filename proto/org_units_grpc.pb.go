@@ -0,0 +1,457 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: proto/org_units.proto
+
+package users
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	OrgUnitService_CreateOrgUnit_FullMethodName  = "/users.OrgUnitService/CreateOrgUnit"
+	OrgUnitService_GetOrgUnit_FullMethodName     = "/users.OrgUnitService/GetOrgUnit"
+	OrgUnitService_UpdateOrgUnit_FullMethodName  = "/users.OrgUnitService/UpdateOrgUnit"
+	OrgUnitService_DeleteOrgUnit_FullMethodName  = "/users.OrgUnitService/DeleteOrgUnit"
+	OrgUnitService_ListOrgUnits_FullMethodName   = "/users.OrgUnitService/ListOrgUnits"
+	OrgUnitService_SetUserOrgUnit_FullMethodName = "/users.OrgUnitService/SetUserOrgUnit"
+	OrgUnitService_GetUserOrgUnit_FullMethodName = "/users.OrgUnitService/GetUserOrgUnit"
+	OrgUnitService_ListUsersUnder_FullMethodName = "/users.OrgUnitService/ListUsersUnder"
+	OrgUnitService_IsUserUnder_FullMethodName    = "/users.OrgUnitService/IsUserUnder"
+)
+
+// OrgUnitServiceClient is the client API for OrgUnitService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// OrgUnitService organises users in a tree of org units.
+type OrgUnitServiceClient interface {
+	CreateOrgUnit(ctx context.Context, in *CreateOrgUnitRequest, opts ...grpc.CallOption) (*OrgUnit, error)
+	GetOrgUnit(ctx context.Context, in *GetOrgUnitRequest, opts ...grpc.CallOption) (*OrgUnit, error)
+	// UpdateOrgUnit updates the org unit. Moving an org unit under itself,
+	// or under one of its descendants, fails with FAILED_PRECONDITION.
+	UpdateOrgUnit(ctx context.Context, in *UpdateOrgUnitRequest, opts ...grpc.CallOption) (*OrgUnit, error)
+	// DeleteOrgUnit deletes the org unit. Org units with child org units
+	// or users fail with FAILED_PRECONDITION.
+	DeleteOrgUnit(ctx context.Context, in *DeleteOrgUnitRequest, opts ...grpc.CallOption) (*OrgUnit, error)
+	// ListOrgUnits lists the children of an org unit, or the root
+	// org units, ordered by creation.
+	ListOrgUnits(ctx context.Context, in *ListOrgUnitsRequest, opts ...grpc.CallOption) (*ListOrgUnitsResponse, error)
+	// SetUserOrgUnit places the user in an org unit, replacing any
+	// previous placement, or removes the user from its org unit.
+	// Soft deleted users cannot be placed.
+	SetUserOrgUnit(ctx context.Context, in *SetUserOrgUnitRequest, opts ...grpc.CallOption) (*UserOrgUnit, error)
+	GetUserOrgUnit(ctx context.Context, in *GetUserOrgUnitRequest, opts ...grpc.CallOption) (*UserOrgUnit, error)
+	// ListUsersUnder lists the users placed in the org unit, and if
+	// recursive, in any of its descendants, ordered by creation. Soft
+	// deleted users are not listed.
+	ListUsersUnder(ctx context.Context, in *ListUsersUnderRequest, opts ...grpc.CallOption) (*ListUsersUnderResponse, error)
+	// IsUserUnder returns whether the user is placed in the org unit,
+	// or in any of its descendants. Soft deleted users are never under
+	// any org unit.
+	IsUserUnder(ctx context.Context, in *IsUserUnderRequest, opts ...grpc.CallOption) (*IsUserUnderResponse, error)
+}
+
+type orgUnitServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOrgUnitServiceClient(cc grpc.ClientConnInterface) OrgUnitServiceClient {
+	return &orgUnitServiceClient{cc}
+}
+
+func (c *orgUnitServiceClient) CreateOrgUnit(ctx context.Context, in *CreateOrgUnitRequest, opts ...grpc.CallOption) (*OrgUnit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OrgUnit)
+	err := c.cc.Invoke(ctx, OrgUnitService_CreateOrgUnit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orgUnitServiceClient) GetOrgUnit(ctx context.Context, in *GetOrgUnitRequest, opts ...grpc.CallOption) (*OrgUnit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OrgUnit)
+	err := c.cc.Invoke(ctx, OrgUnitService_GetOrgUnit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orgUnitServiceClient) UpdateOrgUnit(ctx context.Context, in *UpdateOrgUnitRequest, opts ...grpc.CallOption) (*OrgUnit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OrgUnit)
+	err := c.cc.Invoke(ctx, OrgUnitService_UpdateOrgUnit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orgUnitServiceClient) DeleteOrgUnit(ctx context.Context, in *DeleteOrgUnitRequest, opts ...grpc.CallOption) (*OrgUnit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OrgUnit)
+	err := c.cc.Invoke(ctx, OrgUnitService_DeleteOrgUnit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orgUnitServiceClient) ListOrgUnits(ctx context.Context, in *ListOrgUnitsRequest, opts ...grpc.CallOption) (*ListOrgUnitsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListOrgUnitsResponse)
+	err := c.cc.Invoke(ctx, OrgUnitService_ListOrgUnits_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orgUnitServiceClient) SetUserOrgUnit(ctx context.Context, in *SetUserOrgUnitRequest, opts ...grpc.CallOption) (*UserOrgUnit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserOrgUnit)
+	err := c.cc.Invoke(ctx, OrgUnitService_SetUserOrgUnit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orgUnitServiceClient) GetUserOrgUnit(ctx context.Context, in *GetUserOrgUnitRequest, opts ...grpc.CallOption) (*UserOrgUnit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserOrgUnit)
+	err := c.cc.Invoke(ctx, OrgUnitService_GetUserOrgUnit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orgUnitServiceClient) ListUsersUnder(ctx context.Context, in *ListUsersUnderRequest, opts ...grpc.CallOption) (*ListUsersUnderResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListUsersUnderResponse)
+	err := c.cc.Invoke(ctx, OrgUnitService_ListUsersUnder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orgUnitServiceClient) IsUserUnder(ctx context.Context, in *IsUserUnderRequest, opts ...grpc.CallOption) (*IsUserUnderResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IsUserUnderResponse)
+	err := c.cc.Invoke(ctx, OrgUnitService_IsUserUnder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OrgUnitServiceServer is the server API for OrgUnitService service.
+// All implementations should embed UnimplementedOrgUnitServiceServer
+// for forward compatibility.
+//
+// OrgUnitService organises users in a tree of org units.
+type OrgUnitServiceServer interface {
+	CreateOrgUnit(context.Context, *CreateOrgUnitRequest) (*OrgUnit, error)
+	GetOrgUnit(context.Context, *GetOrgUnitRequest) (*OrgUnit, error)
+	// UpdateOrgUnit updates the org unit. Moving an org unit under itself,
+	// or under one of its descendants, fails with FAILED_PRECONDITION.
+	UpdateOrgUnit(context.Context, *UpdateOrgUnitRequest) (*OrgUnit, error)
+	// DeleteOrgUnit deletes the org unit. Org units with child org units
+	// or users fail with FAILED_PRECONDITION.
+	DeleteOrgUnit(context.Context, *DeleteOrgUnitRequest) (*OrgUnit, error)
+	// ListOrgUnits lists the children of an org unit, or the root
+	// org units, ordered by creation.
+	ListOrgUnits(context.Context, *ListOrgUnitsRequest) (*ListOrgUnitsResponse, error)
+	// SetUserOrgUnit places the user in an org unit, replacing any
+	// previous placement, or removes the user from its org unit.
+	// Soft deleted users cannot be placed.
+	SetUserOrgUnit(context.Context, *SetUserOrgUnitRequest) (*UserOrgUnit, error)
+	GetUserOrgUnit(context.Context, *GetUserOrgUnitRequest) (*UserOrgUnit, error)
+	// ListUsersUnder lists the users placed in the org unit, and if
+	// recursive, in any of its descendants, ordered by creation. Soft
+	// deleted users are not listed.
+	ListUsersUnder(context.Context, *ListUsersUnderRequest) (*ListUsersUnderResponse, error)
+	// IsUserUnder returns whether the user is placed in the org unit,
+	// or in any of its descendants. Soft deleted users are never under
+	// any org unit.
+	IsUserUnder(context.Context, *IsUserUnderRequest) (*IsUserUnderResponse, error)
+}
+
+// UnimplementedOrgUnitServiceServer should be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedOrgUnitServiceServer struct{}
+
+func (UnimplementedOrgUnitServiceServer) CreateOrgUnit(context.Context, *CreateOrgUnitRequest) (*OrgUnit, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateOrgUnit not implemented")
+}
+func (UnimplementedOrgUnitServiceServer) GetOrgUnit(context.Context, *GetOrgUnitRequest) (*OrgUnit, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrgUnit not implemented")
+}
+func (UnimplementedOrgUnitServiceServer) UpdateOrgUnit(context.Context, *UpdateOrgUnitRequest) (*OrgUnit, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateOrgUnit not implemented")
+}
+func (UnimplementedOrgUnitServiceServer) DeleteOrgUnit(context.Context, *DeleteOrgUnitRequest) (*OrgUnit, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteOrgUnit not implemented")
+}
+func (UnimplementedOrgUnitServiceServer) ListOrgUnits(context.Context, *ListOrgUnitsRequest) (*ListOrgUnitsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListOrgUnits not implemented")
+}
+func (UnimplementedOrgUnitServiceServer) SetUserOrgUnit(context.Context, *SetUserOrgUnitRequest) (*UserOrgUnit, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetUserOrgUnit not implemented")
+}
+func (UnimplementedOrgUnitServiceServer) GetUserOrgUnit(context.Context, *GetUserOrgUnitRequest) (*UserOrgUnit, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserOrgUnit not implemented")
+}
+func (UnimplementedOrgUnitServiceServer) ListUsersUnder(context.Context, *ListUsersUnderRequest) (*ListUsersUnderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUsersUnder not implemented")
+}
+func (UnimplementedOrgUnitServiceServer) IsUserUnder(context.Context, *IsUserUnderRequest) (*IsUserUnderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IsUserUnder not implemented")
+}
+func (UnimplementedOrgUnitServiceServer) testEmbeddedByValue() {}
+
+// UnsafeOrgUnitServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OrgUnitServiceServer will
+// result in compilation errors.
+type UnsafeOrgUnitServiceServer interface {
+	mustEmbedUnimplementedOrgUnitServiceServer()
+}
+
+func RegisterOrgUnitServiceServer(s grpc.ServiceRegistrar, srv OrgUnitServiceServer) {
+	// If the following call pancis, it indicates UnimplementedOrgUnitServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&OrgUnitService_ServiceDesc, srv)
+}
+
+func _OrgUnitService_CreateOrgUnit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateOrgUnitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrgUnitServiceServer).CreateOrgUnit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrgUnitService_CreateOrgUnit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrgUnitServiceServer).CreateOrgUnit(ctx, req.(*CreateOrgUnitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrgUnitService_GetOrgUnit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrgUnitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrgUnitServiceServer).GetOrgUnit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrgUnitService_GetOrgUnit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrgUnitServiceServer).GetOrgUnit(ctx, req.(*GetOrgUnitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrgUnitService_UpdateOrgUnit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateOrgUnitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrgUnitServiceServer).UpdateOrgUnit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrgUnitService_UpdateOrgUnit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrgUnitServiceServer).UpdateOrgUnit(ctx, req.(*UpdateOrgUnitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrgUnitService_DeleteOrgUnit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteOrgUnitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrgUnitServiceServer).DeleteOrgUnit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrgUnitService_DeleteOrgUnit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrgUnitServiceServer).DeleteOrgUnit(ctx, req.(*DeleteOrgUnitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrgUnitService_ListOrgUnits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListOrgUnitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrgUnitServiceServer).ListOrgUnits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrgUnitService_ListOrgUnits_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrgUnitServiceServer).ListOrgUnits(ctx, req.(*ListOrgUnitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrgUnitService_SetUserOrgUnit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetUserOrgUnitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrgUnitServiceServer).SetUserOrgUnit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrgUnitService_SetUserOrgUnit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrgUnitServiceServer).SetUserOrgUnit(ctx, req.(*SetUserOrgUnitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrgUnitService_GetUserOrgUnit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserOrgUnitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrgUnitServiceServer).GetUserOrgUnit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrgUnitService_GetUserOrgUnit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrgUnitServiceServer).GetUserOrgUnit(ctx, req.(*GetUserOrgUnitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrgUnitService_ListUsersUnder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUsersUnderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrgUnitServiceServer).ListUsersUnder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrgUnitService_ListUsersUnder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrgUnitServiceServer).ListUsersUnder(ctx, req.(*ListUsersUnderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrgUnitService_IsUserUnder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IsUserUnderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrgUnitServiceServer).IsUserUnder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrgUnitService_IsUserUnder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrgUnitServiceServer).IsUserUnder(ctx, req.(*IsUserUnderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// OrgUnitService_ServiceDesc is the grpc.ServiceDesc for OrgUnitService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var OrgUnitService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "users.OrgUnitService",
+	HandlerType: (*OrgUnitServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateOrgUnit",
+			Handler:    _OrgUnitService_CreateOrgUnit_Handler,
+		},
+		{
+			MethodName: "GetOrgUnit",
+			Handler:    _OrgUnitService_GetOrgUnit_Handler,
+		},
+		{
+			MethodName: "UpdateOrgUnit",
+			Handler:    _OrgUnitService_UpdateOrgUnit_Handler,
+		},
+		{
+			MethodName: "DeleteOrgUnit",
+			Handler:    _OrgUnitService_DeleteOrgUnit_Handler,
+		},
+		{
+			MethodName: "ListOrgUnits",
+			Handler:    _OrgUnitService_ListOrgUnits_Handler,
+		},
+		{
+			MethodName: "SetUserOrgUnit",
+			Handler:    _OrgUnitService_SetUserOrgUnit_Handler,
+		},
+		{
+			MethodName: "GetUserOrgUnit",
+			Handler:    _OrgUnitService_GetUserOrgUnit_Handler,
+		},
+		{
+			MethodName: "ListUsersUnder",
+			Handler:    _OrgUnitService_ListUsersUnder_Handler,
+		},
+		{
+			MethodName: "IsUserUnder",
+			Handler:    _OrgUnitService_IsUserUnder_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/org_units.proto",
+}
@@ -0,0 +1,254 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v5"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+// ActorKey is the request metadata key used to identify who makes
+// a change, as recorded in the audit log.
+const ActorKey = "actor"
+
+// auditEvent describes a change to record in the audit log.
+type auditEvent struct {
+	action  userspb.AuditAction
+	userIDs []string
+	// The snapshots of the change, if any.
+	before proto.Message
+	after  proto.Message
+}
+
+// auditEventParams returns the parameters to record the event, with the
+// actor and peer of the request.
+func auditEventParams(ctx context.Context, event auditEvent) (CreateAuditEventParams, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	params := CreateAuditEventParams{
+		Actor:   lastValue(md, ActorKey),
+		Action:  strings.ToLower(event.action.String()),
+		UserIds: make([]pgtype.UUID, 0, len(event.userIDs)),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		params.Peer = p.Addr.String()
+	}
+	for _, id := range event.userIDs {
+		var userID pgtype.UUID
+		err := userID.Set(id)
+		if err != nil {
+			return params, status.Errorf(codes.Internal, "invalid user ID %q in audit event: %s", id, err.Error())
+		}
+		params.UserIds = append(params.UserIds, userID)
+	}
+	var err error
+	params.Before, err = auditSnapshot(event.before)
+	if err != nil {
+		return params, err
+	}
+	params.After, err = auditSnapshot(event.after)
+	if err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// auditSnapshot encodes the snapshot, or an empty object if there is none.
+func auditSnapshot(msg proto.Message) (json.RawMessage, error) {
+	if msg == nil {
+		return json.RawMessage("{}"), nil
+	}
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode audit snapshot: %s", err.Error())
+	}
+	return b, nil
+}
+
+// recordAuditEvent records the event using the querier, which should be
+// in the transaction of the change.
+func recordAuditEvent(ctx context.Context, querier Querier, event auditEvent) error {
+	params, err := auditEventParams(ctx, event)
+	if err != nil {
+		return err
+	}
+	err = querier.CreateAuditEvent(ctx, params)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unexpected error recording audit event: %s", err.Error())
+	}
+	return nil
+}
+
+// recordAuditEventTx records the event in the pgx transaction of the change.
+func recordAuditEventTx(ctx context.Context, tx pgx.Tx, event auditEvent) error {
+	params, err := auditEventParams(ctx, event)
+	if err != nil {
+		return err
+	}
+	// Sending the user IDs as a text array literal lets the
+	// server parse them, like database/sql does.
+	userIDs, err := pq.Array(params.UserIds).Value()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode user IDs: %s", err.Error())
+	}
+	_, err = tx.Exec(ctx, createAuditEvent,
+		params.Actor,
+		params.Peer,
+		params.Action,
+		userIDs,
+		params.Before,
+		params.After,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unexpected error recording audit event: %s", err.Error())
+	}
+	return nil
+}
+
+// auditEventColumns are the columns of the audit_events table, in the
+// order expected by scanAuditEvent.
+var auditEventColumns = []string{
+	"id",
+	"create_time",
+	"actor",
+	"peer",
+	"action",
+	// Arrays are scanned from their text representation.
+	"user_ids::text",
+	"before",
+	"after",
+}
+
+// scanAuditEvent scans a row selected with auditEventColumns.
+func scanAuditEvent(row rowScanner) (AuditEvent, error) {
+	var pgEvent AuditEvent
+	var userIDs pgtype.UUIDArray
+	err := row.Scan(
+		&pgEvent.ID,
+		&pgEvent.CreateTime,
+		&pgEvent.Actor,
+		&pgEvent.Peer,
+		&pgEvent.Action,
+		&userIDs,
+		&pgEvent.Before,
+		&pgEvent.After,
+	)
+	pgEvent.UserIds = userIDs.Elements
+	return pgEvent, err
+}
+
+func auditEventPostgresToProto(pgEvent AuditEvent) (*userspb.AuditEvent, error) {
+	event := &userspb.AuditEvent{
+		CreateTime: timestamppb.New(pgEvent.CreateTime),
+		Actor:      pgEvent.Actor,
+		Peer:       pgEvent.Peer,
+		Action:     userspb.AuditAction(userspb.AuditAction_value[strings.ToUpper(pgEvent.Action)]),
+		UserIds:    make([]string, 0, len(pgEvent.UserIds)),
+	}
+	err := pgEvent.ID.AssignTo(&event.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	for _, pgUserID := range pgEvent.UserIds {
+		var userID string
+		err = pgUserID.AssignTo(&userID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+		}
+		event.UserIds = append(event.UserIds, userID)
+	}
+	event.Before, err = decodeAttributes(pgEvent.Before)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode audit snapshot: %s", err.Error())
+	}
+	event.After, err = decodeAttributes(pgEvent.After)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode audit snapshot: %s", err.Error())
+	}
+	return event, nil
+}
+
+// ListAuditEvents lists audit events, oldest first.
+func (d Directory) ListAuditEvents(ctx context.Context, req *userspb.ListAuditEventsRequest) (*userspb.ListAuditEventsResponse, error) {
+	q := d.sb.Select(
+		auditEventColumns...,
+	).From(
+		"audit_events",
+	)
+	if req.GetUserId() != "" {
+		var userID pgtype.UUID
+		err := userID.Set(req.GetUserId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+		}
+		// Containment can use the GIN index on user_ids.
+		q = q.Where("user_ids @> ARRAY[?]::uuid[]", userID)
+	}
+	if req.GetActor() != "" {
+		q = q.Where(squirrel.Eq{
+			"actor": req.GetActor(),
+		})
+	}
+	if req.GetAction() != userspb.AuditAction_AUDIT_ACTION_UNSPECIFIED {
+		if _, ok := userspb.AuditAction_name[int32(req.GetAction())]; !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown action %d", req.GetAction())
+		}
+		q = q.Where(squirrel.Eq{
+			"action": strings.ToLower(req.GetAction().String()),
+		})
+	}
+	if req.GetStartTime() != nil {
+		var pgTime pgtype.Timestamptz
+		err := pgTime.Set(req.GetStartTime().AsTime())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid timestamp: %s", err.Error())
+		}
+		q = q.Where(squirrel.GtOrEq{
+			"create_time": pgTime,
+		})
+	}
+	if req.GetEndTime() != nil {
+		var pgTime pgtype.Timestamptz
+		err := pgTime.Set(req.GetEndTime().AsTime())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid timestamp: %s", err.Error())
+		}
+		q = q.Where(squirrel.Lt{
+			"create_time": pgTime,
+		})
+	}
+
+	pgEvents, next, err := queryPage(ctx, d, q, req, req.GetPageSize(), req.GetPageToken(), scanAuditEvent, func(pgEvent AuditEvent) pageToken {
+		return pageToken{
+			CreateTime: pgEvent.CreateTime,
+			ID:         pgEvent.ID.Bytes[:],
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*userspb.AuditEvent, 0, len(pgEvents))
+	for _, pgEvent := range pgEvents {
+		event, err := auditEventPostgresToProto(pgEvent)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return &userspb.ListAuditEventsResponse{
+		Events:        events,
+		NextPageToken: next,
+	}, nil
+}
@@ -0,0 +1,255 @@
+package users_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+	"github.com/johanbrandhorst/grpc-postgres/users"
+)
+
+func TestAuditEvents(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	aliceCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(users.ActorKey, "alice"))
+	bobCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(users.ActorKey, "bob"))
+
+	listEvents := func(t *testing.T, req *userspb.ListAuditEventsRequest) []*userspb.AuditEvent {
+		t.Helper()
+		var events []*userspb.AuditEvent
+		for {
+			resp, err := directory.ListAuditEvents(ctx, req)
+			if err != nil {
+				t.Fatalf("Failed to list audit events: %s", err)
+			}
+			events = append(events, resp.GetEvents()...)
+			if resp.GetNextPageToken() == "" {
+				return events
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+	}
+
+	start := time.Now().Add(-time.Minute)
+	user, err := directory.AddUser(aliceCtx, &userspb.AddUserRequest{
+		Role: userspb.Role_MEMBER,
+		Name: "Foo",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add user: %s", err)
+	}
+	// Retrying with the same ID doesn't change anything.
+	_, err = directory.AddUser(aliceCtx, &userspb.AddUserRequest{
+		Id:   user.GetId(),
+		Role: userspb.Role_MEMBER,
+		Name: "Foo",
+	})
+	if err != nil {
+		t.Fatalf("Failed to retry adding user: %s", err)
+	}
+	addSrv := &addUsersSrvFake{
+		ctx: bobCtx,
+		reqs: []*userspb.AddUserRequest{
+			{Role: userspb.Role_GUEST, Name: "Bar"},
+			{Role: userspb.Role_GUEST, Name: "Baz"},
+		},
+	}
+	err = directory.AddUsers(addSrv)
+	if err != nil {
+		t.Fatalf("Failed to add users: %s", err)
+	}
+	deleted, err := directory.DeleteUser(bobCtx, &userspb.DeleteUserRequest{
+		Id: user.GetId(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete user: %s", err)
+	}
+	// Failed deletions are not recorded.
+	_, err = directory.DeleteUser(bobCtx, &userspb.DeleteUserRequest{
+		Id: user.GetId(),
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound deleting a deleted user, got %v", err)
+	}
+
+	events := listEvents(t, &userspb.ListAuditEventsRequest{PageSize: 1})
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 audit events, got %d: %v", len(events), events)
+	}
+	for i, want := range []struct {
+		actor  string
+		action userspb.AuditAction
+	}{
+		{"alice", userspb.AuditAction_ADD_USER},
+		{"bob", userspb.AuditAction_ADD_USERS},
+		{"bob", userspb.AuditAction_DELETE_USER},
+	} {
+		if events[i].GetActor() != want.actor || events[i].GetAction() != want.action {
+			t.Errorf("Event %d was %s by %q, expected %s by %q", i, events[i].GetAction(), events[i].GetActor(), want.action, want.actor)
+		}
+	}
+	if got := events[0].GetAfter().GetFields()["name"].GetStringValue(); got != "Foo" {
+		t.Errorf("Expected added user snapshot, got %v", events[0].GetAfter())
+	}
+	if events[0].GetBefore() != nil {
+		t.Errorf("Expected no snapshot before adding, got %v", events[0].GetBefore())
+	}
+	if len(events[1].GetUserIds()) != 2 {
+		t.Errorf("Expected 2 users in the batch event, got %v", events[1].GetUserIds())
+	}
+	if _, ok := events[2].GetBefore().GetFields()["deleteTime"]; ok {
+		t.Errorf("Expected no delete time before deleting, got %v", events[2].GetBefore())
+	}
+	if _, ok := events[2].GetAfter().GetFields()["deleteTime"]; !ok || deleted.GetDeleteTime() == nil {
+		t.Errorf("Expected deleted user snapshot, got %v", events[2].GetAfter())
+	}
+
+	t.Run("Filtering by user", func(t *testing.T) {
+		t.Parallel()
+
+		got := listEvents(t, &userspb.ListAuditEventsRequest{UserId: user.GetId()})
+		if diff := cmp.Diff([]*userspb.AuditEvent{events[0], events[2]}, got, protocmp.Transform()); diff != "" {
+			t.Errorf("Events were not as expected:\n%s", diff)
+		}
+	})
+	t.Run("Filtering by actor and action", func(t *testing.T) {
+		t.Parallel()
+
+		got := listEvents(t, &userspb.ListAuditEventsRequest{
+			Actor:  "bob",
+			Action: userspb.AuditAction_DELETE_USER,
+		})
+		if diff := cmp.Diff(events[2:], got, protocmp.Transform()); diff != "" {
+			t.Errorf("Events were not as expected:\n%s", diff)
+		}
+	})
+	t.Run("Ignoring existing users", func(t *testing.T) {
+		t.Parallel()
+
+		carolCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(
+			users.ActorKey, "carol",
+			users.ConflictModeKey, users.ConflictModeIgnore,
+		))
+		addSrv := &addUsersSrvFake{
+			ctx: carolCtx,
+			reqs: []*userspb.AddUserRequest{
+				{Id: user.GetId(), Role: userspb.Role_GUEST, Name: "Ignored"},
+				{Role: userspb.Role_GUEST, Name: "Qux"},
+			},
+		}
+		err := directory.AddUsers(addSrv)
+		if err != nil {
+			t.Fatalf("Failed to add users: %s", err)
+		}
+		got := listEvents(t, &userspb.ListAuditEventsRequest{Actor: "carol"})
+		if len(got) != 1 {
+			t.Fatalf("Expected 1 audit event, got %d: %v", len(got), got)
+		}
+		if ids := got[0].GetUserIds(); len(ids) != 1 || ids[0] == user.GetId() {
+			t.Errorf("Expected only the added user in the batch event, got %v", ids)
+		}
+	})
+	t.Run("Recording updates and undeletes", func(t *testing.T) {
+		t.Parallel()
+
+		daveCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(users.ActorKey, "dave"))
+		added, err := directory.AddUser(daveCtx, &userspb.AddUserRequest{
+			Role: userspb.Role_MEMBER,
+			Name: "Before",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		_, err = directory.UpdateUser(daveCtx, &userspb.UpdateUserRequest{
+			User: &userspb.User{Id: added.GetId(), Name: "After"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update user: %s", err)
+		}
+		_, err = directory.DeleteUser(daveCtx, &userspb.DeleteUserRequest{Id: added.GetId()})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
+		_, err = directory.UndeleteUser(daveCtx, &userspb.UndeleteUserRequest{Id: added.GetId()})
+		if err != nil {
+			t.Fatalf("Failed to undelete user: %s", err)
+		}
+		// Failed updates are not recorded.
+		_, err = directory.UpdateUser(daveCtx, &userspb.UpdateUserRequest{
+			User: &userspb.User{Id: added.GetId(), Name: "Stale", Etag: "1"},
+		})
+		if status.Code(err) != codes.Aborted {
+			t.Fatalf("Expected Aborted updating with a stale etag, got %v", err)
+		}
+
+		got := listEvents(t, &userspb.ListAuditEventsRequest{UserId: added.GetId()})
+		var actions []userspb.AuditAction
+		for _, event := range got {
+			actions = append(actions, event.GetAction())
+		}
+		want := []userspb.AuditAction{
+			userspb.AuditAction_ADD_USER,
+			userspb.AuditAction_UPDATE_USER,
+			userspb.AuditAction_DELETE_USER,
+			userspb.AuditAction_UNDELETE_USER,
+		}
+		if diff := cmp.Diff(want, actions); diff != "" {
+			t.Fatalf("Actions were not as expected:\n%s", diff)
+		}
+		update := got[1]
+		if name := update.GetBefore().GetFields()["name"].GetStringValue(); name != "Before" {
+			t.Errorf("Expected the user before the update, got %v", update.GetBefore())
+		}
+		if name := update.GetAfter().GetFields()["name"].GetStringValue(); name != "After" {
+			t.Errorf("Expected the user after the update, got %v", update.GetAfter())
+		}
+		undelete := got[3]
+		if _, ok := undelete.GetBefore().GetFields()["deleteTime"]; !ok {
+			t.Errorf("Expected the deleted user before undeleting, got %v", undelete.GetBefore())
+		}
+		if _, ok := undelete.GetAfter().GetFields()["deleteTime"]; ok {
+			t.Errorf("Expected no delete time after undeleting, got %v", undelete.GetAfter())
+		}
+	})
+	t.Run("Filtering by time", func(t *testing.T) {
+		t.Parallel()
+
+		got := listEvents(t, &userspb.ListAuditEventsRequest{
+			StartTime: timestamppb.New(start),
+			EndTime:   events[1].GetCreateTime(),
+		})
+		if diff := cmp.Diff(events[:1], got, protocmp.Transform()); diff != "" {
+			t.Errorf("Events were not as expected:\n%s", diff)
+		}
+		got = listEvents(t, &userspb.ListAuditEventsRequest{
+			EndTime: timestamppb.New(start),
+		})
+		if len(got) != 0 {
+			t.Errorf("Expected no events before the start, got %v", got)
+		}
+	})
+}
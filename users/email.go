@@ -0,0 +1,56 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/mail"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+// maxEmailLength is the maximum length of an email address, per RFC 5321.
+const maxEmailLength = 254
+
+// validateEmail validates an email address, if set. Only plain addresses
+// are accepted, without display names or angle brackets.
+func validateEmail(email string) error {
+	if email == "" {
+		return nil
+	}
+	if len(email) > maxEmailLength {
+		return status.Errorf(codes.InvalidArgument, "email must be at most %d characters", maxEmailLength)
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return status.Errorf(codes.InvalidArgument, "invalid email %q", email)
+	}
+	return nil
+}
+
+// emailParam stores empty email addresses as NULL, so that
+// they don't conflict.
+func emailParam(email string) sql.NullString {
+	return sql.NullString{
+		String: email,
+		Valid:  email != "",
+	}
+}
+
+// GetUserByEmail gets the user with the email address, if found.
+func (d Directory) GetUserByEmail(ctx context.Context, req *userspb.GetUserByEmailRequest) (*userspb.User, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email must be set")
+	}
+	pgUser, err := d.querier.GetUserByEmail(ctx, req.GetEmail())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+	}
+	return userPostgresToProto(pgUser)
+}
@@ -0,0 +1,50 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/jackc/pgtype"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// versionEtag encodes the version of a user or group as an etag.
+func versionEtag(version int64) string {
+	return strconv.FormatInt(version, 10)
+}
+
+// parseEtag returns the version encoded in the etag,
+// or 0 if no etag was provided.
+func parseEtag(etag string) (int64, error) {
+	if etag == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(etag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid etag %q", etag)
+	}
+	return version, nil
+}
+
+// checkVersion returns ABORTED if the user exists with a version other
+// than the one provided. It is used to explain why a mutation with an
+// etag matched no rows.
+func (d Directory) checkVersion(ctx context.Context, userID pgtype.UUID, version int64) error {
+	if version == 0 {
+		return nil
+	}
+	pgUser, err := d.querier.GetUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+	}
+	if pgUser.Version != version {
+		return status.Error(codes.Aborted, "etag does not match the current user, it was changed concurrently")
+	}
+	return nil
+}
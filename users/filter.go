@@ -0,0 +1,639 @@
+package users
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgtype"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+// This file implements the subset of the filter language described in
+// https://google.aip.dev/160 that is supported by ListUsers, e.g.
+//
+//	role = ADMIN AND create_time > "2024-01-01T00:00:00Z" AND name:"smith"
+//
+// Filters are parsed into an AST, which is then translated into squirrel
+// predicates for Postgres or SQLite, or into predicates evaluated in memory
+// by MemoryStore.
+// Values are always passed as query arguments, never interpolated into
+// the query.
+
+// maxFilterLength limits the size of filters, to bound the work done
+// parsing them.
+const maxFilterLength = 2048
+
+// filterError is an error in a filter, at a position in the filter.
+type filterError struct {
+	// pos is the 1-based position of the error in the filter, in runes.
+	pos    int
+	reason string
+}
+
+func (e *filterError) Error() string {
+	return fmt.Sprintf("invalid filter: position %d: %s", e.pos, e.reason)
+}
+
+func (e *filterError) GRPCStatus() *status.Status {
+	return status.New(codes.InvalidArgument, e.Error())
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenLParen
+	tokenRParen
+	tokenComparator
+	tokenString
+	tokenText
+)
+
+type token struct {
+	kind tokenKind
+	// text is the comparator, the unquoted string or the text.
+	text string
+	pos  int
+}
+
+func (t token) isKeyword(keyword string) bool {
+	return t.kind == tokenText && t.text == keyword
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of filter"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lexFilter splits the filter into tokens.
+func lexFilter(filter string) ([]token, error) {
+	var tokens []token
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: pos})
+			i++
+		case r == '=' || r == ':':
+			tokens = append(tokens, token{kind: tokenComparator, text: string(r), pos: pos})
+			i++
+		case r == '<' || r == '>' || r == '!':
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &filterError{pos: pos, reason: `unexpected "!", did you mean "!="?`}
+			}
+			tokens = append(tokens, token{kind: tokenComparator, text: op, pos: pos})
+			i += len(op)
+		case r == '"':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, &filterError{pos: pos, reason: "unterminated string"}
+				}
+				if runes[i] == '"' {
+					i++
+					break
+				}
+				if runes[i] == '\\' {
+					if i+1 >= len(runes) {
+						return nil, &filterError{pos: pos, reason: "unterminated string"}
+					}
+					i++
+				}
+				b.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: b.String(), pos: pos})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`()=:<>!"`, runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenText, text: string(runes[start:i]), pos: pos})
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+// filterExpr is a node in the filter AST.
+type filterExpr interface {
+	isFilterExpr()
+}
+
+type andExpr struct {
+	left, right filterExpr
+}
+
+type orExpr struct {
+	left, right filterExpr
+}
+
+type notExpr struct {
+	expr filterExpr
+}
+
+// comparison compares a field to a value.
+type comparison struct {
+	field    string
+	fieldPos int
+	op       string
+	value    string
+	valuePos int
+}
+
+func (andExpr) isFilterExpr()    {}
+func (orExpr) isFilterExpr()     {}
+func (notExpr) isFilterExpr()    {}
+func (comparison) isFilterExpr() {}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+// parseFilter parses the filter into an AST. An empty filter
+// returns a nil expression.
+func parseFilter(filter string) (filterExpr, error) {
+	if utf8.RuneCountInString(filter) > maxFilterLength {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid filter: must be at most %d characters", maxFilterLength)
+	}
+	tokens, err := lexFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, nil
+	}
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &filterError{pos: t.pos, reason: fmt.Sprintf("unexpected %s", t)}
+	}
+	return expr, nil
+}
+
+func (p *filterParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// parseExpression parses sequences separated by AND.
+func (p *filterParser) parseExpression() (filterExpr, error) {
+	left, err := p.parseSequence()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("AND") {
+		p.next()
+		right, err := p.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseSequence parses factors separated by whitespace, which
+// are implicitly combined with AND.
+func (p *filterParser) parseSequence() (filterExpr, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind == tokenEOF || t.kind == tokenRParen || t.isKeyword("AND") {
+			return left, nil
+		}
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+}
+
+// parseFactor parses terms separated by OR. As in AIP-160,
+// OR binds tighter than AND.
+func (p *filterParser) parseFactor() (filterExpr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("OR") {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseTerm parses an optionally negated simple expression.
+func (p *filterParser) parseTerm() (filterExpr, error) {
+	if p.peek().isKeyword("NOT") {
+		p.next()
+		expr, err := p.parseSimple()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: expr}, nil
+	}
+	return p.parseSimple()
+}
+
+// parseSimple parses a parenthesized expression or a comparison.
+func (p *filterParser) parseSimple() (filterExpr, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokenLParen:
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if end := p.next(); end.kind != tokenRParen {
+			return nil, &filterError{pos: end.pos, reason: fmt.Sprintf("expected \")\", got %s", end)}
+		}
+		return expr, nil
+	case t.kind == tokenText && !t.isKeyword("AND") && !t.isKeyword("OR") && !t.isKeyword("NOT"):
+		op := p.next()
+		if op.kind != tokenComparator {
+			return nil, &filterError{pos: op.pos, reason: fmt.Sprintf("expected comparator after field %q, got %s", t.text, op)}
+		}
+		value := p.next()
+		if value.kind != tokenString && value.kind != tokenText {
+			return nil, &filterError{pos: value.pos, reason: fmt.Sprintf("expected value after %q, got %s", op.text, value)}
+		}
+		return comparison{
+			field:    t.text,
+			fieldPos: t.pos,
+			op:       op.text,
+			value:    value.text,
+			valuePos: value.pos,
+		}, nil
+	default:
+		return nil, &filterError{pos: t.pos, reason: fmt.Sprintf("unexpected %s", t)}
+	}
+}
+
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	uuidField
+	roleField
+	timeField
+)
+
+// filterField is a field that can be used in filters.
+type filterField struct {
+	column string
+	kind   fieldKind
+}
+
+// filterFields is the allow-list of fields that can be used in filters.
+var filterFields = map[string]filterField{
+	"id":          {column: "id", kind: uuidField},
+	"name":        {column: "name", kind: stringField},
+	"email":       {column: "email", kind: stringField},
+	"role":        {column: "role", kind: roleField},
+	"create_time": {column: "create_time", kind: timeField},
+	"delete_time": {column: "delete_time", kind: timeField},
+}
+
+// filterToSql translates the filter AST into a squirrel predicate, with
+// the comparisons translated by compare, which differs by database.
+func filterToSql(expr filterExpr, compare func(comparison) (squirrel.Sqlizer, error)) (squirrel.Sqlizer, error) {
+	switch e := expr.(type) {
+	case andExpr:
+		left, err := filterToSql(e.left, compare)
+		if err != nil {
+			return nil, err
+		}
+		right, err := filterToSql(e.right, compare)
+		if err != nil {
+			return nil, err
+		}
+		return squirrel.And{left, right}, nil
+	case orExpr:
+		left, err := filterToSql(e.left, compare)
+		if err != nil {
+			return nil, err
+		}
+		right, err := filterToSql(e.right, compare)
+		if err != nil {
+			return nil, err
+		}
+		return squirrel.Or{left, right}, nil
+	case notExpr:
+		pred, err := filterToSql(e.expr, compare)
+		if err != nil {
+			return nil, err
+		}
+		return notSqlizer{pred}, nil
+	case comparison:
+		return compare(e)
+	default:
+		return nil, status.Errorf(codes.Internal, "unexpected filter expression %T", expr)
+	}
+}
+
+// comparisonToSql translates a comparison into a Postgres predicate.
+func comparisonToSql(c comparison) (squirrel.Sqlizer, error) {
+	field, value, err := comparisonValue(c)
+	if err != nil {
+		return nil, err
+	}
+	if c.op == ":" && field.kind == stringField {
+		return squirrel.ILike{
+			field.column: "%" + escapeLike(value.(string)) + "%",
+		}, nil
+	}
+	return compareColumn(field.column, c.op, value), nil
+}
+
+// compareColumn returns a predicate comparing the column to the value
+// with the comparator, where ":" is equality.
+func compareColumn(column, op string, value interface{}) squirrel.Sqlizer {
+	switch op {
+	case "=", ":":
+		return squirrel.Eq{column: value}
+	case "!=":
+		return squirrel.NotEq{column: value}
+	case "<":
+		return squirrel.Lt{column: value}
+	case "<=":
+		return squirrel.LtOrEq{column: value}
+	case ">":
+		return squirrel.Gt{column: value}
+	default:
+		return squirrel.GtOrEq{column: value}
+	}
+}
+
+// comparisonValue validates the comparison, returning the field compared
+// and the value to compare it to, as passed to the query.
+func comparisonValue(c comparison) (filterField, interface{}, error) {
+	field, ok := filterFields[c.field]
+	if !ok {
+		return field, nil, &filterError{pos: c.fieldPos, reason: fmt.Sprintf("unknown field %q", c.field)}
+	}
+
+	var value interface{}
+	switch field.kind {
+	case stringField:
+		value = c.value
+	case uuidField:
+		var id pgtype.UUID
+		err := id.Set(c.value)
+		if err != nil {
+			return field, nil, &filterError{pos: c.valuePos, reason: fmt.Sprintf("invalid UUID %q", c.value)}
+		}
+		value = id
+	case roleField:
+		role, ok := userspb.Role_value[c.value]
+		if !ok {
+			return field, nil, &filterError{pos: c.valuePos, reason: fmt.Sprintf("invalid role %q", c.value)}
+		}
+		pgRole, err := roleProtoToPostgres(userspb.Role(role))
+		if err != nil {
+			return field, nil, err
+		}
+		value = pgRole
+	case timeField:
+		t, err := time.Parse(time.RFC3339Nano, c.value)
+		if err != nil {
+			return field, nil, &filterError{pos: c.valuePos, reason: fmt.Sprintf("invalid RFC3339 timestamp %q", c.value)}
+		}
+		var pgTime pgtype.Timestamptz
+		err = pgTime.Set(t)
+		if err != nil {
+			return field, nil, &filterError{pos: c.valuePos, reason: fmt.Sprintf("invalid timestamp %q", c.value)}
+		}
+		value = pgTime
+	}
+
+	switch c.op {
+	case "=", ":", "!=":
+		return field, value, nil
+	}
+	if field.kind != stringField && field.kind != timeField {
+		return field, nil, &filterError{pos: c.fieldPos, reason: fmt.Sprintf("field %q does not support %q", c.field, c.op)}
+	}
+	switch c.op {
+	case "<", "<=", ">", ">=":
+		return field, value, nil
+	default:
+		return field, nil, &filterError{pos: c.fieldPos, reason: fmt.Sprintf("unsupported comparator %q", c.op)}
+	}
+}
+
+// notSqlizer negates a predicate.
+type notSqlizer struct {
+	squirrel.Sqlizer
+}
+
+func (n notSqlizer) ToSql() (string, []interface{}, error) {
+	sql, args, err := n.Sqlizer.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+	return "NOT (" + sql + ")", args, nil
+}
+
+// sqlBool is the result of a predicate in SQL's three-valued logic,
+// where comparisons to NULL are unknown.
+type sqlBool int
+
+const (
+	sqlFalse sqlBool = iota
+	sqlTrue
+	sqlUnknown
+)
+
+func (b sqlBool) and(o sqlBool) sqlBool {
+	switch {
+	case b == sqlFalse || o == sqlFalse:
+		return sqlFalse
+	case b == sqlTrue && o == sqlTrue:
+		return sqlTrue
+	default:
+		return sqlUnknown
+	}
+}
+
+func (b sqlBool) or(o sqlBool) sqlBool {
+	switch {
+	case b == sqlTrue || o == sqlTrue:
+		return sqlTrue
+	case b == sqlFalse && o == sqlFalse:
+		return sqlFalse
+	default:
+		return sqlUnknown
+	}
+}
+
+func (b sqlBool) not() sqlBool {
+	switch b {
+	case sqlTrue:
+		return sqlFalse
+	case sqlFalse:
+		return sqlTrue
+	default:
+		return sqlUnknown
+	}
+}
+
+// filterToFunc translates the filter AST into a predicate evaluated on
+// users in memory, with the same semantics as the predicate returned by
+// filterToSql, except that strings are compared byte by byte.
+func filterToFunc(expr filterExpr) (func(User) sqlBool, error) {
+	switch e := expr.(type) {
+	case andExpr:
+		left, err := filterToFunc(e.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := filterToFunc(e.right)
+		if err != nil {
+			return nil, err
+		}
+		return func(u User) sqlBool { return left(u).and(right(u)) }, nil
+	case orExpr:
+		left, err := filterToFunc(e.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := filterToFunc(e.right)
+		if err != nil {
+			return nil, err
+		}
+		return func(u User) sqlBool { return left(u).or(right(u)) }, nil
+	case notExpr:
+		pred, err := filterToFunc(e.expr)
+		if err != nil {
+			return nil, err
+		}
+		return func(u User) sqlBool { return pred(u).not() }, nil
+	case comparison:
+		return comparisonToFunc(e)
+	default:
+		return nil, status.Errorf(codes.Internal, "unexpected filter expression %T", expr)
+	}
+}
+
+func comparisonToFunc(c comparison) (func(User) sqlBool, error) {
+	field, value, err := comparisonValue(c)
+	if err != nil {
+		return nil, err
+	}
+	if c.op == ":" && field.kind == stringField {
+		substr := strings.ToLower(value.(string))
+		return func(u User) sqlBool {
+			text, ok := userText(u, field.column)
+			if !ok {
+				return sqlUnknown
+			}
+			return toSqlBool(strings.Contains(strings.ToLower(text), substr))
+		}, nil
+	}
+	return func(u User) sqlBool {
+		cmp, ok := compareUserField(u, field.column, value)
+		if !ok {
+			return sqlUnknown
+		}
+		switch c.op {
+		case "=", ":":
+			return toSqlBool(cmp == 0)
+		case "!=":
+			return toSqlBool(cmp != 0)
+		case "<":
+			return toSqlBool(cmp < 0)
+		case "<=":
+			return toSqlBool(cmp <= 0)
+		case ">":
+			return toSqlBool(cmp > 0)
+		default:
+			return toSqlBool(cmp >= 0)
+		}
+	}, nil
+}
+
+func toSqlBool(b bool) sqlBool {
+	if b {
+		return sqlTrue
+	}
+	return sqlFalse
+}
+
+// userText returns the value of the text column of the user, reporting
+// false if it is NULL.
+func userText(u User, column string) (string, bool) {
+	if column == "email" {
+		return u.Email.String, u.Email.Valid
+	}
+	return u.Name, true
+}
+
+// compareUserField compares the column of the user to a value returned
+// by comparisonValue, reporting false if the column is NULL.
+func compareUserField(u User, column string, value interface{}) (int, bool) {
+	switch column {
+	case "id":
+		id := value.(pgtype.UUID)
+		return bytes.Compare(u.ID.Bytes[:], id.Bytes[:]), true
+	case "role":
+		return strings.Compare(string(u.Role), string(value.(Role))), true
+	case "create_time", "delete_time":
+		t := u.CreateTime
+		if column == "delete_time" {
+			if !u.DeleteTime.Valid {
+				return 0, false
+			}
+			t = u.DeleteTime.Time
+		}
+		// Postgres stores timestamps with microsecond precision.
+		return t.Compare(value.(pgtype.Timestamptz).Time.Truncate(time.Microsecond)), true
+	default:
+		text, ok := userText(u, column)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(text, value.(string)), true
+	}
+}
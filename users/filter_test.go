@@ -0,0 +1,156 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFilterToSql(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		filter   string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "Single comparison",
+			filter:   `name = "Foo"`,
+			wantSQL:  "name = ?",
+			wantArgs: []interface{}{"Foo"},
+		},
+		{
+			name:     "Substring",
+			filter:   `name:"smi_th"`,
+			wantSQL:  "name ILIKE ?",
+			wantArgs: []interface{}{`%smi\_th%`},
+		},
+		{
+			name:     "Role",
+			filter:   `role != ADMIN`,
+			wantSQL:  "role <> ?",
+			wantArgs: []interface{}{RoleAdmin},
+		},
+		{
+			name:     "AND binds looser than OR",
+			filter:   `role = ADMIN AND name = "Foo" OR name = "Bar"`,
+			wantSQL:  "(role = ? AND (name = ? OR name = ?))",
+			wantArgs: []interface{}{RoleAdmin, "Foo", "Bar"},
+		},
+		{
+			name:     "Implicit AND",
+			filter:   `name >= "A" name < "B"`,
+			wantSQL:  "(name >= ? AND name < ?)",
+			wantArgs: []interface{}{"A", "B"},
+		},
+		{
+			name:     "Parentheses and NOT",
+			filter:   `NOT (role = GUEST OR role = MEMBER)`,
+			wantSQL:  "NOT ((role = ? OR role = ?))",
+			wantArgs: []interface{}{RoleGuest, RoleMember},
+		},
+		{
+			name:     "Escaped quotes",
+			filter:   `name = "Say \"hi\""`,
+			wantSQL:  "name = ?",
+			wantArgs: []interface{}{`Say "hi"`},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			expr, err := parseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("Failed to parse filter: %s", err)
+			}
+			pred, err := filterToSql(expr, comparisonToSql)
+			if err != nil {
+				t.Fatalf("Failed to translate filter: %s", err)
+			}
+			sql, args, err := pred.ToSql()
+			if err != nil {
+				t.Fatalf("Failed to build SQL: %s", err)
+			}
+			if sql != tt.wantSQL {
+				t.Errorf("Got SQL %q, wanted %q", sql, tt.wantSQL)
+			}
+			if diff := cmp.Diff(tt.wantArgs, args); diff != "" {
+				t.Errorf("Args were not as expected:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		filter  string
+		wantErr string
+	}{
+		{
+			name:    "Unknown field",
+			filter:  `role = ADMIN AND password = "hunter2"`,
+			wantErr: `invalid filter: position 18: unknown field "password"`,
+		},
+		{
+			name:    "Invalid role",
+			filter:  `role = OWNER`,
+			wantErr: `invalid filter: position 8: invalid role "OWNER"`,
+		},
+		{
+			name:    "Invalid timestamp",
+			filter:  `create_time > "yesterday"`,
+			wantErr: `invalid filter: position 15: invalid RFC3339 timestamp "yesterday"`,
+		},
+		{
+			name:    "Unsupported comparator",
+			filter:  `role < ADMIN`,
+			wantErr: `invalid filter: position 1: field "role" does not support "<"`,
+		},
+		{
+			name:    "Missing comparator",
+			filter:  `name`,
+			wantErr: `invalid filter: position 5: expected comparator after field "name", got end of filter`,
+		},
+		{
+			name:    "Unbalanced parentheses",
+			filter:  `(name = "Foo"`,
+			wantErr: `invalid filter: position 14: expected ")", got end of filter`,
+		},
+		{
+			name:    "Unterminated string",
+			filter:  `name = "Foo`,
+			wantErr: `invalid filter: position 8: unterminated string`,
+		},
+		{
+			name:    "Dangling AND",
+			filter:  `name = "Foo" AND`,
+			wantErr: `invalid filter: position 17: unexpected end of filter`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			expr, err := parseFilter(tt.filter)
+			if err == nil {
+				_, err = filterToSql(expr, comparisonToSql)
+			}
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Got error %v, wanted InvalidArgument", err)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("Got error %q, wanted %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
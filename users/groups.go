@@ -0,0 +1,404 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgtype"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+// groupColumns are the columns of the groups table, in the order
+// expected by scanGroup.
+var groupColumns = []string{
+	"id",
+	"name",
+	"description",
+	"create_time",
+	"version",
+}
+
+// scanGroup scans a row selected with groupColumns.
+func scanGroup(row rowScanner) (Group, error) {
+	var pgGroup Group
+	err := row.Scan(
+		&pgGroup.ID,
+		&pgGroup.Name,
+		&pgGroup.Description,
+		&pgGroup.CreateTime,
+		&pgGroup.Version,
+	)
+	return pgGroup, err
+}
+
+func groupPostgresToProto(pgGroup Group) (*userspb.Group, error) {
+	var groupID string
+	err := pgGroup.ID.AssignTo(&groupID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	return &userspb.Group{
+		Id:          groupID,
+		Name:        pgGroup.Name,
+		Description: pgGroup.Description,
+		CreateTime:  timestamppb.New(pgGroup.CreateTime),
+		Etag:        versionEtag(pgGroup.Version),
+	}, nil
+}
+
+func memberPostgresToProto(pgMember GroupMember) (*userspb.GroupMember, error) {
+	var groupID, userID string
+	err := pgMember.GroupID.AssignTo(&groupID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	err = pgMember.UserID.AssignTo(&userID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	return &userspb.GroupMember{
+		GroupId:    groupID,
+		UserId:     userID,
+		CreateTime: timestamppb.New(pgMember.CreateTime),
+	}, nil
+}
+
+// validateGroupName validates the name of a group.
+func validateGroupName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return status.Error(codes.InvalidArgument, "group name must be set")
+	}
+	return nil
+}
+
+// CreateGroup creates a group.
+func (d Directory) CreateGroup(ctx context.Context, req *userspb.CreateGroupRequest) (*userspb.Group, error) {
+	err := validateGroupName(req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	groupID, err := d.newID()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error generating ID: %s", err.Error())
+	}
+	pgGroup, err := d.querier.CreateGroup(ctx, CreateGroupParams{
+		ID:          groupID,
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+	})
+	if err != nil {
+		if err := uniqueViolationError(err); err != nil {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error creating group: %s", err.Error())
+	}
+	return groupPostgresToProto(pgGroup)
+}
+
+// GetGroup gets the group, if found.
+func (d Directory) GetGroup(ctx context.Context, req *userspb.GetGroupRequest) (*userspb.Group, error) {
+	var groupID pgtype.UUID
+	err := groupID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	pgGroup, err := d.getGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return groupPostgresToProto(pgGroup)
+}
+
+func (d Directory) getGroup(ctx context.Context, groupID pgtype.UUID) (Group, error) {
+	pgGroup, err := d.querier.GetGroup(ctx, groupID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Group{}, status.Error(codes.NotFound, "group not found")
+		}
+		return Group{}, status.Errorf(codes.Internal, "unexpected error getting group: %s", err.Error())
+	}
+	return pgGroup, nil
+}
+
+// UpdateGroup updates the fields of the group selected by the update mask.
+func (d Directory) UpdateGroup(ctx context.Context, req *userspb.UpdateGroupRequest) (*userspb.Group, error) {
+	var groupID pgtype.UUID
+	err := groupID.Set(req.GetGroup().GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		if req.GetGroup().GetName() != "" {
+			paths = append(paths, "name")
+		}
+		if req.GetGroup().GetDescription() != "" {
+			paths = append(paths, "description")
+		}
+	}
+
+	var updateName, updateDescription bool
+	for _, path := range paths {
+		switch path {
+		case "*":
+			updateName, updateDescription = true, true
+		case "name":
+			updateName = true
+		case "description":
+			updateDescription = true
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported update mask path %q", path)
+		}
+	}
+	if !updateName && !updateDescription {
+		return nil, status.Error(codes.InvalidArgument, "no fields to update")
+	}
+
+	version, err := parseEtag(req.GetGroup().GetEtag())
+	if err != nil {
+		return nil, err
+	}
+
+	q := d.sb.Update(
+		"groups",
+	).Set(
+		"version", squirrel.Expr("version + 1"),
+	).Where(
+		squirrel.Eq{"id": groupID},
+	).Suffix(
+		"RETURNING " + strings.Join(groupColumns, ", "),
+	)
+	if version != 0 {
+		q = q.Where(squirrel.Eq{"version": version})
+	}
+	if updateName {
+		err := validateGroupName(req.GetGroup().GetName())
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("name", req.GetGroup().GetName())
+	}
+	if updateDescription {
+		q = q.Set("description", req.GetGroup().GetDescription())
+	}
+
+	pgGroup, err := scanGroup(q.QueryRowContext(ctx))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, d.groupNotFound(ctx, groupID, version)
+		}
+		if err := uniqueViolationError(err); err != nil {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error updating group: %s", err.Error())
+	}
+	return groupPostgresToProto(pgGroup)
+}
+
+// DeleteGroup deletes the group and its memberships, if found.
+func (d Directory) DeleteGroup(ctx context.Context, req *userspb.DeleteGroupRequest) (*userspb.Group, error) {
+	var groupID pgtype.UUID
+	err := groupID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	version, err := parseEtag(req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+	pgGroup, err := d.querier.DeleteGroup(ctx, DeleteGroupParams{
+		ID:      groupID,
+		Version: version,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, d.groupNotFound(ctx, groupID, version)
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error deleting group: %s", err.Error())
+	}
+	return groupPostgresToProto(pgGroup)
+}
+
+// groupNotFound explains why a mutation of the group matched no rows,
+// returning ABORTED if the group exists with a version other than the
+// one provided, and NOT_FOUND otherwise.
+func (d Directory) groupNotFound(ctx context.Context, groupID pgtype.UUID, version int64) error {
+	if version == 0 {
+		return status.Error(codes.NotFound, "group not found")
+	}
+	pgGroup, err := d.getGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if pgGroup.Version != version {
+		return status.Error(codes.Aborted, "etag does not match the current group, it was changed concurrently")
+	}
+	return status.Error(codes.NotFound, "group not found")
+}
+
+// ListGroups lists a page of groups, ordered by creation.
+func (d Directory) ListGroups(ctx context.Context, req *userspb.ListGroupsRequest) (*userspb.ListGroupsResponse, error) {
+	q := d.sb.Select(
+		groupColumns...,
+	).From(
+		"groups",
+	)
+	if req.GetNamePrefix() != "" {
+		q = q.Where(squirrel.Like{
+			"name": escapeLike(req.GetNamePrefix()) + "%",
+		})
+	}
+	groups, next, err := d.listGroupsPage(ctx, q, req, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	return &userspb.ListGroupsResponse{
+		Groups:        groups,
+		NextPageToken: next,
+	}, nil
+}
+
+// AddMember adds the user to the group.
+func (d Directory) AddMember(ctx context.Context, req *userspb.AddMemberRequest) (*userspb.GroupMember, error) {
+	params, err := memberParams(req.GetGroupId(), req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	pgMember, err := d.querier.AddGroupMember(ctx, AddGroupMemberParams(params))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, status.Error(codes.NotFound, "group not found")
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Errorf(codes.Internal, "unexpected error adding member: %s", err.Error())
+		}
+		// The user is either already a member, or doesn't exist.
+		pgMember, err = d.querier.GetGroupMember(ctx, params)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, status.Error(codes.NotFound, "user not found")
+			}
+			return nil, status.Errorf(codes.Internal, "unexpected error getting member: %s", err.Error())
+		}
+	}
+	return memberPostgresToProto(pgMember)
+}
+
+// RemoveMember removes the user from the group.
+func (d Directory) RemoveMember(ctx context.Context, req *userspb.RemoveMemberRequest) (*userspb.GroupMember, error) {
+	params, err := memberParams(req.GetGroupId(), req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	pgMember, err := d.querier.RemoveGroupMember(ctx, RemoveGroupMemberParams(params))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "membership not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error removing member: %s", err.Error())
+	}
+	return memberPostgresToProto(pgMember)
+}
+
+func memberParams(groupID, userID string) (GetGroupMemberParams, error) {
+	var params GetGroupMemberParams
+	err := params.GroupID.Set(groupID)
+	if err != nil {
+		return params, status.Error(codes.InvalidArgument, "invalid group UUID provided")
+	}
+	err = params.UserID.Set(userID)
+	if err != nil {
+		return params, status.Error(codes.InvalidArgument, "invalid user UUID provided")
+	}
+	return params, nil
+}
+
+// ListMembers lists a page of the users in the group.
+func (d Directory) ListMembers(ctx context.Context, req *userspb.ListMembersRequest) (*userspb.ListMembersResponse, error) {
+	var groupID pgtype.UUID
+	err := groupID.Set(req.GetGroupId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	_, err = d.getGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	q := d.sb.Select(
+		userColumns...,
+	).From(
+		"users",
+	).Where(
+		squirrel.Expr("id IN (SELECT user_id FROM group_members WHERE group_id = ?)", groupID),
+	).Where(
+		squirrel.Eq{"delete_time": nil},
+	)
+	users, next, err := d.listUsersPage(ctx, q, req, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	return &userspb.ListMembersResponse{
+		Users:         users,
+		NextPageToken: next,
+	}, nil
+}
+
+// ListUserGroups lists a page of the groups the user is a member of.
+func (d Directory) ListUserGroups(ctx context.Context, req *userspb.ListUserGroupsRequest) (*userspb.ListUserGroupsResponse, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	_, err = d.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	q := d.sb.Select(
+		groupColumns...,
+	).From(
+		"groups",
+	).Where(
+		squirrel.Expr("id IN (SELECT group_id FROM group_members WHERE user_id = ?)", userID),
+	)
+	groups, next, err := d.listGroupsPage(ctx, q, req, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	return &userspb.ListUserGroupsResponse{
+		Groups:        groups,
+		NextPageToken: next,
+	}, nil
+}
+
+// listGroupsPage lists a page of the groups selected by the query, in order
+// of creation, returning the groups and the token for the next page, if any.
+func (d Directory) listGroupsPage(ctx context.Context, q squirrel.SelectBuilder, req proto.Message, size int32, token string) ([]*userspb.Group, string, error) {
+	pgGroups, next, err := queryPage(ctx, d, q, req, size, token, scanGroup, func(pgGroup Group) pageToken {
+		return pageToken{
+			CreateTime: pgGroup.CreateTime,
+			ID:         pgGroup.ID.Bytes[:],
+		}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	groups := make([]*userspb.Group, 0, len(pgGroups))
+	for _, pgGroup := range pgGroups {
+		group, err := groupPostgresToProto(pgGroup)
+		if err != nil {
+			return nil, "", err
+		}
+		groups = append(groups, group)
+	}
+	return groups, next, nil
+}
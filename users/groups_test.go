@@ -0,0 +1,225 @@
+package users_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+	"github.com/johanbrandhorst/grpc-postgres/users"
+)
+
+func TestGroups(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	t.Run("Creating, updating and deleting a group", func(t *testing.T) {
+		t.Parallel()
+
+		group, err := directory.CreateGroup(ctx, &userspb.CreateGroupRequest{
+			Name:        "Admins",
+			Description: "The administrators",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create group: %s", err)
+		}
+		got, err := directory.GetGroup(ctx, &userspb.GetGroupRequest{
+			Id: group.GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to get group: %s", err)
+		}
+		if diff := cmp.Diff(group, got, protocmp.Transform()); diff != "" {
+			t.Fatalf("Group was not as expected:\n%s", diff)
+		}
+
+		_, err = directory.CreateGroup(ctx, &userspb.CreateGroupRequest{
+			Name: "admins",
+		})
+		if status.Code(err) != codes.AlreadyExists {
+			t.Fatalf("Expected AlreadyExists for a duplicate name, got %v", err)
+		}
+
+		updated, err := directory.UpdateGroup(ctx, &userspb.UpdateGroupRequest{
+			Group: &userspb.Group{
+				Id:          group.GetId(),
+				Description: "Updated",
+				Etag:        group.GetEtag(),
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"description"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update group: %s", err)
+		}
+		if updated.GetDescription() != "Updated" || updated.GetName() != "Admins" {
+			t.Fatalf("Group was not updated as expected: %v", updated)
+		}
+
+		_, err = directory.DeleteGroup(ctx, &userspb.DeleteGroupRequest{
+			Id:   group.GetId(),
+			Etag: group.GetEtag(),
+		})
+		if status.Code(err) != codes.Aborted {
+			t.Fatalf("Expected Aborted for a stale etag, got %v", err)
+		}
+		_, err = directory.DeleteGroup(ctx, &userspb.DeleteGroupRequest{
+			Id:   group.GetId(),
+			Etag: updated.GetEtag(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete group: %s", err)
+		}
+		_, err = directory.GetGroup(ctx, &userspb.GetGroupRequest{
+			Id: group.GetId(),
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected NotFound after deletion, got %v", err)
+		}
+	})
+	t.Run("Managing members", func(t *testing.T) {
+		t.Parallel()
+
+		group, err := directory.CreateGroup(ctx, &userspb.CreateGroupRequest{
+			Name: "Team",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create group: %s", err)
+		}
+		var members []*userspb.User
+		for _, name := range []string{"Foo", "Bar", "Baz"} {
+			user, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+				Role: userspb.Role_MEMBER,
+				Name: name,
+			})
+			if err != nil {
+				t.Fatalf("Failed to add user: %s", err)
+			}
+			members = append(members, user)
+			for i := 0; i < 2; i++ {
+				// Adding a member twice returns the same membership.
+				_, err = directory.AddMember(ctx, &userspb.AddMemberRequest{
+					GroupId: group.GetId(),
+					UserId:  user.GetId(),
+				})
+				if err != nil {
+					t.Fatalf("Failed to add member: %s", err)
+				}
+			}
+		}
+
+		var got []*userspb.User
+		req := &userspb.ListMembersRequest{
+			GroupId:  group.GetId(),
+			PageSize: 2,
+		}
+		for {
+			resp, err := directory.ListMembers(ctx, req)
+			if err != nil {
+				t.Fatalf("Failed to list members: %s", err)
+			}
+			got = append(got, resp.GetUsers()...)
+			if resp.GetNextPageToken() == "" {
+				break
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+		if diff := cmp.Diff(members, got, protocmp.Transform()); diff != "" {
+			t.Fatalf("Members were not as expected:\n%s", diff)
+		}
+
+		groups, err := directory.ListUserGroups(ctx, &userspb.ListUserGroupsRequest{
+			UserId: members[0].GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to list user groups: %s", err)
+		}
+		if diff := cmp.Diff([]*userspb.Group{group}, groups.GetGroups(), protocmp.Transform()); diff != "" {
+			t.Fatalf("Groups were not as expected:\n%s", diff)
+		}
+
+		_, err = directory.RemoveMember(ctx, &userspb.RemoveMemberRequest{
+			GroupId: group.GetId(),
+			UserId:  members[0].GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to remove member: %s", err)
+		}
+		_, err = directory.RemoveMember(ctx, &userspb.RemoveMemberRequest{
+			GroupId: group.GetId(),
+			UserId:  members[0].GetId(),
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected NotFound when removing a non-member, got %v", err)
+		}
+
+		// Soft deleted users are not listed.
+		_, err = directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id: members[1].GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
+		resp, err := directory.ListMembers(ctx, &userspb.ListMembersRequest{
+			GroupId: group.GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to list members: %s", err)
+		}
+		if diff := cmp.Diff(members[2:], resp.GetUsers(), protocmp.Transform()); diff != "" {
+			t.Fatalf("Members were not as expected:\n%s", diff)
+		}
+	})
+	t.Run("Adding a missing user or group", func(t *testing.T) {
+		t.Parallel()
+
+		group, err := directory.CreateGroup(ctx, &userspb.CreateGroupRequest{
+			Name: "Empty",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create group: %s", err)
+		}
+		user, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_GUEST,
+			Name: "Lonely",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		const missingID = "00000000-0000-4000-8000-000000000000"
+		_, err = directory.AddMember(ctx, &userspb.AddMemberRequest{
+			GroupId: group.GetId(),
+			UserId:  missingID,
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected NotFound for a missing user, got %v", err)
+		}
+		_, err = directory.AddMember(ctx, &userspb.AddMemberRequest{
+			GroupId: missingID,
+			UserId:  user.GetId(),
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected NotFound for a missing group, got %v", err)
+		}
+	})
+}
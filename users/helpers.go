@@ -3,15 +3,22 @@ package users
 import (
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"path"
+	"strings"
 
 	migrate "github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/cockroachdb"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	sqlitemigrate "github.com/golang-migrate/migrate/v4/database/sqlite"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -19,42 +26,111 @@ import (
 	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
 )
 
-//go:embed migrations/*.sql
-var fs embed.FS
+//go:embed migrations/*.sql migrations/cockroachdb/*.sql migrations/sqlite/*.sql
+var migrations embed.FS
 
 // version defines the current migration version. This ensures the app
 // is always compatible with the version of the database.
-const version = 1
+const version = 15
 
-// Migrate migrates the Postgres schema to the current version.
-func validateSchema(db *sql.DB, scheme string) error {
-	sourceInstance, err := iofs.New(fs, "migrations")
-	if err != nil {
-		return err
+// sqliteVersion defines the current version of the SQLite migrations,
+// which are separate from the Postgres migrations.
+const sqliteVersion = 1
+
+// schemeFS overlays scheme specific migrations on top of the shared
+// migrations. A migration in migrations/<scheme>/ replaces the shared
+// migration with the same name, for schemes where the shared migration
+// isn't supported.
+type schemeFS struct {
+	fs.FS
+	scheme string
+}
+
+func (s schemeFS) Open(name string) (fs.File, error) {
+	dir, file := path.Split(name)
+	f, err := s.FS.Open(path.Join(dir, s.scheme, file))
+	if err == nil {
+		return f, nil
 	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return s.FS.Open(name)
+}
+
+// Migrate migrates the schema to the current version.
+func validateSchema(db *sql.DB, scheme string) error {
+	var migrationsFS fs.FS = migrations
+	migrationsDir := "migrations"
+	target := uint(version)
 	var driverInstance database.Driver
+	var err error
 	switch scheme {
 	case "postgres", "postgresql":
 		driverInstance, err = postgres.WithInstance(db, new(postgres.Config))
 	case "cockroachdb":
+		migrationsFS = schemeFS{FS: migrations, scheme: scheme}
 		driverInstance, err = cockroachdb.WithInstance(db, new(cockroachdb.Config))
+	case "sqlite":
+		migrationsDir = "migrations/sqlite"
+		target = sqliteVersion
+		driverInstance, err = sqlitemigrate.WithInstance(db, new(sqlitemigrate.Config))
 	default:
 		return fmt.Errorf("unknown scheme: %q", scheme)
 	}
 	if err != nil {
 		return err
 	}
+	sourceInstance, err := iofs.New(migrationsFS, migrationsDir)
+	if err != nil {
+		return err
+	}
 	m, err := migrate.NewWithInstance("iofs", sourceInstance, scheme, driverInstance)
 	if err != nil {
 		return err
 	}
-	err = m.Migrate(version) // current version
+	err = m.Migrate(target) // current version
 	if err != nil && err != migrate.ErrNoChange {
 		return err
 	}
 	return sourceInstance.Close()
 }
 
+// userColumns are the columns of the users table, in the order
+// expected by scanUser.
+var userColumns = []string{
+	"id",
+	"role",
+	"create_time",
+	"name",
+	"delete_time",
+	"version",
+	"labels",
+	"attributes",
+	"email",
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser scans a row selected with userColumns.
+func scanUser(row rowScanner) (User, error) {
+	var pgUser User
+	err := row.Scan(
+		&pgUser.ID,
+		&pgUser.Role,
+		&pgUser.CreateTime,
+		&pgUser.Name,
+		&pgUser.DeleteTime,
+		&pgUser.Version,
+		&pgUser.Labels,
+		&pgUser.Attributes,
+		&pgUser.Email,
+	)
+	return pgUser, err
+}
+
 func userPostgresToProto(pgUser User) (*userspb.User, error) {
 	protoRole, err := rolePostgresToProto(pgUser.Role)
 	if err != nil {
@@ -65,12 +141,28 @@ func userPostgresToProto(pgUser User) (*userspb.User, error) {
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
 	}
-	return &userspb.User{
+	labels, err := decodeLabels(pgUser.Labels)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode labels: %s", err.Error())
+	}
+	attributes, err := decodeAttributes(pgUser.Attributes)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode attributes: %s", err.Error())
+	}
+	protoUser := &userspb.User{
 		CreateTime: timestamppb.New(pgUser.CreateTime),
 		Id:         userID,
 		Role:       protoRole,
 		Name:       pgUser.Name,
-	}, nil
+		Etag:       versionEtag(pgUser.Version),
+		Labels:     labels,
+		Attributes: attributes,
+		Email:      pgUser.Email.String,
+	}
+	if pgUser.DeleteTime.Valid {
+		protoUser.DeleteTime = timestamppb.New(pgUser.DeleteTime.Time)
+	}
+	return protoUser, nil
 }
 
 func rolePostgresToProto(pgRole Role) (userspb.Role, error) {
@@ -99,40 +191,148 @@ func roleProtoToPostgres(pbRole userspb.Role) (Role, error) {
 	}
 }
 
+var likeEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`%`, `\%`,
+	`_`, `\_`,
+)
+
+// escapeLike escapes the LIKE pattern characters in s, so that it
+// matches literally.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// uniqueViolation is the SQLSTATE of unique constraint violations.
+const uniqueViolation = "23505"
+
+// uniqueViolationError returns ALREADY_EXISTS if the error is a unique
+// constraint violation, and nil otherwise.
+func uniqueViolationError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return nil
+	}
+	switch pgErr.ConstraintName {
+	case "users_email_idx":
+		return status.Error(codes.AlreadyExists, "a user with the same email already exists")
+	case "users_pkey":
+		return status.Error(codes.AlreadyExists, "a user with the same ID already exists")
+	case "groups_name_idx":
+		return status.Error(codes.AlreadyExists, "a group with the same name already exists")
+	case "roles_pkey":
+		return status.Error(codes.AlreadyExists, "a role with the same name already exists")
+	default:
+		return status.Errorf(codes.AlreadyExists, "already exists: %s", pgErr.Message)
+	}
+}
+
+// foreignKeyViolation is the SQLSTATE of foreign key constraint violations.
+const foreignKeyViolation = "23503"
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation
+}
+
+// serializationFailure is the SQLSTATE of transactions that failed
+// because of concurrent transactions, and may be retried.
+const serializationFailure = "40001"
+
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == serializationFailure
+}
+
 var _ pgx.CopyFromSource = (*usersSource)(nil)
 
 type usersSource struct {
-	getUser    func() (*userspb.AddUserRequest, error)
-	nextValues []interface{}
-	err        error
+	getUser func() (*userspb.AddUserRequest, error)
+	newID   func() (pgtype.UUID, error)
+	// reportFailures skips invalid users, recording them
+	// in failures, rather than failing the copy.
+	reportFailures bool
+
+	index        int64
+	requestedIDs map[[16]byte]bool
+	ids          []string
+	failures     []*userspb.AddUsersFailure
+	next         AddUserParams
+	err          error
 }
 
 func (u *usersSource) Next() bool {
-	if u.err != nil {
-		return false
+	for u.err == nil {
+		var req *userspb.AddUserRequest
+		req, u.err = u.getUser()
+		if u.err != nil {
+			return false
+		}
+		index := u.index
+		u.index++
+		params, err := u.validate(req)
+		if err != nil {
+			if status.Code(err) != codes.InvalidArgument {
+				u.err = err
+				return false
+			}
+			reason := status.Convert(err).Message()
+			if !u.reportFailures {
+				u.err = status.Errorf(codes.InvalidArgument, "user %d: %s", index, reason)
+				return false
+			}
+			u.failures = append(u.failures, &userspb.AddUsersFailure{
+				Index:  index,
+				Reason: reason,
+			})
+			continue
+		}
+		var userID string
+		u.err = params.ID.AssignTo(&userID)
+		if u.err != nil {
+			u.err = status.Errorf(codes.Internal, "failed to assign UUID to string: %s", u.err.Error())
+			return false
+		}
+		u.ids = append(u.ids, userID)
+		u.next = params
+		return true
+	}
+	return false
+}
+
+// validate validates the user, returning the parameters to add it with.
+func (u *usersSource) validate(req *userspb.AddUserRequest) (AddUserParams, error) {
+	if req.GetRequestId() != "" {
+		// Retries would add the user again, so client IDs must be used instead.
+		return AddUserParams{}, status.Error(codes.InvalidArgument, "request IDs are only supported by AddUser, set the ID to retry adding users in bulk")
 	}
-	var req *userspb.AddUserRequest
-	req, u.err = u.getUser()
-	if u.err != nil {
-		return false
+	params, err := addUserParams(req, u.newID)
+	if err != nil {
+		return AddUserParams{}, err
 	}
-	var pgRole Role
-	pgRole, u.err = roleProtoToPostgres(req.Role)
-	if u.err != nil {
-		return false
+	if req.GetId() != "" {
+		// Duplicates would be inserted or merged twice.
+		if u.requestedIDs[params.ID.Bytes] {
+			return AddUserParams{}, status.Errorf(codes.InvalidArgument, "duplicate ID %q", req.GetId())
+		}
+		if u.requestedIDs == nil {
+			u.requestedIDs = map[[16]byte]bool{}
+		}
+		u.requestedIDs[params.ID.Bytes] = true
 	}
-	u.nextValues = []interface{}{pgRole, req.Name}
-	return true
+	return params, nil
 }
 
+// Values returns the values of the current user, in the order of copyColumns.
 func (u *usersSource) Values() ([]interface{}, error) {
-	return u.nextValues, nil
+	p := u.next
+	return []interface{}{p.ID.Bytes, p.Role, p.Name, []byte(p.Labels), []byte(p.Attributes), p.Email}, nil
 }
 
 func (u *usersSource) Err() error {
 	if u.err == io.EOF {
 		// This is actually success, so we don't want to return an error
-		return nil
+		u.err = nil
 	}
 	return u.err
 }
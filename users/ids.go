@@ -0,0 +1,99 @@
+package users
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// IDStrategy is a strategy for generating the IDs of new users.
+type IDStrategy int
+
+const (
+	// IDStrategyRandom generates random (version 4) UUIDs.
+	IDStrategyRandom IDStrategy = iota
+	// IDStrategyTimeOrdered generates time-ordered (version 7) UUIDs.
+	// Since new IDs sort after existing ones, inserts are appended to the
+	// primary key index rather than spread across it, and ordering users
+	// by ID orders them by creation.
+	IDStrategyTimeOrdered
+)
+
+// ParseIDStrategy parses an ID strategy by name, either "uuidv4" or "uuidv7".
+func ParseIDStrategy(name string) (IDStrategy, error) {
+	switch name {
+	case "uuidv4":
+		return IDStrategyRandom, nil
+	case "uuidv7":
+		return IDStrategyTimeOrdered, nil
+	default:
+		return 0, fmt.Errorf("unknown ID strategy %q", name)
+	}
+}
+
+func (s IDStrategy) generator() func() (pgtype.UUID, error) {
+	if s == IDStrategyTimeOrdered {
+		return new(uuidV7Generator).newID
+	}
+	return newUUIDv4
+}
+
+// newUUIDv4 generates a random (version 4) UUID.
+func newUUIDv4() (pgtype.UUID, error) {
+	id := pgtype.UUID{Status: pgtype.Present}
+	_, err := rand.Read(id.Bytes[:])
+	if err != nil {
+		return id, err
+	}
+	id.Bytes[6] = (id.Bytes[6] & 0x0f) | 0x40 // Version 4
+	id.Bytes[8] = (id.Bytes[8] & 0x3f) | 0x80 // RFC 9562 variant
+	return id, nil
+}
+
+// uuidV7Generator generates time-ordered (version 7) UUIDs, as described
+// in RFC 9562. The 12 bits following the millisecond timestamp hold a
+// counter, so that IDs generated within the same millisecond are ordered
+// too. The counter starts at a random value in the lower half of its
+// range, and borrows from the timestamp when it overflows.
+type uuidV7Generator struct {
+	mu     sync.Mutex
+	lastMs int64
+	seq    uint16
+}
+
+func (g *uuidV7Generator) newID() (pgtype.UUID, error) {
+	id := pgtype.UUID{Status: pgtype.Present}
+	_, err := rand.Read(id.Bytes[:])
+	if err != nil {
+		return id, err
+	}
+
+	g.mu.Lock()
+	ms := time.Now().UnixMilli()
+	switch {
+	case ms > g.lastMs:
+		g.lastMs = ms
+		g.seq = binary.BigEndian.Uint16(id.Bytes[6:8]) & 0x07ff
+	case g.seq < 0x0fff:
+		g.seq++
+	default:
+		g.lastMs++
+		g.seq = 0
+	}
+	ms, seq := g.lastMs, g.seq
+	g.mu.Unlock()
+
+	id.Bytes[0] = byte(ms >> 40)
+	id.Bytes[1] = byte(ms >> 32)
+	id.Bytes[2] = byte(ms >> 24)
+	id.Bytes[3] = byte(ms >> 16)
+	id.Bytes[4] = byte(ms >> 8)
+	id.Bytes[5] = byte(ms)
+	binary.BigEndian.PutUint16(id.Bytes[6:8], 0x7000|seq) // Version 7
+	id.Bytes[8] = (id.Bytes[8] & 0x3f) | 0x80             // RFC 9562 variant
+	return id, nil
+}
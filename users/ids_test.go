@@ -0,0 +1,59 @@
+package users
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestUUIDv7Generator(t *testing.T) {
+	t.Parallel()
+
+	g := new(uuidV7Generator)
+	before := time.Now().UnixMilli()
+	prev, err := g.newID()
+	if err != nil {
+		t.Fatalf("Failed to generate ID: %s", err)
+	}
+	// Enough IDs to overflow the counter within a millisecond.
+	for i := 0; i < 10000; i++ {
+		id, err := g.newID()
+		if err != nil {
+			t.Fatalf("Failed to generate ID: %s", err)
+		}
+		if id.Bytes[6]>>4 != 7 {
+			t.Fatalf("Got version %d, wanted 7", id.Bytes[6]>>4)
+		}
+		if id.Bytes[8]>>6 != 2 {
+			t.Fatalf("Got variant %b, wanted 10", id.Bytes[8]>>6)
+		}
+		if bytes.Compare(prev.Bytes[:], id.Bytes[:]) >= 0 {
+			t.Fatalf("ID %x was not ordered after %x", id.Bytes, prev.Bytes)
+		}
+		prev = id
+	}
+
+	var ms int64
+	for _, b := range prev.Bytes[:6] {
+		ms = ms<<8 | int64(b)
+	}
+	// The counter may have borrowed a few milliseconds.
+	if ms < before || ms > time.Now().UnixMilli()+10 {
+		t.Errorf("Got timestamp %d, wanted around %d", ms, before)
+	}
+}
+
+func TestUUIDv4(t *testing.T) {
+	t.Parallel()
+
+	id, err := newUUIDv4()
+	if err != nil {
+		t.Fatalf("Failed to generate ID: %s", err)
+	}
+	if id.Bytes[6]>>4 != 4 {
+		t.Errorf("Got version %d, wanted 4", id.Bytes[6]>>4)
+	}
+	if id.Bytes[8]>>6 != 2 {
+		t.Errorf("Got variant %b, wanted 10", id.Bytes[8]>>6)
+	}
+}
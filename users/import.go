@@ -0,0 +1,218 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"io"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+const (
+	// maxImportChunkSize is the maximum number of users in an import chunk.
+	maxImportChunkSize = 10000
+	maxImportIDLength  = 128
+)
+
+// ImportUsers adds users in chunks, committing and acknowledging each
+// chunk in turn. Since the next chunk is only received once the previous
+// one is acknowledged, clients are slowed down to the pace of the database.
+func (d Directory) ImportUsers(srv userspb.UserService_ImportUsersServer) error {
+	return d.userServer().ImportUsers(srv)
+}
+
+// validateImportChunk validates the import ID, chunk number and size.
+func validateImportChunk(req *userspb.ImportUsersRequest) error {
+	switch {
+	case req.GetImportId() == "":
+		return status.Error(codes.InvalidArgument, "import ID must be set")
+	case len(req.GetImportId()) > maxImportIDLength:
+		return status.Errorf(codes.InvalidArgument, "import ID must be at most %d characters", maxImportIDLength)
+	case req.GetChunk() < 0:
+		return status.Errorf(codes.InvalidArgument, "invalid chunk %d", req.GetChunk())
+	case len(req.GetUsers()) == 0:
+		return status.Errorf(codes.InvalidArgument, "chunk %d has no users", req.GetChunk())
+	case len(req.GetUsers()) > maxImportChunkSize:
+		return status.Errorf(codes.InvalidArgument, "chunk %d has more than %d users", req.GetChunk(), maxImportChunkSize)
+	}
+	return nil
+}
+
+// ImportChunk adds the users of the chunk, recording the chunk and its
+// acknowledgement in the same transaction. If the chunk was already
+// committed, the recorded acknowledgement is returned instead.
+func (d Directory) ImportChunk(ctx context.Context, req *userspb.ImportUsersRequest, reportFailures bool) (_ *userspb.ImportUsersResponse, retErr error) {
+	err := validateImportChunk(req)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := chunkHash(req)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error getting connection: %s", err.Error())
+	}
+	defer func() {
+		err := conn.Close()
+		if retErr == nil && err != nil {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error starting transaction: %s", err.Error())
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+	querier := New(tx)
+
+	var firstRow int64
+	if req.GetChunk() > 0 {
+		prev, err := querier.GetImportChunk(ctx, GetImportChunkParams{
+			ImportID: req.GetImportId(),
+			Chunk:    req.GetChunk() - 1,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, status.Errorf(codes.FailedPrecondition, "chunk %d of import %q has not been committed", req.GetChunk()-1, req.GetImportId())
+			}
+			return nil, status.Errorf(codes.Internal, "unexpected error getting previous chunk: %s", err.Error())
+		}
+		firstRow = prev.FirstRow + prev.RowCount
+	}
+
+	// Concurrent attempts to import the same chunk block here
+	// until the first one commits or rolls back.
+	n, err := querier.CreateImportChunk(ctx, CreateImportChunkParams{
+		ImportID:    req.GetImportId(),
+		Chunk:       req.GetChunk(),
+		FirstRow:    firstRow,
+		RowCount:    int64(len(req.GetUsers())),
+		RequestHash: hash,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error recording chunk: %s", err.Error())
+	}
+	if n == 0 {
+		err = tx.Rollback()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unexpected error rolling back transaction: %s", err.Error())
+		}
+		return d.committedChunk(ctx, req, hash)
+	}
+
+	reqs := req.GetUsers()
+	src := &usersSource{
+		getUser: func() (*userspb.AddUserRequest, error) {
+			if len(reqs) == 0 {
+				return nil, io.EOF
+			}
+			req := reqs[0]
+			reqs = reqs[1:]
+			return req, nil
+		},
+		newID:          d.newID,
+		reportFailures: reportFailures,
+		index:          firstRow,
+	}
+	var count int64
+	err = conn.Raw(func(driverConn interface{}) error {
+		// The connection is in the transaction, so the copy is too.
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		count, err = copyUsers(ctx, pgxConn, "users", src)
+		if err != nil {
+			return err
+		}
+		added, err := d.selectAddedUsers(ctx, pgxConn, src.ids)
+		if err != nil {
+			return err
+		}
+		return copyOutboxEvents(ctx, pgxConn, added, src.ids, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &userspb.ImportUsersResponse{
+		Chunk:    req.GetChunk(),
+		FirstRow: firstRow,
+		RowCount: int64(len(req.GetUsers())),
+		Count:    count,
+		Ids:      src.ids,
+		Failures: src.failures,
+	}
+	err = recordAuditEvent(ctx, querier, auditEvent{
+		action:  userspb.AuditAction_IMPORT_USERS,
+		userIDs: src.ids,
+		after:   resp,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recorded, err := protojson.Marshal(resp)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error encoding acknowledgement: %s", err.Error())
+	}
+	err = querier.SetImportChunkResponse(ctx, SetImportChunkResponseParams{
+		ImportID: req.GetImportId(),
+		Chunk:    req.GetChunk(),
+		Response: recorded,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error recording acknowledgement: %s", err.Error())
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing chunk: %s", err.Error())
+	}
+	return resp, nil
+}
+
+// committedChunk returns the recorded acknowledgement of a committed
+// chunk, if the chunk was committed with the same users.
+func (d Directory) committedChunk(ctx context.Context, req *userspb.ImportUsersRequest, hash []byte) (*userspb.ImportUsersResponse, error) {
+	chunk, err := d.querier.GetImportChunk(ctx, GetImportChunkParams{
+		ImportID: req.GetImportId(),
+		Chunk:    req.GetChunk(),
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error getting committed chunk: %s", err.Error())
+	}
+	if !bytes.Equal(chunk.RequestHash, hash) {
+		return nil, status.Errorf(codes.InvalidArgument, "chunk %d of import %q was committed with different users", req.GetChunk(), req.GetImportId())
+	}
+	resp := new(userspb.ImportUsersResponse)
+	err = protojson.Unmarshal(chunk.Response, resp)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error decoding acknowledgement: %s", err.Error())
+	}
+	resp.AlreadyCommitted = true
+	return resp, nil
+}
+
+// chunkHash identifies the contents of the chunk, so that resuming an
+// import with different users can be detected.
+func chunkHash(req *userspb.ImportUsersRequest) ([]byte, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error hashing chunk: %s", err.Error())
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
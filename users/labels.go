@@ -0,0 +1,223 @@
+package users
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	maxLabels         = 64
+	maxLabelLength    = 63
+	maxAttributesSize = 16 << 10
+	// maxLabelSelectorLength bounds the size of the generated query.
+	maxLabelSelectorLength = 2048
+)
+
+var (
+	labelKeyPattern   = regexp.MustCompile(`^[a-z0-9]([-a-z0-9_.]*[a-z0-9])?$`)
+	labelValuePattern = regexp.MustCompile(`^([a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?)?$`)
+)
+
+func validateLabel(key, value string) error {
+	if len(key) > maxLabelLength || !labelKeyPattern.MatchString(key) {
+		return status.Errorf(codes.InvalidArgument, "invalid label key %q", key)
+	}
+	if len(value) > maxLabelLength || !labelValuePattern.MatchString(value) {
+		return status.Errorf(codes.InvalidArgument, "invalid value %q for label %q", value, key)
+	}
+	return nil
+}
+
+// encodeLabels validates the labels and encodes them as JSON.
+func encodeLabels(labels map[string]string) (json.RawMessage, error) {
+	if len(labels) > maxLabels {
+		return nil, status.Errorf(codes.InvalidArgument, "users can have at most %d labels", maxLabels)
+	}
+	for key, value := range labels {
+		err := validateLabel(key, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if labels == nil {
+		// Avoid encoding as null.
+		labels = map[string]string{}
+	}
+	b, err := json.Marshal(labels)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error encoding labels: %s", err.Error())
+	}
+	return b, nil
+}
+
+// encodeAttributes validates the attributes and encodes them as JSON.
+func encodeAttributes(attributes *structpb.Struct) (json.RawMessage, error) {
+	if attributes == nil {
+		return json.RawMessage("{}"), nil
+	}
+	b, err := protojson.Marshal(attributes)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid attributes: %s", err.Error())
+	}
+	if len(b) > maxAttributesSize {
+		return nil, status.Errorf(codes.InvalidArgument, "attributes must be at most %d bytes when encoded as JSON", maxAttributesSize)
+	}
+	return b, nil
+}
+
+// decodeLabels decodes labels encoded as JSON. Empty labels are
+// decoded as nil.
+func decodeLabels(b json.RawMessage) (map[string]string, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	var labels map[string]string
+	err := json.Unmarshal(b, &labels)
+	if err != nil || len(labels) == 0 {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// decodeAttributes decodes attributes encoded as JSON. Empty attributes
+// are decoded as nil.
+func decodeAttributes(b json.RawMessage) (*structpb.Struct, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	attributes := new(structpb.Struct)
+	err := protojson.Unmarshal(b, attributes)
+	if err != nil || len(attributes.GetFields()) == 0 {
+		return nil, err
+	}
+	return attributes, nil
+}
+
+// labelRequirement is a requirement of a label selector.
+type labelRequirement struct {
+	key   string
+	value string
+	// op is one of "=", "!=", "exists" and "!exists".
+	op string
+}
+
+// parseLabelSelector parses and validates the requirements of a label selector.
+func parseLabelSelector(selector string) ([]labelRequirement, error) {
+	if len(selector) > maxLabelSelectorLength {
+		return nil, status.Errorf(codes.InvalidArgument, "label selector must be at most %d characters", maxLabelSelectorLength)
+	}
+	equal := map[string]string{}
+	var requirements []labelRequirement
+	for _, requirement := range strings.Split(selector, ",") {
+		requirement = strings.TrimSpace(requirement)
+		if key, value, ok := strings.Cut(requirement, "!="); ok {
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			err := validateLabel(key, value)
+			if err != nil {
+				return nil, invalidSelector(requirement, err)
+			}
+			requirements = append(requirements, labelRequirement{key: key, value: value, op: "!="})
+			continue
+		}
+		if key, value, ok := strings.Cut(requirement, "="); ok {
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			err := validateLabel(key, value)
+			if err != nil {
+				return nil, invalidSelector(requirement, err)
+			}
+			if prev, ok := equal[key]; ok && prev != value {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid label selector: conflicting requirements for label %q", key)
+			}
+			equal[key] = value
+			requirements = append(requirements, labelRequirement{key: key, value: value, op: "="})
+			continue
+		}
+		key, negated := strings.CutPrefix(requirement, "!")
+		key = strings.TrimSpace(key)
+		err := validateLabel(key, "")
+		if err != nil {
+			return nil, invalidSelector(requirement, err)
+		}
+		op := "exists"
+		if negated {
+			op = "!exists"
+		}
+		requirements = append(requirements, labelRequirement{key: key, op: op})
+	}
+	return requirements, nil
+}
+
+// labelSelectorToSql translates a label selector into a predicate. The
+// predicate only uses the containment and existence operators, so that
+// it can use the GIN index on labels.
+func labelSelectorToSql(selector string) (squirrel.Sqlizer, error) {
+	requirements, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	equal := map[string]string{}
+	var and squirrel.And
+	for _, r := range requirements {
+		switch r.op {
+		case "=":
+			equal[r.key] = r.value
+		case "!=":
+			b, err := json.Marshal(map[string]string{r.key: r.value})
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "unexpected error encoding labels: %s", err.Error())
+			}
+			and = append(and, squirrel.Expr("NOT (labels @> ?::jsonb)", string(b)))
+		case "exists":
+			// ?? is an escaped ? operator, rather than a placeholder.
+			and = append(and, squirrel.Expr("labels ?? ?", r.key))
+		case "!exists":
+			and = append(and, squirrel.Expr("NOT (labels ?? ?)", r.key))
+		}
+	}
+	if len(equal) > 0 {
+		// A single containment check for all equality requirements.
+		b, err := json.Marshal(equal)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unexpected error encoding labels: %s", err.Error())
+		}
+		and = append(squirrel.And{squirrel.Expr("labels @> ?::jsonb", string(b))}, and...)
+	}
+	return and, nil
+}
+
+// matchLabels reports whether the labels meet all the requirements.
+func matchLabels(labels map[string]string, requirements []labelRequirement) bool {
+	for _, r := range requirements {
+		value, ok := labels[r.key]
+		switch r.op {
+		case "=":
+			if !ok || value != r.value {
+				return false
+			}
+		case "!=":
+			if ok && value == r.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func invalidSelector(requirement string, err error) error {
+	return status.Errorf(codes.InvalidArgument, "invalid label selector requirement %q: %s", requirement, status.Convert(err).Message())
+}
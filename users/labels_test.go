@@ -0,0 +1,117 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLabelSelectorToSql(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		selector string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "Equality",
+			selector: "env=prod, team=core",
+			wantSQL:  "(labels @> ?::jsonb)",
+			wantArgs: []interface{}{`{"env":"prod","team":"core"}`},
+		},
+		{
+			name:     "Inequality",
+			selector: "env!=prod",
+			wantSQL:  "(NOT (labels @> ?::jsonb))",
+			wantArgs: []interface{}{`{"env":"prod"}`},
+		},
+		{
+			name:     "Existence",
+			selector: "env,!team",
+			wantSQL:  "(labels ?? ? AND NOT (labels ?? ?))",
+			wantArgs: []interface{}{"env", "team"},
+		},
+		{
+			name:     "Mixed",
+			selector: "team,env=prod",
+			wantSQL:  "(labels @> ?::jsonb AND labels ?? ?)",
+			wantArgs: []interface{}{`{"env":"prod"}`, "team"},
+		},
+		{
+			name:     "Empty value",
+			selector: "env=",
+			wantSQL:  "(labels @> ?::jsonb)",
+			wantArgs: []interface{}{`{"env":""}`},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pred, err := labelSelectorToSql(tt.selector)
+			if err != nil {
+				t.Fatalf("Failed to translate label selector: %s", err)
+			}
+			sql, args, err := pred.ToSql()
+			if err != nil {
+				t.Fatalf("Failed to build SQL: %s", err)
+			}
+			if sql != tt.wantSQL {
+				t.Errorf("Got SQL %q, wanted %q", sql, tt.wantSQL)
+			}
+			if diff := cmp.Diff(tt.wantArgs, args); diff != "" {
+				t.Errorf("Args were not as expected:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLabelSelectorErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		selector string
+		wantErr  string
+	}{
+		{
+			name:     "Invalid key",
+			selector: "Env=prod",
+			wantErr:  `invalid label selector requirement "Env=prod": invalid label key "Env"`,
+		},
+		{
+			name:     "Invalid value",
+			selector: "env=prod!",
+			wantErr:  `invalid label selector requirement "env=prod!": invalid value "prod!" for label "env"`,
+		},
+		{
+			name:     "Empty requirement",
+			selector: "env=prod,",
+			wantErr:  `invalid label selector requirement "": invalid label key ""`,
+		},
+		{
+			name:     "Conflicting requirements",
+			selector: "env=prod,env=dev",
+			wantErr:  `invalid label selector: conflicting requirements for label "env"`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := labelSelectorToSql(tt.selector)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Got error %v, wanted InvalidArgument", err)
+			}
+			if status.Convert(err).Message() != tt.wantErr {
+				t.Errorf("Got error %q, wanted %q", status.Convert(err).Message(), tt.wantErr)
+			}
+		})
+	}
+}
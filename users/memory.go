@@ -0,0 +1,818 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+// MemoryStore is a Store keeping users in memory, for tests and
+// development. It has the same semantics as the Postgres store, except
+// that strings are compared byte by byte, as with the C collation, and
+// that changes are neither recorded in the audit log nor published. They
+// can be watched, since the store makes all of them.
+type MemoryStore struct {
+	newID          func() (pgtype.UUID, error)
+	purgeRetention time.Duration
+	stopPurge      context.CancelFunc
+	purgeDone      chan struct{}
+	watchers       *watchHub
+
+	// mu is held while changes are emitted to the watchers,
+	// so that they are emitted in order.
+	mu    sync.RWMutex
+	users map[[16]byte]User
+	// emails maps the lowercased emails of users to their IDs, like
+	// the unique index on the emails of users.
+	emails map[string][16]byte
+	// requests maps the request IDs of added users to the requests.
+	requests map[string]memoryRequest
+	chunks   map[memoryChunkKey]memoryChunk
+}
+
+// memoryRequest is an AddUser request with a request ID.
+type memoryRequest struct {
+	userID     [16]byte
+	hash       []byte
+	createTime time.Time
+}
+
+// memoryChunkKey identifies a chunk of an import.
+type memoryChunkKey struct {
+	importID string
+	chunk    int64
+}
+
+// memoryChunk is a committed chunk of an import.
+type memoryChunk struct {
+	hash       []byte
+	response   *userspb.ImportUsersResponse
+	createTime time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore. Like a Directory, it
+// generates the IDs of new users as set by WithIDStrategy, and purges
+// deleted users as set by WithPurgeRetention, along with expired add user
+// requests and import chunks. Options that don't apply to a MemoryStore
+// are ignored.
+func NewMemoryStore(opts ...Option) *MemoryStore {
+	cfg := storeConfig(opts)
+	s := &MemoryStore{
+		newID:          cfg.newID,
+		purgeRetention: cfg.purgeRetention,
+		purgeDone:      make(chan struct{}),
+		// The local listener only fails once closed,
+		// so nothing is logged.
+		watchers: newWatchHub(slog.Default(), listenLocal),
+		users:    map[[16]byte]User{},
+		emails:   map[string][16]byte{},
+		requests: map[string]memoryRequest{},
+		chunks:   map[memoryChunkKey]memoryChunk{},
+	}
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	s.stopPurge = stopPurge
+	go s.purgeLoop(purgeCtx)
+	return s
+}
+
+// memoryNow returns the current time, with the precision of Postgres.
+func memoryNow() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// AddUser adds a user to the store.
+func (s *MemoryStore) AddUser(_ context.Context, req *userspb.AddUserRequest) (*userspb.User, error) {
+	params, err := addUserParams(req, s.newID)
+	if err != nil {
+		return nil, err
+	}
+	var hash []byte
+	if req.GetRequestId() != "" {
+		if len(req.GetRequestId()) > maxRequestIDLength {
+			return nil, status.Errorf(codes.InvalidArgument, "request ID must be at most %d characters", maxRequestIDLength)
+		}
+		hash, err = requestHash(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hash != nil {
+		if prev, ok := s.requests[req.GetRequestId()]; ok {
+			if !bytes.Equal(prev.hash, hash) {
+				return nil, status.Errorf(codes.InvalidArgument, "request ID %q was used for a different request", req.GetRequestId())
+			}
+			user, ok := s.users[prev.userID]
+			if !ok {
+				return nil, status.Errorf(codes.NotFound, "user added by request %q no longer exists", req.GetRequestId())
+			}
+			return userPostgresToProto(user)
+		}
+	}
+	if existing, ok := s.users[params.ID.Bytes]; ok {
+		return matchExistingUser(req, existing)
+	}
+	if emailTaken(s.emails, params.Email, params.ID) {
+		return nil, status.Error(codes.AlreadyExists, "a user with the same email already exists")
+	}
+	now := memoryNow()
+	pgUser := newMemoryUser(params, now)
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	putMemoryUser(s.users, s.emails, pgUser)
+	if hash != nil {
+		s.requests[req.GetRequestId()] = memoryRequest{
+			userID:     params.ID.Bytes,
+			hash:       hash,
+			createTime: now,
+		}
+	}
+	s.watchers.emit(userEvent(userspb.UserEventType_CREATED, user, now))
+	return user, nil
+}
+
+// BulkAddUsers adds the users returned by next, until it returns io.EOF.
+// The users are read before any are added, so that either all valid
+// users are added, or none are.
+func (s *MemoryStore) BulkAddUsers(_ context.Context, next func() (*userspb.AddUserRequest, error), opts AddUsersOptions) (*userspb.AddUsersResponse, error) {
+	switch opts.ConflictMode {
+	case "", ConflictModeError, ConflictModeIgnore, ConflictModeUpdate:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid conflict mode %q", opts.ConflictMode)
+	}
+	src := &usersSource{
+		getUser:        next,
+		newID:          s.newID,
+		reportFailures: opts.ReportFailures,
+	}
+	var batch []AddUserParams
+	for src.Next() {
+		batch = append(batch, src.next)
+	}
+	err := src.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Users added together are created at the same time,
+	// like users added in the same transaction.
+	now := memoryNow()
+	count, events, err := s.addUsers(batch, opts.ConflictMode, now)
+	if err != nil {
+		return nil, err
+	}
+	resp := &userspb.AddUsersResponse{
+		Count:    count,
+		Failures: src.failures,
+	}
+	if opts.ReturnUsers {
+		for _, params := range batch {
+			user, err := userPostgresToProto(s.users[params.ID.Bytes])
+			if err != nil {
+				return nil, err
+			}
+			resp.Users = append(resp.Users, user)
+		}
+	}
+	for _, event := range events {
+		s.watchers.emit(event)
+	}
+	return resp, nil
+}
+
+// addUsers adds the users created at the time provided, handling
+// conflicts as set by the conflict mode, and returns the number of users
+// added or updated and the events reporting them. Either all the users
+// are added, or none are. s.mu must be held.
+func (s *MemoryStore) addUsers(batch []AddUserParams, conflictMode string, now time.Time) (int64, []*userspb.UserEvent, error) {
+	// The users replaced by the batch, in order, so that the batch
+	// can be undone if any of the users can't be added.
+	var undo []memoryUndo
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undo[i].existed {
+				putMemoryUser(s.users, s.emails, undo[i].prev)
+			} else {
+				deleteMemoryUser(s.users, s.emails, undo[i].userID)
+			}
+		}
+	}
+	for _, params := range batch {
+		existing, ok := s.users[params.ID.Bytes]
+		switch {
+		case !ok:
+			if emailTaken(s.emails, params.Email, params.ID) {
+				rollback()
+				return 0, nil, status.Error(codes.AlreadyExists, "a user with the same email already exists")
+			}
+			undo = append(undo, memoryUndo{userID: params.ID.Bytes})
+			putMemoryUser(s.users, s.emails, newMemoryUser(params, now))
+		case conflictMode == ConflictModeIgnore:
+			continue
+		case conflictMode == ConflictModeUpdate:
+			if existing.DeleteTime.Valid {
+				// Deleted users are neither updated nor counted.
+				continue
+			}
+			if emailTaken(s.emails, params.Email, params.ID) {
+				rollback()
+				return 0, nil, status.Error(codes.AlreadyExists, "a user with the same email already exists")
+			}
+			undo = append(undo, memoryUndo{userID: params.ID.Bytes, prev: existing, existed: true})
+			updated := existing
+			updated.Role = params.Role
+			updated.Name = params.Name
+			updated.Labels = params.Labels
+			updated.Attributes = params.Attributes
+			updated.Email = params.Email
+			updated.Version++
+			putMemoryUser(s.users, s.emails, updated)
+		default:
+			rollback()
+			return 0, nil, status.Error(codes.AlreadyExists, "a user with the same ID already exists")
+		}
+	}
+
+	events := make([]*userspb.UserEvent, 0, len(undo))
+	for _, u := range undo {
+		user, err := userPostgresToProto(s.users[u.userID])
+		if err != nil {
+			rollback()
+			return 0, nil, err
+		}
+		eventType := userspb.UserEventType_CREATED
+		if u.existed {
+			eventType = userspb.UserEventType_UPDATED
+		}
+		events = append(events, userEvent(eventType, user, now))
+	}
+	return int64(len(undo)), events, nil
+}
+
+// ImportChunk adds the users of the chunk, after the previous chunk of
+// the import. If the chunk was already committed, its acknowledgement is
+// returned again instead.
+func (s *MemoryStore) ImportChunk(_ context.Context, req *userspb.ImportUsersRequest, reportFailures bool) (*userspb.ImportUsersResponse, error) {
+	err := validateImportChunk(req)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := chunkHash(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstRow int64
+	if req.GetChunk() > 0 {
+		prev, ok := s.chunks[memoryChunkKey{importID: req.GetImportId(), chunk: req.GetChunk() - 1}]
+		if !ok {
+			return nil, status.Errorf(codes.FailedPrecondition, "chunk %d of import %q has not been committed", req.GetChunk()-1, req.GetImportId())
+		}
+		firstRow = prev.response.GetFirstRow() + prev.response.GetRowCount()
+	}
+	key := memoryChunkKey{importID: req.GetImportId(), chunk: req.GetChunk()}
+	if chunk, ok := s.chunks[key]; ok {
+		if !bytes.Equal(chunk.hash, hash) {
+			return nil, status.Errorf(codes.InvalidArgument, "chunk %d of import %q was committed with different users", req.GetChunk(), req.GetImportId())
+		}
+		resp := proto.Clone(chunk.response).(*userspb.ImportUsersResponse)
+		resp.AlreadyCommitted = true
+		return resp, nil
+	}
+
+	reqs := req.GetUsers()
+	src := &usersSource{
+		getUser: func() (*userspb.AddUserRequest, error) {
+			if len(reqs) == 0 {
+				return nil, io.EOF
+			}
+			req := reqs[0]
+			reqs = reqs[1:]
+			return req, nil
+		},
+		newID:          s.newID,
+		reportFailures: reportFailures,
+		index:          firstRow,
+	}
+	var batch []AddUserParams
+	for src.Next() {
+		batch = append(batch, src.next)
+	}
+	err = src.Err()
+	if err != nil {
+		return nil, err
+	}
+	now := memoryNow()
+	count, events, err := s.addUsers(batch, ConflictModeError, now)
+	if err != nil {
+		return nil, err
+	}
+	resp := &userspb.ImportUsersResponse{
+		Chunk:    req.GetChunk(),
+		FirstRow: firstRow,
+		RowCount: int64(len(req.GetUsers())),
+		Count:    count,
+		Ids:      src.ids,
+		Failures: src.failures,
+	}
+	s.chunks[key] = memoryChunk{
+		hash:       hash,
+		response:   proto.Clone(resp).(*userspb.ImportUsersResponse),
+		createTime: now,
+	}
+	for _, event := range events {
+		s.watchers.emit(event)
+	}
+	return resp, nil
+}
+
+// UpdateUser updates the fields of the user selected by the update mask.
+// Soft deleted users cannot be updated.
+func (s *MemoryStore) UpdateUser(_ context.Context, req *userspb.UpdateUserRequest) (*userspb.User, error) {
+	u, err := parseUserUpdate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pgUser, ok := s.users[u.userID.Bytes]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if u.version != 0 && pgUser.Version != u.version {
+		return nil, status.Error(codes.Aborted, "etag does not match the current user, it was changed concurrently")
+	}
+	if pgUser.DeleteTime.Valid {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	pgUser = u.apply(pgUser)
+	if emailTaken(s.emails, pgUser.Email, pgUser.ID) {
+		return nil, status.Error(codes.AlreadyExists, "a user with the same email already exists")
+	}
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	putMemoryUser(s.users, s.emails, pgUser)
+	s.watchers.emit(userEvent(userspb.UserEventType_UPDATED, user, memoryNow()))
+	return user, nil
+}
+
+// DeleteUser deletes the user, if found. Users are soft deleted unless
+// force is set, in which case they are deleted permanently, even if they
+// were already soft deleted.
+func (s *MemoryStore) DeleteUser(_ context.Context, req *userspb.DeleteUserRequest) (*userspb.User, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	version, err := parseEtag(req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID.Bytes]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if version != 0 && user.Version != version {
+		return nil, status.Error(codes.Aborted, "etag does not match the current user, it was changed concurrently")
+	}
+	if req.GetForce() {
+		deleted, err := userPostgresToProto(user)
+		if err != nil {
+			return nil, err
+		}
+		deleteMemoryUser(s.users, s.emails, userID.Bytes)
+		if !user.DeleteTime.Valid {
+			// Deleting soft deleted users was already reported.
+			s.watchers.emit(userEvent(userspb.UserEventType_DELETED, deleted, memoryNow()))
+		}
+		return deleted, nil
+	}
+	if user.DeleteTime.Valid {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	now := memoryNow()
+	user.DeleteTime = sql.NullTime{Time: now, Valid: true}
+	user.Version++
+	deleted, err := userPostgresToProto(user)
+	if err != nil {
+		return nil, err
+	}
+	putMemoryUser(s.users, s.emails, user)
+	s.watchers.emit(userEvent(userspb.UserEventType_DELETED, deleted, now))
+	return deleted, nil
+}
+
+// UndeleteUser restores a soft deleted user, if it hasn't been purged.
+func (s *MemoryStore) UndeleteUser(_ context.Context, req *userspb.UndeleteUserRequest) (*userspb.User, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	version, err := parseEtag(req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pgUser, ok := s.users[userID.Bytes]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if version != 0 && pgUser.Version != version {
+		return nil, status.Error(codes.Aborted, "etag does not match the current user, it was changed concurrently")
+	}
+	if !pgUser.DeleteTime.Valid {
+		return nil, status.Error(codes.FailedPrecondition, "user is not deleted")
+	}
+	pgUser.DeleteTime = sql.NullTime{}
+	pgUser.Version++
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	putMemoryUser(s.users, s.emails, pgUser)
+	s.watchers.emit(userEvent(userspb.UserEventType_UPDATED, user, memoryNow()))
+	return user, nil
+}
+
+// GetUser gets the user, if found. Soft deleted users are returned too.
+func (s *MemoryStore) GetUser(_ context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pgUser, ok := s.users[userID.Bytes]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return userPostgresToProto(pgUser)
+}
+
+// GetUserByEmail gets the user with the email address, ignoring case,
+// if found.
+func (s *MemoryStore) GetUserByEmail(_ context.Context, req *userspb.GetUserByEmailRequest) (*userspb.User, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email must be set")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	userID, ok := s.emails[strings.ToLower(req.GetEmail())]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return userPostgresToProto(s.users[userID])
+}
+
+// BatchGetUsers gets several users at once. The results are returned in
+// the same order as the requested IDs, with IDs that could not be found
+// reported as such.
+func (s *MemoryStore) BatchGetUsers(_ context.Context, req *userspb.BatchGetUsersRequest) (*userspb.BatchGetUsersResponse, error) {
+	userIDs, err := batchGetUserIDs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	var pgUsers []User
+	for _, userID := range userIDs {
+		if pgUser, ok := s.users[userID.Bytes]; ok {
+			pgUsers = append(pgUsers, pgUser)
+		}
+	}
+	s.mu.RUnlock()
+	return batchGetUsersResponse(req, userIDs, pgUsers)
+}
+
+// QueryUsers calls fn for each user selected by the query, in order.
+func (s *MemoryStore) QueryUsers(_ context.Context, q UserQuery, fn func(*userspb.User) error) error {
+	order, err := parseOrderBy(q.Request.GetOrderBy())
+	if err != nil {
+		return err
+	}
+	match, err := listFilterFunc(q.Request)
+	if err != nil {
+		return err
+	}
+	var after *User
+	if q.After != nil {
+		cursor, err := cursorUser(q.After)
+		if err != nil {
+			return err
+		}
+		after = &cursor
+	}
+
+	s.mu.RLock()
+	var selected []User
+	for _, user := range s.users {
+		if match(user) && (after == nil || compareUsers(order, user, *after) > 0) {
+			selected = append(selected, user)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(selected, func(i, j int) bool {
+		return compareUsers(order, selected[i], selected[j]) < 0
+	})
+	if q.Limit > 0 && len(selected) > q.Limit {
+		selected = selected[:q.Limit]
+	}
+	for _, pgUser := range selected {
+		user, err := userPostgresToProto(pgUser)
+		if err != nil {
+			return err
+		}
+		err = fn(user)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountUsers counts the users subject to the request filters.
+func (s *MemoryStore) CountUsers(_ context.Context, req *userspb.ListUsersRequest) (*userspb.CountUsersResponse, error) {
+	match, err := listFilterFunc(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	resp := new(userspb.CountUsersResponse)
+	for _, user := range s.users {
+		if match(user) {
+			resp.Count++
+		}
+	}
+	return resp, nil
+}
+
+// GetUserStats computes the number of users per role and a histogram of
+// user creation times, subject to the request filters.
+func (s *MemoryStore) GetUserStats(_ context.Context, req *userspb.GetUserStatsRequest) (*userspb.GetUserStatsResponse, error) {
+	bucket, err := parseTimeBucket(req.GetBucket())
+	if err != nil {
+		return nil, err
+	}
+	query := req.GetQuery()
+	if query == nil {
+		query = new(userspb.ListUsersRequest)
+	}
+	match, err := listFilterFunc(query)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := newUserStats(bucket)
+	for _, user := range s.users {
+		if match(user) {
+			stats.add(user.Role, user.CreateTime)
+		}
+	}
+	return stats.response()
+}
+
+// WatchUserEvents calls fn for each change to users, as they happen,
+// until fn fails or the context is cancelled.
+func (s *MemoryStore) WatchUserEvents(ctx context.Context, fn func(*userspb.UserEvent) error) error {
+	return s.watchers.watch(ctx, fn)
+}
+
+// Close stops purging and drops all watchers.
+func (s *MemoryStore) Close() error {
+	s.stopPurge()
+	<-s.purgeDone
+	s.watchers.close()
+	return nil
+}
+
+// purgeLoop periodically purges the store, until the context is cancelled.
+func (s *MemoryStore) purgeLoop(ctx context.Context) {
+	defer close(s.purgeDone)
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		s.purge(time.Now())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// purge permanently deletes users soft deleted longer than the retention
+// before now, if enabled, and forgets add user requests and import chunks
+// recorded longer than requestRetention and importRetention before now,
+// like the purge of the Directory.
+func (s *MemoryStore) purge(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.purgeRetention > 0 {
+		cutoff := now.Add(-s.purgeRetention)
+		for userID, user := range s.users {
+			if user.DeleteTime.Valid && user.DeleteTime.Time.Before(cutoff) {
+				deleteMemoryUser(s.users, s.emails, userID)
+			}
+		}
+	}
+	cutoff := now.Add(-requestRetention)
+	for requestID, req := range s.requests {
+		if req.createTime.Before(cutoff) {
+			delete(s.requests, requestID)
+		}
+	}
+	cutoff = now.Add(-importRetention)
+	for key, chunk := range s.chunks {
+		if chunk.createTime.Before(cutoff) {
+			delete(s.chunks, key)
+		}
+	}
+}
+
+func newMemoryUser(params AddUserParams, now time.Time) User {
+	return User{
+		ID:         params.ID,
+		Role:       params.Role,
+		CreateTime: now,
+		Name:       params.Name,
+		Version:    1,
+		Labels:     params.Labels,
+		Attributes: params.Attributes,
+		Email:      params.Email,
+	}
+}
+
+// putMemoryUser adds or replaces the user, updating the emails.
+func putMemoryUser(users map[[16]byte]User, emails map[string][16]byte, user User) {
+	if prev, ok := users[user.ID.Bytes]; ok && prev.Email.Valid {
+		delete(emails, strings.ToLower(prev.Email.String))
+	}
+	users[user.ID.Bytes] = user
+	if user.Email.Valid {
+		emails[strings.ToLower(user.Email.String)] = user.ID.Bytes
+	}
+}
+
+// deleteMemoryUser deletes the user with the ID, if any, and its email.
+func deleteMemoryUser(users map[[16]byte]User, emails map[string][16]byte, userID [16]byte) {
+	if user, ok := users[userID]; ok && user.Email.Valid {
+		delete(emails, strings.ToLower(user.Email.String))
+	}
+	delete(users, userID)
+}
+
+// memoryUndo records the user replaced by a change, to undo it.
+type memoryUndo struct {
+	userID [16]byte
+	// prev is the user before the change, if it existed.
+	prev    User
+	existed bool
+}
+
+// emailTaken reports whether a user other than the one with the ID
+// has the email, ignoring case.
+func emailTaken(emails map[string][16]byte, email sql.NullString, userID pgtype.UUID) bool {
+	if !email.Valid {
+		return false
+	}
+	other, ok := emails[strings.ToLower(email.String)]
+	return ok && other != userID.Bytes
+}
+
+// listFilterFunc returns a predicate selecting the users matching the
+// filters of the request, like the predicates added by applyListFilters.
+func listFilterFunc(req *userspb.ListUsersRequest) (func(User) bool, error) {
+	var labelRequirements []labelRequirement
+	if req.GetLabelSelector() != "" {
+		var err error
+		labelRequirements, err = parseLabelSelector(req.GetLabelSelector())
+		if err != nil {
+			return nil, err
+		}
+	}
+	var roles map[Role]bool
+	for _, role := range req.GetRoles() {
+		pgRole, err := roleProtoToPostgres(role)
+		if err != nil {
+			return nil, err
+		}
+		if roles == nil {
+			roles = map[Role]bool{}
+		}
+		roles[pgRole] = true
+	}
+	expr, err := parseFilter(req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+	var filter func(User) sqlBool
+	if expr != nil {
+		filter, err = filterToFunc(expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	nameContains := strings.ToLower(req.GetNameContains())
+
+	return func(user User) bool {
+		if !req.GetShowDeleted() && user.DeleteTime.Valid {
+			return false
+		}
+		if labelRequirements != nil {
+			labels, err := decodeLabels(user.Labels)
+			if err != nil || !matchLabels(labels, labelRequirements) {
+				return false
+			}
+		}
+		if req.GetCreatedSince() != nil && !user.CreateTime.After(req.GetCreatedSince().AsTime().Truncate(time.Microsecond)) {
+			return false
+		}
+		if req.GetOlderThan() != nil && now.Sub(user.CreateTime) <= req.GetOlderThan().AsDuration().Truncate(time.Microsecond) {
+			return false
+		}
+		if req.GetCreatedBefore() != nil && !user.CreateTime.Before(req.GetCreatedBefore().AsTime().Truncate(time.Microsecond)) {
+			return false
+		}
+		if roles != nil && !roles[user.Role] {
+			return false
+		}
+		if !strings.HasPrefix(user.Name, req.GetNamePrefix()) {
+			return false
+		}
+		if !strings.Contains(strings.ToLower(user.Name), nameContains) {
+			return false
+		}
+		return filter == nil || filter(user) == sqlTrue
+	}, nil
+}
+
+// roleOrder is the order of the values of the role enum.
+var roleOrder = map[Role]int{
+	RoleGuest:  0,
+	RoleMember: 1,
+	RoleAdmin:  2,
+}
+
+// compareUsers compares the users by the keys of the order.
+func compareUsers(order []orderKey, a, b User) int {
+	for _, key := range order {
+		var cmp int
+		switch key.column {
+		case "name":
+			cmp = strings.Compare(a.Name, b.Name)
+		case "role":
+			cmp = roleOrder[a.Role] - roleOrder[b.Role]
+		case "create_time":
+			cmp = a.CreateTime.Compare(b.CreateTime)
+		case "id":
+			cmp = bytes.Compare(a.ID.Bytes[:], b.ID.Bytes[:])
+		}
+		if key.desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
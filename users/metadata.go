@@ -0,0 +1,101 @@
+package users
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ReturnUsersKey is the request metadata key used to request that
+	// AddUsers returns the added users.
+	ReturnUsersKey = "return-users"
+	// ValidationModeKey is the request metadata key used to select how
+	// AddUsers handles invalid users. See ValidationModeAtomic and
+	// ValidationModeReport.
+	ValidationModeKey = "validation-mode"
+
+	// ValidationModeAtomic fails the whole batch if any user is invalid.
+	ValidationModeAtomic = "atomic"
+	// ValidationModeReport adds the valid users and reports the invalid
+	// ones in the response.
+	ValidationModeReport = "report"
+
+	// ConflictModeKey is the request metadata key used to select how
+	// AddUsers handles users with the ID of an existing user. See
+	// ConflictModeError, ConflictModeIgnore and ConflictModeUpdate.
+	ConflictModeKey = "conflict-mode"
+
+	// ConflictModeError fails the whole batch.
+	ConflictModeError = "error"
+	// ConflictModeIgnore keeps the existing user.
+	ConflictModeIgnore = "ignore"
+	// ConflictModeUpdate replaces the role, name, labels, attributes and
+	// email of the existing user, unless it is deleted.
+	ConflictModeUpdate = "update"
+)
+
+// AddUsersOptions configures how a batch of users is added.
+type AddUsersOptions struct {
+	// ReturnUsers returns the added users in the response.
+	ReturnUsers bool
+	// ReportFailures adds the valid users and reports the invalid ones
+	// in the response, rather than failing the whole batch.
+	ReportFailures bool
+	// ConflictMode is one of ConflictModeError, ConflictModeIgnore and
+	// ConflictModeUpdate. Defaults to ConflictModeError.
+	ConflictMode string
+}
+
+// addUsersOptions parses the AddUsers options from the request metadata.
+func addUsersOptions(ctx context.Context) (AddUsersOptions, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var cfg AddUsersOptions
+	switch value := lastValue(md, ReturnUsersKey); value {
+	case "", "false":
+	case "true":
+		cfg.ReturnUsers = true
+	default:
+		return cfg, status.Errorf(codes.InvalidArgument, "invalid %s %q", ReturnUsersKey, value)
+	}
+	switch value := lastValue(md, ValidationModeKey); value {
+	case "", ValidationModeAtomic:
+	case ValidationModeReport:
+		cfg.ReportFailures = true
+	default:
+		return cfg, status.Errorf(codes.InvalidArgument, "invalid %s %q", ValidationModeKey, value)
+	}
+	switch value := lastValue(md, ConflictModeKey); value {
+	case "":
+		cfg.ConflictMode = ConflictModeError
+	case ConflictModeError, ConflictModeIgnore, ConflictModeUpdate:
+		cfg.ConflictMode = value
+	default:
+		return cfg, status.Errorf(codes.InvalidArgument, "invalid %s %q", ConflictModeKey, value)
+	}
+	return cfg, nil
+}
+
+// rejectAddUsersOptions fails with INVALID_ARGUMENT if any of the
+// metadata keys is set, for RPCs that don't support the options, so that
+// they aren't silently ignored.
+func rejectAddUsersOptions(ctx context.Context, rpc string, keys ...string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, key := range keys {
+		if len(md.Get(key)) > 0 {
+			return status.Errorf(codes.InvalidArgument, "%s metadata is not supported by %s", key, rpc)
+		}
+	}
+	return nil
+}
+
+// lastValue returns the last value of the metadata key, if any.
+func lastValue(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
@@ -0,0 +1,4 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX users_role_create_time_idx ON users (role, create_time);
+CREATE INDEX users_name_trgm_idx ON users USING GIN (name gin_trgm_ops);
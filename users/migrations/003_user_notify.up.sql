@@ -0,0 +1,22 @@
+CREATE FUNCTION notify_user_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('user_changes', json_build_object(
+            'op', TG_OP,
+            'time', CURRENT_TIMESTAMP,
+            'user', row_to_json(OLD)
+        )::text);
+        RETURN OLD;
+    END IF;
+    PERFORM pg_notify('user_changes', json_build_object(
+        'op', TG_OP,
+        'time', CURRENT_TIMESTAMP,
+        'user', row_to_json(NEW)
+    )::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_notify
+AFTER INSERT OR UPDATE OR DELETE ON users
+FOR EACH ROW EXECUTE PROCEDURE notify_user_change();
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_delete_time_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS delete_time;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN delete_time TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX users_delete_time_idx ON users (delete_time) WHERE delete_time IS NOT NULL;
@@ -0,0 +1,12 @@
+CREATE TABLE import_chunks (
+    import_id TEXT NOT NULL,
+    chunk BIGINT NOT NULL,
+    first_row BIGINT NOT NULL,
+    row_count BIGINT NOT NULL,
+    request_hash BYTEA NOT NULL,
+    response JSONB NOT NULL DEFAULT '{}',
+    create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (import_id, chunk)
+);
+
+CREATE INDEX import_chunks_create_time_idx ON import_chunks (create_time);
@@ -0,0 +1 @@
+DROP TABLE add_user_requests;
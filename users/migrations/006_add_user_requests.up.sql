@@ -0,0 +1,8 @@
+CREATE TABLE add_user_requests (
+    request_id TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    request_hash BYTEA NOT NULL,
+    create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX add_user_requests_create_time_idx ON add_user_requests (create_time);
@@ -0,0 +1,23 @@
+CREATE OR REPLACE FUNCTION notify_user_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('user_changes', json_build_object(
+            'op', TG_OP,
+            'time', CURRENT_TIMESTAMP,
+            'user', row_to_json(OLD)
+        )::text);
+        RETURN OLD;
+    END IF;
+    PERFORM pg_notify('user_changes', json_build_object(
+        'op', TG_OP,
+        'time', CURRENT_TIMESTAMP,
+        'user', row_to_json(NEW)
+    )::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS users_labels_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS attributes;
+ALTER TABLE users DROP COLUMN IF EXISTS labels;
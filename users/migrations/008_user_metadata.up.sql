@@ -0,0 +1,34 @@
+ALTER TABLE users ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE users ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX users_labels_idx ON users USING GIN (labels);
+
+-- Notification payloads are limited to 8000 bytes, so the labels and
+-- attributes of large users are left out, for listeners to look up.
+CREATE OR REPLACE FUNCTION notify_user_change() RETURNS trigger AS $$
+DECLARE
+    usr users;
+    payload TEXT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        usr := OLD;
+    ELSE
+        usr := NEW;
+    END IF;
+    payload := json_build_object(
+        'op', TG_OP,
+        'time', CURRENT_TIMESTAMP,
+        'user', row_to_json(usr)
+    )::text;
+    IF octet_length(payload) >= 8000 THEN
+        payload := json_build_object(
+            'op', TG_OP,
+            'time', CURRENT_TIMESTAMP,
+            'user', to_jsonb(usr) - 'labels' - 'attributes',
+            'truncated', true
+        )::text;
+    END IF;
+    PERFORM pg_notify('user_changes', payload);
+    RETURN usr;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS org_unit_users;
+
+DROP TABLE IF EXISTS org_units;
@@ -0,0 +1,22 @@
+CREATE TABLE org_units (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- Root org units have no parent. Org units with children
+    -- cannot be deleted.
+    parent_id UUID REFERENCES org_units (id),
+    name TEXT NOT NULL,
+    create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    version BIGINT NOT NULL DEFAULT 1,
+    CHECK (parent_id <> id)
+);
+
+CREATE INDEX org_units_parent_id_idx ON org_units (parent_id);
+
+-- Each user is placed in at most one org unit. Org units
+-- with users cannot be deleted.
+CREATE TABLE org_unit_users (
+    user_id UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    org_unit_id UUID NOT NULL REFERENCES org_units (id),
+    update_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX org_unit_users_org_unit_id_idx ON org_unit_users (org_unit_id);
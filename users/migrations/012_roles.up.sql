@@ -0,0 +1,27 @@
+CREATE TABLE roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    -- A JSON array of the permissions granted by the role.
+    permissions JSONB NOT NULL DEFAULT '[]',
+    -- Built-in roles mirror the values of the role enum,
+    -- and cannot be changed or deleted.
+    builtin BOOLEAN NOT NULL DEFAULT false,
+    create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    version BIGINT NOT NULL DEFAULT 1
+);
+
+INSERT INTO roles (name, description, permissions, builtin) VALUES
+    ('guest', 'Can view users.', '["users.get", "users.list"]', true),
+    ('member', 'Can view users, groups and org units.', '["users.get", "users.list", "groups.get", "groups.list", "org_units.get", "org_units.list"]', true),
+    ('admin', 'Can do anything.', '["*"]', true);
+
+-- Roles assigned to users, in addition to the built-in
+-- role of their role column. Assigned roles cannot be deleted.
+CREATE TABLE user_roles (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_name TEXT NOT NULL REFERENCES roles (name),
+    create_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_name)
+);
+
+CREATE INDEX user_roles_role_name_idx ON user_roles (role_name);
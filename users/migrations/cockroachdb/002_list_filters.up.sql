@@ -0,0 +1,3 @@
+-- CockroachDB has built-in support for trigram indexes.
+CREATE INDEX users_role_create_time_idx ON users (role, create_time);
+CREATE INDEX users_name_trgm_idx ON users USING GIN (name gin_trgm_ops);
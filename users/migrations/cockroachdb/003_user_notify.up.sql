@@ -0,0 +1,3 @@
+-- CockroachDB doesn't support LISTEN/NOTIFY, changes
+-- are watched using a changefeed instead.
+SELECT 1;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users@users_labels_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS attributes;
+ALTER TABLE users DROP COLUMN IF EXISTS labels;
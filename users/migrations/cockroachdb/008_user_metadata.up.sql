@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE users ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX users_labels_idx ON users USING GIN (labels);
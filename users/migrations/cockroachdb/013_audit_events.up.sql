@@ -0,0 +1,21 @@
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    create_time TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    actor TEXT NOT NULL DEFAULT '',
+    peer TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    -- The users affected. Not a foreign key, since events
+    -- outlive the users they refer to.
+    user_ids UUID[] NOT NULL DEFAULT '{}',
+    -- Snapshots of the user before and after the mutation,
+    -- or '{}' if there isn't one, like before adding a user.
+    before JSONB NOT NULL DEFAULT '{}',
+    after JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX audit_events_create_time_idx ON audit_events (create_time, id);
+CREATE INDEX audit_events_user_ids_idx ON audit_events USING GIN (user_ids);
+CREATE INDEX audit_events_actor_idx ON audit_events (actor, create_time);
+
+-- CockroachDB doesn't support triggers, the audit log
+-- is append-only by convention.
@@ -0,0 +1,3 @@
+DROP TABLE import_chunks;
+DROP TABLE add_user_requests;
+DROP TABLE users;
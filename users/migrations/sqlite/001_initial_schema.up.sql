@@ -0,0 +1,44 @@
+-- The users table mirrors the Postgres schema. IDs are stored as 16 byte
+-- UUIDs, times as microseconds since the Unix epoch, and roles as their
+-- position in the Postgres role enum (0 is guest, 1 member and 2 admin),
+-- so that they are compared and ordered the same way. Since SQLite's lower
+-- only folds ASCII letters, emails are unique by a key folded by the store,
+-- standing in for lower(email) in Postgres.
+CREATE TABLE users (
+    id BLOB PRIMARY KEY CHECK (length(id) = 16),
+    role INTEGER NOT NULL CHECK (role IN (0, 1, 2)),
+    create_time INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    delete_time INTEGER,
+    version INTEGER NOT NULL DEFAULT 1,
+    labels TEXT NOT NULL DEFAULT '{}',
+    attributes TEXT NOT NULL DEFAULT '{}',
+    email TEXT,
+    email_key TEXT
+);
+
+CREATE INDEX users_create_time_idx ON users (create_time, id);
+CREATE INDEX users_role_create_time_idx ON users (role, create_time);
+CREATE UNIQUE INDEX users_email_idx ON users (email_key);
+
+CREATE TABLE add_user_requests (
+    request_id TEXT PRIMARY KEY,
+    user_id BLOB NOT NULL,
+    request_hash BLOB NOT NULL,
+    create_time INTEGER NOT NULL
+);
+
+CREATE INDEX add_user_requests_create_time_idx ON add_user_requests (create_time);
+
+CREATE TABLE import_chunks (
+    import_id TEXT NOT NULL,
+    chunk INTEGER NOT NULL,
+    first_row INTEGER NOT NULL,
+    row_count INTEGER NOT NULL,
+    request_hash BLOB NOT NULL,
+    response TEXT NOT NULL,
+    create_time INTEGER NOT NULL,
+    PRIMARY KEY (import_id, chunk)
+);
+
+CREATE INDEX import_chunks_create_time_idx ON import_chunks (create_time);
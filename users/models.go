@@ -5,7 +5,9 @@
 package users
 
 import (
+	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -55,9 +57,120 @@ func (ns NullRole) Value() (driver.Value, error) {
 	return string(ns.Role), nil
 }
 
+type AddUserRequest struct {
+	RequestID   string
+	UserID      pgtype.UUID
+	RequestHash []byte
+	CreateTime  time.Time
+}
+
+type AuditEvent struct {
+	ID         pgtype.UUID
+	CreateTime time.Time
+	Actor      string
+	Peer       string
+	Action     string
+	UserIds    []pgtype.UUID
+	Before     json.RawMessage
+	After      json.RawMessage
+}
+
+type Group struct {
+	ID          pgtype.UUID
+	Name        string
+	Description string
+	CreateTime  time.Time
+	Version     int64
+}
+
+type GroupMember struct {
+	GroupID    pgtype.UUID
+	UserID     pgtype.UUID
+	CreateTime time.Time
+}
+
+type ImportChunk struct {
+	ImportID    string
+	Chunk       int64
+	FirstRow    int64
+	RowCount    int64
+	RequestHash []byte
+	Response    json.RawMessage
+	CreateTime  time.Time
+}
+
+type OrgUnit struct {
+	ID         pgtype.UUID
+	ParentID   pgtype.UUID
+	Name       string
+	CreateTime time.Time
+	Version    int64
+}
+
+type OrgUnitUser struct {
+	UserID     pgtype.UUID
+	OrgUnitID  pgtype.UUID
+	UpdateTime time.Time
+}
+
+type Outbox struct {
+	ID              int64
+	CreateTime      time.Time
+	EventType       string
+	UserID          pgtype.UUID
+	Payload         json.RawMessage
+	Attempts        int32
+	NextAttemptTime time.Time
+	LastError       string
+	PublishTime     sql.NullTime
+}
+
+type RoleDefinition struct {
+	Name        string
+	Description string
+	Permissions json.RawMessage
+	Builtin     bool
+	CreateTime  time.Time
+	Version     int64
+}
+
 type User struct {
 	ID         pgtype.UUID
 	Role       Role
 	CreateTime time.Time
 	Name       string
+	DeleteTime sql.NullTime
+	Version    int64
+	Labels     json.RawMessage
+	Attributes json.RawMessage
+	Email      sql.NullString
+}
+
+type UserRole struct {
+	UserID     pgtype.UUID
+	RoleName   string
+	CreateTime time.Time
+}
+
+type Webhook struct {
+	ID         pgtype.UUID
+	Url        string
+	EventTypes json.RawMessage
+	Secret     string
+	CreateTime time.Time
+}
+
+type WebhookDelivery struct {
+	ID              pgtype.UUID
+	WebhookID       pgtype.UUID
+	EventID         int64
+	EventType       string
+	Payload         json.RawMessage
+	State           string
+	Attempts        int32
+	NextAttemptTime time.Time
+	LastStatusCode  int32
+	LastError       string
+	CreateTime      time.Time
+	UpdateTime      time.Time
 }
@@ -0,0 +1,134 @@
+package users
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// orderColumns is the allow-list of columns users can be ordered by.
+var orderColumns = map[string]bool{
+	"name":        true,
+	"role":        true,
+	"create_time": true,
+	"id":          true,
+}
+
+// orderKey is a column to order by, in either direction.
+type orderKey struct {
+	column string
+	desc   bool
+}
+
+func (k orderKey) String() string {
+	if k.desc {
+		return k.column + " DESC"
+	}
+	return k.column + " ASC"
+}
+
+// defaultOrder is the order used when none is specified.
+var defaultOrder = []orderKey{
+	{column: "create_time"},
+	{column: "id"},
+}
+
+// parseOrderBy parses an order in the format described in
+// https://google.aip.dev/132#ordering, e.g. "name desc, create_time".
+// The id column is always added as a final tie-breaker, unless
+// already present, so that the order is stable and can be paginated.
+func parseOrderBy(orderBy string) ([]orderKey, error) {
+	if strings.TrimSpace(orderBy) == "" {
+		return defaultOrder, nil
+	}
+	var keys []orderKey
+	seen := map[string]bool{}
+	for _, field := range strings.Split(orderBy, ",") {
+		parts := strings.Fields(field)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid order by %q", strings.TrimSpace(field))
+		}
+		key := orderKey{column: parts[0]}
+		if !orderColumns[key.column] {
+			return nil, status.Errorf(codes.InvalidArgument, "cannot order by unknown field %q", key.column)
+		}
+		if seen[key.column] {
+			return nil, status.Errorf(codes.InvalidArgument, "field %q is ordered by more than once", key.column)
+		}
+		seen[key.column] = true
+		if len(parts) == 2 {
+			switch strings.ToLower(parts[1]) {
+			case "asc":
+			case "desc":
+				key.desc = true
+			default:
+				return nil, status.Errorf(codes.InvalidArgument, "invalid order direction %q", parts[1])
+			}
+		}
+		keys = append(keys, key)
+		if key.column == "id" {
+			// IDs are unique, so any further keys would be redundant.
+			return keys, nil
+		}
+	}
+	return append(keys, orderKey{column: "id"}), nil
+}
+
+func orderByClauses(keys []orderKey) []string {
+	clauses := make([]string, 0, len(keys))
+	for _, key := range keys {
+		clauses = append(clauses, key.String())
+	}
+	return clauses
+}
+
+// afterCursor returns a predicate selecting the rows that come after
+// the row with the values provided, in the order of the keys. values
+// must hold a value for each key.
+func afterCursor(keys []orderKey, values map[string]interface{}) squirrel.Sqlizer {
+	sameDirection := true
+	for _, key := range keys[1:] {
+		if key.desc != keys[0].desc {
+			sameDirection = false
+		}
+	}
+	if sameDirection {
+		// Use a row comparison, which can make use of indexes.
+		columns := make([]string, 0, len(keys))
+		placeholders := make([]string, 0, len(keys))
+		args := make([]interface{}, 0, len(keys))
+		for _, key := range keys {
+			columns = append(columns, key.column)
+			placeholders = append(placeholders, "?")
+			args = append(args, values[key.column])
+		}
+		op := ">"
+		if keys[0].desc {
+			op = "<"
+		}
+		return squirrel.Expr(
+			fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), op, strings.Join(placeholders, ", ")),
+			args...,
+		)
+	}
+
+	// With mixed directions, expand the comparison to
+	// (k1 > v1) OR (k1 = v1 AND k2 < v2) OR ...
+	var or squirrel.Or
+	for i, key := range keys {
+		var and squirrel.And
+		for _, prev := range keys[:i] {
+			and = append(and, squirrel.Eq{prev.column: values[prev.column]})
+		}
+		if key.desc {
+			and = append(and, squirrel.Lt{key.column: values[key.column]})
+		} else {
+			and = append(and, squirrel.Gt{key.column: values[key.column]})
+		}
+		or = append(or, and)
+	}
+	return or
+}
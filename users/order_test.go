@@ -0,0 +1,107 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseOrderBy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		orderBy string
+		want    []orderKey
+		wantErr bool
+	}{
+		{
+			orderBy: "",
+			want:    defaultOrder,
+		},
+		{
+			orderBy: "name desc, create_time",
+			want: []orderKey{
+				{column: "name", desc: true},
+				{column: "create_time"},
+				{column: "id"},
+			},
+		},
+		{
+			orderBy: "role ASC,id DESC",
+			want: []orderKey{
+				{column: "role"},
+				{column: "id", desc: true},
+			},
+		},
+		{
+			orderBy: "password",
+			wantErr: true,
+		},
+		{
+			orderBy: "name sideways",
+			wantErr: true,
+		},
+		{
+			orderBy: "name, name desc",
+			wantErr: true,
+		},
+		{
+			orderBy: "name,",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.orderBy, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseOrderBy(tt.orderBy)
+			if tt.wantErr {
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Got error %v, wanted InvalidArgument", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to parse order: %s", err)
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(orderKey{})); diff != "" {
+				t.Errorf("Order was not as expected:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAfterCursor(t *testing.T) {
+	t.Parallel()
+
+	values := map[string]interface{}{
+		"name": "Foo",
+		"role": RoleAdmin,
+		"id":   "id",
+	}
+
+	sql, args, err := afterCursor([]orderKey{{column: "name"}, {column: "id"}}, values).ToSql()
+	if err != nil {
+		t.Fatalf("Failed to build SQL: %s", err)
+	}
+	if want := "(name, id) > (?, ?)"; sql != want {
+		t.Errorf("Got SQL %q, wanted %q", sql, want)
+	}
+	if diff := cmp.Diff([]interface{}{"Foo", "id"}, args); diff != "" {
+		t.Errorf("Args were not as expected:\n%s", diff)
+	}
+
+	sql, args, err = afterCursor([]orderKey{{column: "role", desc: true}, {column: "name"}, {column: "id"}}, values).ToSql()
+	if err != nil {
+		t.Fatalf("Failed to build SQL: %s", err)
+	}
+	if want := "((role < ?) OR (role = ? AND name > ?) OR (role = ? AND name = ? AND id > ?))"; sql != want {
+		t.Errorf("Got SQL %q, wanted %q", sql, want)
+	}
+	if diff := cmp.Diff([]interface{}{RoleAdmin, RoleAdmin, "Foo", RoleAdmin, "Foo", "id"}, args); diff != "" {
+		t.Errorf("Args were not as expected:\n%s", diff)
+	}
+}
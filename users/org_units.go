@@ -0,0 +1,519 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgtype"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+// orgUnitColumns are the columns of the org_units table, in the order
+// expected by scanOrgUnit.
+var orgUnitColumns = []string{
+	"id",
+	"parent_id",
+	"name",
+	"create_time",
+	"version",
+}
+
+// scanOrgUnit scans a row selected with orgUnitColumns.
+func scanOrgUnit(row rowScanner) (OrgUnit, error) {
+	var pgOrgUnit OrgUnit
+	err := row.Scan(
+		&pgOrgUnit.ID,
+		&pgOrgUnit.ParentID,
+		&pgOrgUnit.Name,
+		&pgOrgUnit.CreateTime,
+		&pgOrgUnit.Version,
+	)
+	return pgOrgUnit, err
+}
+
+func orgUnitPostgresToProto(pgOrgUnit OrgUnit) (*userspb.OrgUnit, error) {
+	var orgUnitID, parentID string
+	err := pgOrgUnit.ID.AssignTo(&orgUnitID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	if pgOrgUnit.ParentID.Status == pgtype.Present {
+		err = pgOrgUnit.ParentID.AssignTo(&parentID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+		}
+	}
+	return &userspb.OrgUnit{
+		Id:         orgUnitID,
+		ParentId:   parentID,
+		Name:       pgOrgUnit.Name,
+		CreateTime: timestamppb.New(pgOrgUnit.CreateTime),
+		Etag:       versionEtag(pgOrgUnit.Version),
+	}, nil
+}
+
+func userOrgUnitPostgresToProto(pgUserOrgUnit OrgUnitUser) (*userspb.UserOrgUnit, error) {
+	var userID, orgUnitID string
+	err := pgUserOrgUnit.UserID.AssignTo(&userID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	err = pgUserOrgUnit.OrgUnitID.AssignTo(&orgUnitID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	return &userspb.UserOrgUnit{
+		UserId:     userID,
+		OrgUnitId:  orgUnitID,
+		UpdateTime: timestamppb.New(pgUserOrgUnit.UpdateTime),
+	}, nil
+}
+
+// parseParentID parses the ID of a parent org unit. Empty IDs
+// are parsed as NULL, for root org units.
+func parseParentID(id string) (pgtype.UUID, error) {
+	var parentID pgtype.UUID
+	if id == "" {
+		parentID.Status = pgtype.Null
+		return parentID, nil
+	}
+	err := parentID.Set(id)
+	if err != nil {
+		return parentID, status.Error(codes.InvalidArgument, "invalid parent UUID provided")
+	}
+	return parentID, nil
+}
+
+// validateOrgUnitName validates the name of an org unit.
+func validateOrgUnitName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return status.Error(codes.InvalidArgument, "org unit name must be set")
+	}
+	return nil
+}
+
+// CreateOrgUnit creates an org unit.
+func (d Directory) CreateOrgUnit(ctx context.Context, req *userspb.CreateOrgUnitRequest) (*userspb.OrgUnit, error) {
+	err := validateOrgUnitName(req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	parentID, err := parseParentID(req.GetParentId())
+	if err != nil {
+		return nil, err
+	}
+	orgUnitID, err := d.newID()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error generating ID: %s", err.Error())
+	}
+	pgOrgUnit, err := d.querier.CreateOrgUnit(ctx, CreateOrgUnitParams{
+		ID:       orgUnitID,
+		ParentID: parentID,
+		Name:     req.GetName(),
+	})
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, status.Error(codes.NotFound, "parent org unit not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error creating org unit: %s", err.Error())
+	}
+	return orgUnitPostgresToProto(pgOrgUnit)
+}
+
+// GetOrgUnit gets the org unit, if found.
+func (d Directory) GetOrgUnit(ctx context.Context, req *userspb.GetOrgUnitRequest) (*userspb.OrgUnit, error) {
+	var orgUnitID pgtype.UUID
+	err := orgUnitID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	pgOrgUnit, err := lookupOrgUnit(ctx, d.querier, orgUnitID)
+	if err != nil {
+		return nil, err
+	}
+	return orgUnitPostgresToProto(pgOrgUnit)
+}
+
+func lookupOrgUnit(ctx context.Context, querier Querier, orgUnitID pgtype.UUID) (OrgUnit, error) {
+	pgOrgUnit, err := querier.GetOrgUnit(ctx, orgUnitID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return OrgUnit{}, status.Error(codes.NotFound, "org unit not found")
+		}
+		return OrgUnit{}, status.Errorf(codes.Internal, "unexpected error getting org unit: %s", err.Error())
+	}
+	return pgOrgUnit, nil
+}
+
+// UpdateOrgUnit updates the fields of the org unit selected by the update
+// mask. Moves are checked for cycles and applied in a serializable
+// transaction, so that concurrent moves cannot form a cycle either.
+func (d Directory) UpdateOrgUnit(ctx context.Context, req *userspb.UpdateOrgUnitRequest) (_ *userspb.OrgUnit, retErr error) {
+	var orgUnitID pgtype.UUID
+	err := orgUnitID.Set(req.GetOrgUnit().GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		if req.GetOrgUnit().GetName() != "" {
+			paths = append(paths, "name")
+		}
+		if req.GetOrgUnit().GetParentId() != "" {
+			paths = append(paths, "parent_id")
+		}
+	}
+
+	var updateName, updateParent bool
+	for _, path := range paths {
+		switch path {
+		case "*":
+			updateName, updateParent = true, true
+		case "name":
+			updateName = true
+		case "parent_id":
+			updateParent = true
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported update mask path %q", path)
+		}
+	}
+	if !updateName && !updateParent {
+		return nil, status.Error(codes.InvalidArgument, "no fields to update")
+	}
+
+	version, err := parseEtag(req.GetOrgUnit().GetEtag())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error starting transaction: %s", err.Error())
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+	querier := New(tx)
+
+	q := d.sb.RunWith(tx).Update(
+		"org_units",
+	).Set(
+		"version", squirrel.Expr("version + 1"),
+	).Where(
+		squirrel.Eq{"id": orgUnitID},
+	).Suffix(
+		"RETURNING " + strings.Join(orgUnitColumns, ", "),
+	)
+	if version != 0 {
+		q = q.Where(squirrel.Eq{"version": version})
+	}
+	if updateName {
+		err := validateOrgUnitName(req.GetOrgUnit().GetName())
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("name", req.GetOrgUnit().GetName())
+	}
+	if updateParent {
+		parentID, err := parseParentID(req.GetOrgUnit().GetParentId())
+		if err != nil {
+			return nil, err
+		}
+		if parentID.Status == pgtype.Present {
+			// The org unit must not be the new parent,
+			// or one of its ancestors.
+			cycle, err := querier.IsOrgUnitAncestor(ctx, IsOrgUnitAncestorParams{
+				ID:         parentID,
+				AncestorID: orgUnitID,
+			})
+			if err != nil {
+				return nil, orgUnitTxError("checking ancestors", err)
+			}
+			if cycle {
+				return nil, status.Error(codes.FailedPrecondition, "cannot move an org unit under itself or its descendants")
+			}
+		}
+		q = q.Set("parent_id", parentID)
+	}
+
+	pgOrgUnit, err := scanOrgUnit(q.QueryRowContext(ctx))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, orgUnitNotFound(ctx, querier, orgUnitID, version)
+		}
+		if isForeignKeyViolation(err) {
+			return nil, status.Error(codes.NotFound, "parent org unit not found")
+		}
+		return nil, orgUnitTxError("updating org unit", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, orgUnitTxError("committing transaction", err)
+	}
+	return orgUnitPostgresToProto(pgOrgUnit)
+}
+
+// orgUnitTxError returns ABORTED for serialization failures, which
+// can be retried, and INTERNAL for any other errors.
+func orgUnitTxError(doing string, err error) error {
+	if isSerializationFailure(err) {
+		return status.Error(codes.Aborted, "org units were changed concurrently")
+	}
+	return status.Errorf(codes.Internal, "unexpected error %s: %s", doing, err.Error())
+}
+
+// DeleteOrgUnit deletes the org unit, if found and empty.
+func (d Directory) DeleteOrgUnit(ctx context.Context, req *userspb.DeleteOrgUnitRequest) (*userspb.OrgUnit, error) {
+	var orgUnitID pgtype.UUID
+	err := orgUnitID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	version, err := parseEtag(req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+	pgOrgUnit, err := d.querier.DeleteOrgUnit(ctx, DeleteOrgUnitParams{
+		ID:      orgUnitID,
+		Version: version,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, orgUnitNotFound(ctx, d.querier, orgUnitID, version)
+		}
+		if isForeignKeyViolation(err) {
+			return nil, status.Error(codes.FailedPrecondition, "org unit has child org units or users")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error deleting org unit: %s", err.Error())
+	}
+	return orgUnitPostgresToProto(pgOrgUnit)
+}
+
+// orgUnitNotFound explains why a mutation of the org unit matched no rows,
+// returning ABORTED if the org unit exists with a version other than the
+// one provided, and NOT_FOUND otherwise.
+func orgUnitNotFound(ctx context.Context, querier Querier, orgUnitID pgtype.UUID, version int64) error {
+	if version == 0 {
+		return status.Error(codes.NotFound, "org unit not found")
+	}
+	pgOrgUnit, err := lookupOrgUnit(ctx, querier, orgUnitID)
+	if err != nil {
+		return err
+	}
+	if pgOrgUnit.Version != version {
+		return status.Error(codes.Aborted, "etag does not match the current org unit, it was changed concurrently")
+	}
+	return status.Error(codes.NotFound, "org unit not found")
+}
+
+// ListOrgUnits lists a page of the children of an org unit,
+// or of the root org units.
+func (d Directory) ListOrgUnits(ctx context.Context, req *userspb.ListOrgUnitsRequest) (*userspb.ListOrgUnitsResponse, error) {
+	parentID, err := parseParentID(req.GetParentId())
+	if err != nil {
+		return nil, err
+	}
+	q := d.sb.Select(
+		orgUnitColumns...,
+	).From(
+		"org_units",
+	)
+	if parentID.Status == pgtype.Present {
+		_, err = lookupOrgUnit(ctx, d.querier, parentID)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where(squirrel.Eq{"parent_id": parentID})
+	} else {
+		q = q.Where(squirrel.Eq{"parent_id": nil})
+	}
+	pgOrgUnits, next, err := queryPage(ctx, d, q, req, req.GetPageSize(), req.GetPageToken(), scanOrgUnit, func(pgOrgUnit OrgUnit) pageToken {
+		return pageToken{
+			CreateTime: pgOrgUnit.CreateTime,
+			ID:         pgOrgUnit.ID.Bytes[:],
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &userspb.ListOrgUnitsResponse{
+		NextPageToken: next,
+	}
+	for _, pgOrgUnit := range pgOrgUnits {
+		orgUnit, err := orgUnitPostgresToProto(pgOrgUnit)
+		if err != nil {
+			return nil, err
+		}
+		resp.OrgUnits = append(resp.OrgUnits, orgUnit)
+	}
+	return resp, nil
+}
+
+// SetUserOrgUnit places the user in an org unit, or removes the
+// user from its org unit.
+func (d Directory) SetUserOrgUnit(ctx context.Context, req *userspb.SetUserOrgUnitRequest) (*userspb.UserOrgUnit, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user UUID provided")
+	}
+	if req.GetOrgUnitId() == "" {
+		_, err = d.querier.RemoveUserOrgUnit(ctx, userID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unexpected error removing user from org unit: %s", err.Error())
+		}
+		_, err = d.getUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		return &userspb.UserOrgUnit{
+			UserId: req.GetUserId(),
+		}, nil
+	}
+	var orgUnitID pgtype.UUID
+	err = orgUnitID.Set(req.GetOrgUnitId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org unit UUID provided")
+	}
+	pgUserOrgUnit, err := d.querier.SetUserOrgUnit(ctx, SetUserOrgUnitParams{
+		UserID:    userID,
+		OrgUnitID: orgUnitID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Soft deleted users cannot be placed.
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		if isForeignKeyViolation(err) {
+			return nil, status.Error(codes.NotFound, "org unit not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error placing user: %s", err.Error())
+	}
+	return userOrgUnitPostgresToProto(pgUserOrgUnit)
+}
+
+// GetUserOrgUnit gets the org unit the user is placed in, if any.
+func (d Directory) GetUserOrgUnit(ctx context.Context, req *userspb.GetUserOrgUnitRequest) (*userspb.UserOrgUnit, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	pgUserOrgUnit, err := d.querier.GetUserOrgUnit(ctx, userID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Errorf(codes.Internal, "unexpected error getting user org unit: %s", err.Error())
+		}
+		_, err = d.getUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		return &userspb.UserOrgUnit{
+			UserId: req.GetUserId(),
+		}, nil
+	}
+	return userOrgUnitPostgresToProto(pgUserOrgUnit)
+}
+
+// subtreeCTE selects the IDs of an org unit and its descendants
+// in the subtree table, by walking down the tree.
+const subtreeCTE = `WITH RECURSIVE subtree AS (
+  SELECT org_units.id FROM org_units
+  WHERE org_units.id = ?
+  UNION ALL
+  SELECT org_units.id FROM org_units
+  JOIN subtree ON org_units.parent_id = subtree.id
+)`
+
+// ListUsersUnder lists a page of the users placed in the org unit,
+// or, if recursive, in the org unit or any of its descendants.
+func (d Directory) ListUsersUnder(ctx context.Context, req *userspb.ListUsersUnderRequest) (*userspb.ListUsersUnderResponse, error) {
+	var orgUnitID pgtype.UUID
+	err := orgUnitID.Set(req.GetOrgUnitId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	_, err = lookupOrgUnit(ctx, d.querier, orgUnitID)
+	if err != nil {
+		return nil, err
+	}
+	q := d.sb.Select(
+		userColumns...,
+	).From(
+		"users",
+	).Where(
+		squirrel.Eq{"delete_time": nil},
+	)
+	if req.GetRecursive() {
+		q = q.Prefix(
+			subtreeCTE, orgUnitID,
+		).Where(
+			"id IN (SELECT user_id FROM org_unit_users WHERE org_unit_id IN (SELECT id FROM subtree))",
+		)
+	} else {
+		q = q.Where(
+			squirrel.Expr("id IN (SELECT user_id FROM org_unit_users WHERE org_unit_id = ?)", orgUnitID),
+		)
+	}
+	users, next, err := d.listUsersPage(ctx, q, req, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	return &userspb.ListUsersUnderResponse{
+		Users:         users,
+		NextPageToken: next,
+	}, nil
+}
+
+// IsUserUnder returns whether the user is placed in the org unit or any
+// of its descendants, by walking up the tree from the org unit of the user.
+func (d Directory) IsUserUnder(ctx context.Context, req *userspb.IsUserUnderRequest) (*userspb.IsUserUnderResponse, error) {
+	var userID, orgUnitID pgtype.UUID
+	err := userID.Set(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user UUID provided")
+	}
+	err = orgUnitID.Set(req.GetOrgUnitId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org unit UUID provided")
+	}
+	_, err = lookupOrgUnit(ctx, d.querier, orgUnitID)
+	if err != nil {
+		return nil, err
+	}
+	pgUser, err := d.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if pgUser.DeleteTime.Valid {
+		return &userspb.IsUserUnderResponse{Under: false}, nil
+	}
+	pgUserOrgUnit, err := d.querier.GetUserOrgUnit(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &userspb.IsUserUnderResponse{Under: false}, nil
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error getting user org unit: %s", err.Error())
+	}
+	under, err := d.querier.IsOrgUnitAncestor(ctx, IsOrgUnitAncestorParams{
+		ID:         pgUserOrgUnit.OrgUnitID,
+		AncestorID: orgUnitID,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error checking ancestors: %s", err.Error())
+	}
+	return &userspb.IsUserUnderResponse{Under: under}, nil
+}
@@ -0,0 +1,264 @@
+package users_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+	"github.com/johanbrandhorst/grpc-postgres/users"
+)
+
+func TestOrgUnits(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	createOrgUnit := func(t *testing.T, parentID, name string) *userspb.OrgUnit {
+		t.Helper()
+		orgUnit, err := directory.CreateOrgUnit(ctx, &userspb.CreateOrgUnitRequest{
+			ParentId: parentID,
+			Name:     name,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create org unit: %s", err)
+		}
+		return orgUnit
+	}
+	addUser := func(t *testing.T, orgUnitID, name string) *userspb.User {
+		t.Helper()
+		user, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_MEMBER,
+			Name: name,
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		_, err = directory.SetUserOrgUnit(ctx, &userspb.SetUserOrgUnitRequest{
+			UserId:    user.GetId(),
+			OrgUnitId: orgUnitID,
+		})
+		if err != nil {
+			t.Fatalf("Failed to place user: %s", err)
+		}
+		return user
+	}
+	isUserUnder := func(t *testing.T, userID, orgUnitID string) bool {
+		t.Helper()
+		resp, err := directory.IsUserUnder(ctx, &userspb.IsUserUnderRequest{
+			UserId:    userID,
+			OrgUnitId: orgUnitID,
+		})
+		if err != nil {
+			t.Fatalf("Failed to check whether user is under org unit: %s", err)
+		}
+		return resp.GetUnder()
+	}
+	listUsersUnder := func(t *testing.T, orgUnitID string, recursive bool) []*userspb.User {
+		t.Helper()
+		var users []*userspb.User
+		req := &userspb.ListUsersUnderRequest{
+			OrgUnitId: orgUnitID,
+			Recursive: recursive,
+			PageSize:  30,
+		}
+		for {
+			resp, err := directory.ListUsersUnder(ctx, req)
+			if err != nil {
+				t.Fatalf("Failed to list users under org unit: %s", err)
+			}
+			users = append(users, resp.GetUsers()...)
+			if resp.GetNextPageToken() == "" {
+				return users
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+	}
+
+	t.Run("Deep hierarchy", func(t *testing.T) {
+		t.Parallel()
+
+		const depth = 100
+		root := createOrgUnit(t, "", "Deep root")
+		chain := []*userspb.OrgUnit{root}
+		for i := 1; i < depth; i++ {
+			chain = append(chain, createOrgUnit(t, chain[i-1].GetId(), fmt.Sprintf("Deep %d", i)))
+		}
+		leaf := chain[depth-1]
+		user := addUser(t, leaf.GetId(), "Deep user")
+
+		if !isUserUnder(t, user.GetId(), root.GetId()) {
+			t.Error("Expected user to be under the root")
+		}
+		if !isUserUnder(t, user.GetId(), leaf.GetId()) {
+			t.Error("Expected user to be under its own org unit")
+		}
+		other := createOrgUnit(t, "", "Deep other")
+		if isUserUnder(t, user.GetId(), other.GetId()) {
+			t.Error("Expected user not to be under an unrelated org unit")
+		}
+
+		if diff := cmp.Diff([]*userspb.User{user}, listUsersUnder(t, root.GetId(), true), protocmp.Transform()); diff != "" {
+			t.Errorf("Users under root were not as expected:\n%s", diff)
+		}
+		if got := listUsersUnder(t, root.GetId(), false); len(got) != 0 {
+			t.Errorf("Expected no users directly in root, got %d", len(got))
+		}
+
+		// Moving the root under its descendants would form a cycle.
+		for _, parent := range []*userspb.OrgUnit{root, chain[1], leaf} {
+			_, err := directory.UpdateOrgUnit(ctx, &userspb.UpdateOrgUnitRequest{
+				OrgUnit: &userspb.OrgUnit{
+					Id:       root.GetId(),
+					ParentId: parent.GetId(),
+				},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"parent_id"}},
+			})
+			if status.Code(err) != codes.FailedPrecondition {
+				t.Errorf("Expected FailedPrecondition moving root under %q, got %v", parent.GetName(), err)
+			}
+		}
+
+		// Moving the middle of the chain out detaches the user from the root.
+		moved, err := directory.UpdateOrgUnit(ctx, &userspb.UpdateOrgUnitRequest{
+			OrgUnit: &userspb.OrgUnit{
+				Id:       chain[depth/2].GetId(),
+				ParentId: other.GetId(),
+				Etag:     chain[depth/2].GetEtag(),
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"parent_id"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to move org unit: %s", err)
+		}
+		if moved.GetParentId() != other.GetId() {
+			t.Fatalf("Org unit was not moved: %v", moved)
+		}
+		if isUserUnder(t, user.GetId(), root.GetId()) {
+			t.Error("Expected user not to be under the root after moving")
+		}
+		if !isUserUnder(t, user.GetId(), other.GetId()) {
+			t.Error("Expected user to be under the new parent after moving")
+		}
+	})
+	t.Run("Wide hierarchy", func(t *testing.T) {
+		t.Parallel()
+
+		const width = 50
+		root := createOrgUnit(t, "", "Wide root")
+		var children []*userspb.OrgUnit
+		var want []*userspb.User
+		for i := 0; i < width; i++ {
+			child := createOrgUnit(t, root.GetId(), fmt.Sprintf("Wide %d", i))
+			children = append(children, child)
+			want = append(want, addUser(t, child.GetId(), fmt.Sprintf("Wide user %d", i)))
+		}
+		direct := addUser(t, root.GetId(), "Wide direct user")
+
+		got := listUsersUnder(t, root.GetId(), true)
+		if diff := cmp.Diff(append(want, direct), got, protocmp.Transform()); diff != "" {
+			t.Errorf("Users under root were not as expected:\n%s", diff)
+		}
+		got = listUsersUnder(t, root.GetId(), false)
+		if diff := cmp.Diff([]*userspb.User{direct}, got, protocmp.Transform()); diff != "" {
+			t.Errorf("Users directly in root were not as expected:\n%s", diff)
+		}
+		if isUserUnder(t, want[0].GetId(), children[1].GetId()) {
+			t.Error("Expected user not to be under a sibling org unit")
+		}
+
+		var listed []*userspb.OrgUnit
+		req := &userspb.ListOrgUnitsRequest{
+			ParentId: root.GetId(),
+			PageSize: 20,
+		}
+		for {
+			resp, err := directory.ListOrgUnits(ctx, req)
+			if err != nil {
+				t.Fatalf("Failed to list org units: %s", err)
+			}
+			listed = append(listed, resp.GetOrgUnits()...)
+			if resp.GetNextPageToken() == "" {
+				break
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+		if diff := cmp.Diff(children, listed, protocmp.Transform()); diff != "" {
+			t.Errorf("Children were not as expected:\n%s", diff)
+		}
+
+		// Soft deleted users are not under any org unit.
+		_, err := directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id: want[0].GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
+		if isUserUnder(t, want[0].GetId(), root.GetId()) {
+			t.Error("Expected a deleted user not to be under the root")
+		}
+		if got := listUsersUnder(t, children[0].GetId(), false); len(got) != 0 {
+			t.Errorf("Expected no users listed for the deleted user's org unit, got %d", len(got))
+		}
+	})
+	t.Run("Deleting org units", func(t *testing.T) {
+		t.Parallel()
+
+		root := createOrgUnit(t, "", "Delete root")
+		child := createOrgUnit(t, root.GetId(), "Delete child")
+		user := addUser(t, child.GetId(), "Delete user")
+
+		_, err := directory.DeleteOrgUnit(ctx, &userspb.DeleteOrgUnitRequest{
+			Id: root.GetId(),
+		})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("Expected FailedPrecondition deleting an org unit with children, got %v", err)
+		}
+		_, err = directory.DeleteOrgUnit(ctx, &userspb.DeleteOrgUnitRequest{
+			Id: child.GetId(),
+		})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("Expected FailedPrecondition deleting an org unit with users, got %v", err)
+		}
+
+		placement, err := directory.SetUserOrgUnit(ctx, &userspb.SetUserOrgUnitRequest{
+			UserId: user.GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to remove user from org unit: %s", err)
+		}
+		if placement.GetOrgUnitId() != "" {
+			t.Fatalf("Expected user not to be placed, got %v", placement)
+		}
+		for _, orgUnit := range []*userspb.OrgUnit{child, root} {
+			_, err = directory.DeleteOrgUnit(ctx, &userspb.DeleteOrgUnitRequest{
+				Id:   orgUnit.GetId(),
+				Etag: orgUnit.GetEtag(),
+			})
+			if err != nil {
+				t.Fatalf("Failed to delete org unit: %s", err)
+			}
+		}
+	})
+}
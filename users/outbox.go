@@ -0,0 +1,309 @@
+package users
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+// The types of the events written to the outbox.
+const (
+	EventUserCreated   = "user.created"
+	EventUserUpdated   = "user.updated"
+	EventUserDeleted   = "user.deleted"
+	EventUserUndeleted = "user.undeleted"
+	// EventUserPurged is written when a soft deleted user is
+	// permanently deleted, once its retention has passed.
+	EventUserPurged = "user.purged"
+)
+
+const (
+	relayInterval  = time.Second
+	relayBatchSize = 100
+	// relayLockID is the key of the advisory lock held by
+	// the relay publishing the outbox events.
+	relayLockID = 0x757365727352656c // "usersRel"
+	// outboxRetention is how long published events are kept.
+	outboxRetention = 7 * 24 * time.Hour
+
+	minRetryBackoff = time.Second
+	maxRetryBackoff = 15 * time.Minute
+)
+
+// OutboxEvent is a change to a user, published by the relay.
+type OutboxEvent struct {
+	// ID identifies the event. Events may be published more than
+	// once, so consumers should use it to detect duplicates.
+	ID         int64     `json:"id"`
+	Type       string    `json:"type"`
+	UserID     string    `json:"user_id"`
+	CreateTime time.Time `json:"create_time"`
+	// User is the user after the change, or before it if it was
+	// permanently deleted or purged, encoded with protojson.
+	User json.RawMessage `json:"user"`
+}
+
+// Publisher publishes outbox events to other systems. Events are
+// published in the order they were written, except that a failed event
+// is retried after a backoff, while the events after it are published
+// in the meantime. Events may also be published again if the relay
+// stops before recording the success, so delivery is at least once,
+// and not necessarily in order.
+type Publisher interface {
+	Publish(ctx context.Context, event OutboxEvent) error
+}
+
+// WithPublisher sets a publisher the relay publishes the events written to
+// the outbox with, in addition to delivering them to webhooks. Directories
+// sharing a database elect one of them to relay events at a time.
+func WithPublisher(publisher Publisher) Option {
+	return func(d *Directory) {
+		d.publisher = publisher
+	}
+}
+
+// outboxColumns are the columns inserted by copyOutboxEvents.
+var outboxColumns = []string{"event_type", "user_id", "payload"}
+
+// writeOutboxEvent writes an event for the change of the user to the
+// outbox, using the querier of the transaction of the change.
+func writeOutboxEvent(ctx context.Context, querier Querier, eventType string, user *userspb.User) error {
+	userID, payload, err := encodeOutboxEvent(user)
+	if err != nil {
+		return err
+	}
+	err = querier.CreateOutboxEvent(ctx, CreateOutboxEventParams{
+		EventType: eventType,
+		UserID:    userID,
+		Payload:   payload,
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "unexpected error writing outbox event: %s", err.Error())
+	}
+	return nil
+}
+
+// copyOutboxEvents writes an event to the outbox for each user created or
+// updated by a batch, using the connection of the transaction of the batch.
+// Users that are in neither are left out.
+func copyOutboxEvents(ctx context.Context, conn pgxConn, users []*userspb.User, created, updated []string) error {
+	eventTypes := make(map[string]string, len(created)+len(updated))
+	for _, id := range created {
+		eventTypes[id] = EventUserCreated
+	}
+	for _, id := range updated {
+		eventTypes[id] = EventUserUpdated
+	}
+	rows := make([][]interface{}, 0, len(eventTypes))
+	for _, user := range users {
+		eventType, ok := eventTypes[user.GetId()]
+		if !ok {
+			continue
+		}
+		userID, payload, err := encodeOutboxEvent(user)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{eventType, userID.Bytes, []byte(payload)})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	_, err := conn.CopyFrom(ctx, pgx.Identifier{"outbox"}, outboxColumns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return status.Errorf(codes.Internal, "unexpected error writing outbox events: %s", err.Error())
+	}
+	return nil
+}
+
+// encodeOutboxEvent returns the user ID and payload of an event for the user.
+func encodeOutboxEvent(user *userspb.User) (pgtype.UUID, json.RawMessage, error) {
+	var userID pgtype.UUID
+	err := userID.Set(user.GetId())
+	if err != nil {
+		return userID, nil, status.Errorf(codes.Internal, "invalid user ID %q in outbox event: %s", user.GetId(), err.Error())
+	}
+	payload, err := protojson.Marshal(user)
+	if err != nil {
+		return userID, nil, status.Errorf(codes.Internal, "failed to encode outbox event: %s", err.Error())
+	}
+	return userID, payload, nil
+}
+
+// relayLoop periodically tries to become the relay, and publishes the
+// pending events while it is, until the context is cancelled.
+func (d Directory) relayLoop(ctx context.Context) {
+	defer close(d.relayDone)
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+	for {
+		err := d.relay(ctx, ticker.C)
+		if err != nil && ctx.Err() == nil {
+			d.logger.Error("Failed to relay outbox events", "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// relay takes the advisory lock of the relay, if no other directory holds
+// it, and publishes the pending events on every tick while holding it.
+// The pending webhook deliveries are delivered by deliverLoop meanwhile.
+// The lock is held by a dedicated connection, and released by closing it.
+func (d Directory) relay(ctx context.Context, ticks <-chan time.Time) error {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	var leader bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", int64(relayLockID)).Scan(&leader)
+	if err == nil && !leader {
+		// The connection holds no lock, so it can be reused.
+		return conn.Close()
+	}
+	defer func() {
+		// Discard the connection rather than returning it to the
+		// pool, so that the session, and with it the lock, ends.
+		// Connections that failed to take the lock are discarded
+		// too, in case they took it regardless.
+		_ = conn.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+		_ = conn.Close()
+	}()
+	if err != nil {
+		return err
+	}
+	d.logger.Info("Relaying outbox events")
+	defer d.logger.Info("Stopped relaying outbox events")
+
+	deliverCtx, stopDelivering := context.WithCancel(ctx)
+	deliverDone := make(chan struct{})
+	go func() {
+		defer close(deliverDone)
+		d.deliverLoop(deliverCtx)
+	}()
+	defer func() {
+		stopDelivering()
+		<-deliverDone
+	}()
+
+	for {
+		for {
+			n, err := d.publishPending(ctx)
+			if err != nil {
+				return err
+			}
+			if n < relayBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ticks:
+		case <-ctx.Done():
+			return nil
+		}
+		// Stop relaying if the lock may have been lost with the connection.
+		err = conn.PingContext(ctx)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// publishPending publishes a batch of pending events, returning the number
+// of events attempted. Failed events are retried after a backoff, without
+// holding up the events after them.
+// Publishing an event fans it out to the webhooks subscribed to it,
+// and publishes it with the publisher, if any.
+func (d Directory) publishPending(ctx context.Context) (int, error) {
+	pgEvents, err := d.querier.ListPendingOutboxEvents(ctx, relayBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, pgEvent := range pgEvents {
+		event := OutboxEvent{
+			ID:         pgEvent.ID,
+			Type:       pgEvent.EventType,
+			CreateTime: pgEvent.CreateTime,
+			User:       pgEvent.Payload,
+		}
+		err = pgEvent.UserID.AssignTo(&event.UserID)
+		if err != nil {
+			return 0, err
+		}
+		err = d.publish(ctx, event)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			attempts := pgEvent.Attempts + 1
+			backoff := retryBackoff(attempts)
+			d.logger.Warn("Failed to publish outbox event",
+				"id", event.ID, "attempts", attempts, "retry_in", backoff, "error", err)
+			err = d.querier.MarkOutboxEventFailed(ctx, MarkOutboxEventFailedParams{
+				ID:              pgEvent.ID,
+				NextAttemptTime: time.Now().Add(backoff),
+				LastError:       err.Error(),
+			})
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		err = d.querier.MarkOutboxEventPublished(ctx, pgEvent.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(pgEvents), nil
+}
+
+// publish fans the event out to the webhooks subscribed to it, and
+// publishes it with the publisher, if any. Since deliveries are unique
+// per event, the event can be published again after a failure.
+func (d Directory) publish(ctx context.Context, event OutboxEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	err = d.querier.CreateWebhookDeliveries(ctx, CreateWebhookDeliveriesParams{
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   payload,
+	})
+	if err != nil {
+		return fmt.Errorf("creating webhook deliveries: %w", err)
+	}
+	if d.publisher == nil {
+		return nil
+	}
+	return d.publisher.Publish(ctx, event)
+}
+
+// retryBackoff returns how long to wait before retrying an event after
+// the number of failed attempts. It doubles with every attempt, up to
+// maxRetryBackoff.
+func retryBackoff(attempts int32) time.Duration {
+	backoff := minRetryBackoff
+	for i := int32(1); i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
+}
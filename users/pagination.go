@@ -0,0 +1,312 @@
+package users
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgtype"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// pageToken is the cursor encoded in page tokens and resume tokens. It
+// holds the values of the order keys of the last user returned, so that
+// the next page or stream can start right after it.
+type pageToken struct {
+	CreateTime time.Time `json:"t"`
+	ID         []byte    `json:"i"`
+	Name       string    `json:"n,omitempty"`
+	Role       Role      `json:"r,omitempty"`
+	// Filter is a hash of the filters the token was issued for,
+	// including the order.
+	Filter []byte `json:"f"`
+}
+
+func newPageToken(pgUser User, order []orderKey, filter []byte) pageToken {
+	pt := pageToken{
+		CreateTime: pgUser.CreateTime,
+		ID:         pgUser.ID.Bytes[:],
+		Filter:     filter,
+	}
+	// Only include the keys that are needed, to keep tokens short.
+	for _, key := range order {
+		switch key.column {
+		case "name":
+			pt.Name = pgUser.Name
+		case "role":
+			pt.Role = pgUser.Role
+		}
+	}
+	return pt
+}
+
+// userPageToken returns the token continuing a listing of users in the
+// order after the user.
+func userPageToken(user *userspb.User, order []orderKey, filter []byte) (pageToken, error) {
+	pgUser, err := cursorUser(user)
+	if err != nil {
+		return pageToken{}, err
+	}
+	return newPageToken(pgUser, order, filter), nil
+}
+
+// cursorUser converts the fields of the user that can be ordered by.
+func cursorUser(user *userspb.User) (User, error) {
+	var userID pgtype.UUID
+	err := userID.Set(user.GetId())
+	if err != nil {
+		return User{}, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	pgRole, err := roleProtoToPostgres(user.GetRole())
+	if err != nil {
+		return User{}, err
+	}
+	return User{
+		ID:         userID,
+		CreateTime: user.GetCreateTime().AsTime(),
+		Name:       user.GetName(),
+		Role:       pgRole,
+	}, nil
+}
+
+// user returns the user the token continues after, holding the values
+// of the order keys in the token.
+func (p pageToken) user() (*userspb.User, error) {
+	var userID pgtype.UUID
+	err := userID.Set(p.ID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid token")
+	}
+	var id string
+	err = userID.AssignTo(&id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid token")
+	}
+	user := &userspb.User{
+		Id:         id,
+		CreateTime: timestamppb.New(p.CreateTime),
+		Name:       p.Name,
+	}
+	if p.Role != "" {
+		user.Role, err = rolePostgresToProto(p.Role)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid token")
+		}
+	}
+	return user, nil
+}
+
+// encodePageToken encodes the token and signs it with the key, so that
+// clients cannot tamper with it.
+func encodePageToken(key []byte, token pageToken) (string, error) {
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(payload)), nil
+}
+
+// decodePageToken decodes a token created by encodePageToken, verifying its
+// signature and that it was issued for the same filters.
+func decodePageToken(key []byte, token string, filter []byte) (pageToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) < sha256.Size {
+		return pageToken{}, status.Error(codes.InvalidArgument, "invalid token")
+	}
+	payload, sig := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return pageToken{}, status.Error(codes.InvalidArgument, "invalid token")
+	}
+	var pt pageToken
+	err = json.Unmarshal(payload, &pt)
+	if err != nil {
+		return pageToken{}, status.Error(codes.InvalidArgument, "invalid token")
+	}
+	if !hmac.Equal(pt.Filter, filter) {
+		return pageToken{}, status.Error(codes.InvalidArgument, "token was issued for different filters")
+	}
+	return pt, nil
+}
+
+// normalizePageSize returns the page size requested, applying the default and
+// maximum page sizes.
+func normalizePageSize(size int32) (int, error) {
+	switch {
+	case size < 0:
+		return 0, status.Error(codes.InvalidArgument, "page size must not be negative")
+	case size == 0:
+		return defaultPageSize, nil
+	case size > maxPageSize:
+		return maxPageSize, nil
+	}
+	return int(size), nil
+}
+
+// requestFilterHash returns a hash of the request, ignoring its page size
+// and page token, for listings without filters beyond their request fields.
+func requestFilterHash(req proto.Message) ([]byte, error) {
+	req = proto.Clone(req)
+	msg := req.ProtoReflect()
+	for _, name := range []protoreflect.Name{"page_size", "page_token"} {
+		if fd := msg.Descriptor().Fields().ByName(name); fd != nil {
+			msg.Clear(fd)
+		}
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(b)
+	return h[:], nil
+}
+
+// filterHash returns a hash of the filters of the request, ignoring the
+// fields used for pagination and resumption.
+func filterHash(req *userspb.ListUsersRequest) ([]byte, error) {
+	req = proto.Clone(req).(*userspb.ListUsersRequest)
+	req.PageSize = 0
+	req.PageToken = ""
+	req.ResumeToken = ""
+	req.IncludeResumeTokens = false
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(b)
+	return h[:], nil
+}
+
+// values returns the values of the order keys in the token, by column.
+func (p pageToken) values() (map[string]interface{}, error) {
+	var pgTime pgtype.Timestamptz
+	err := pgTime.Set(p.CreateTime)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid token")
+	}
+	var userID pgtype.UUID
+	err = userID.Set(p.ID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid token")
+	}
+	return map[string]interface{}{
+		"create_time": pgTime,
+		"id":          userID,
+		"name":        p.Name,
+		"role":        p.Role,
+	}, nil
+}
+
+// queryPage runs the query for a page of rows, in the default order, after
+// the page token, if any. It returns the rows and the token for the next
+// page, if there are more rows. cursor returns the page token of a row,
+// which is completed with the hash of the request filters.
+func queryPage[T any](
+	ctx context.Context,
+	d Directory,
+	q squirrel.SelectBuilder,
+	req proto.Message,
+	size int32,
+	token string,
+	scan func(rowScanner) (T, error),
+	cursor func(T) pageToken,
+) (_ []T, _ string, retErr error) {
+	pageSize, err := normalizePageSize(size)
+	if err != nil {
+		return nil, "", err
+	}
+	filter, err := requestFilterHash(req)
+	if err != nil {
+		return nil, "", status.Errorf(codes.Internal, "failed to hash filters: %s", err.Error())
+	}
+	q = q.OrderBy(
+		orderByClauses(defaultOrder)...,
+	).Limit(
+		// Fetch one extra row to find out whether there is another page.
+		uint64(pageSize) + 1,
+	)
+	if token != "" {
+		pt, err := decodePageToken(d.pageTokenKey, token, filter)
+		if err != nil {
+			return nil, "", err
+		}
+		values, err := pt.values()
+		if err != nil {
+			return nil, "", err
+		}
+		q = q.Where(afterCursor(defaultOrder, values))
+	}
+
+	rows, err := q.QueryContext(ctx)
+	if err != nil {
+		return nil, "", status.Error(codes.Internal, err.Error())
+	}
+	defer func() {
+		cerr := rows.Close()
+		if retErr == nil && cerr != nil {
+			retErr = status.Error(codes.Internal, cerr.Error())
+		}
+	}()
+	var page []T
+	for rows.Next() {
+		row, err := scan(rows)
+		if err != nil {
+			return nil, "", status.Error(codes.Internal, err.Error())
+		}
+		page = append(page, row)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, "", status.Error(codes.Internal, err.Error())
+	}
+
+	var next string
+	if len(page) > pageSize {
+		page = page[:pageSize]
+		pt := cursor(page[pageSize-1])
+		pt.Filter = filter
+		next, err = encodePageToken(d.pageTokenKey, pt)
+		if err != nil {
+			return nil, "", status.Errorf(codes.Internal, "failed to create page token: %s", err.Error())
+		}
+	}
+	return page, next, nil
+}
+
+// listUsersPage lists a page of the users selected by the query, in order
+// of creation, returning the users and the token for the next page, if any.
+func (d Directory) listUsersPage(ctx context.Context, q squirrel.SelectBuilder, req proto.Message, size int32, token string) ([]*userspb.User, string, error) {
+	pgUsers, next, err := queryPage(ctx, d, q, req, size, token, scanUser, func(pgUser User) pageToken {
+		return newPageToken(pgUser, defaultOrder, nil)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	users := make([]*userspb.User, 0, len(pgUsers))
+	for _, pgUser := range pgUsers {
+		protoUser, err := userPostgresToProto(pgUser)
+		if err != nil {
+			return nil, "", err
+		}
+		users = append(users, protoUser)
+	}
+	return users, next, nil
+}
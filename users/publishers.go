@@ -0,0 +1,120 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// WebhookPublisher publishes events by posting them as JSON to a URL.
+// Responses with a status other than 2xx are failures. The event ID is
+// sent in the Idempotency-Key header, for receivers to detect duplicates.
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPublisher creates a publisher posting events to the URL with
+// the client. If the client is nil, a client with a timeout is used.
+func NewWebhookPublisher(url string, client *http.Client) *WebhookPublisher {
+	if client == nil {
+		client = &http.Client{Timeout: defaultWebhookTimeout}
+	}
+	return &WebhookPublisher{
+		url:    url,
+		client: client,
+	}
+}
+
+// Publish posts the event to the URL.
+func (p *WebhookPublisher) Publish(ctx context.Context, event OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	header := http.Header{}
+	header.Set("Idempotency-Key", strconv.FormatInt(event.ID, 10))
+	_, err = postJSON(ctx, p.client, p.url, body, header)
+	return err
+}
+
+// postJSON posts the JSON body to the URL, returning the status code of
+// the response, if any, and an error if it isn't 2xx.
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain the body, so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %q", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// FilePublisher publishes events by appending them to a file, as
+// newline-delimited JSON. The file is synced after each event.
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePublisher creates a publisher appending events to the file at
+// the path, which is created if it doesn't exist.
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{
+		file: file,
+	}, nil
+}
+
+// Publish appends the event to the file.
+func (p *FilePublisher) Publish(_ context.Context, event OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	line = append(line, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info, err := p.file.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = p.file.Write(line)
+	if err == nil {
+		err = p.file.Sync()
+	}
+	if err != nil {
+		// Remove any partially written line, so that
+		// the retry doesn't leave an invalid line behind.
+		_ = p.file.Truncate(info.Size())
+		return err
+	}
+	return nil
+}
+
+// Close closes the file.
+func (p *FilePublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.file.Close()
+}
@@ -0,0 +1,104 @@
+package users
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWebhookPublisher(t *testing.T) {
+	t.Parallel()
+
+	event := OutboxEvent{
+		ID:         42,
+		Type:       EventUserCreated,
+		UserID:     "5f0ea2a4-3f32-4f5b-9f47-5a1f0a1d2b3c",
+		CreateTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		User:       json.RawMessage(`{"name":"Foo"}`),
+	}
+	var got OutboxEvent
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected a POST request, got %s", r.Method)
+		}
+		if key := r.Header.Get("Idempotency-Key"); key != "42" {
+			t.Errorf("Expected the event ID as idempotency key, got %q", key)
+		}
+		err := json.NewDecoder(r.Body).Decode(&got)
+		if err != nil {
+			t.Errorf("Failed to decode event: %s", err)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	publisher := NewWebhookPublisher(srv.URL, srv.Client())
+	err := publisher.Publish(context.Background(), event)
+	if err != nil {
+		t.Fatalf("Failed to publish event: %s", err)
+	}
+	if diff := cmp.Diff(event, got); diff != "" {
+		t.Errorf("Event was not as expected:\n%s", diff)
+	}
+
+	status = http.StatusServiceUnavailable
+	err = publisher.Publish(context.Background(), event)
+	if err == nil {
+		t.Error("Expected an error for an unsuccessful response")
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	publisher, err := NewFilePublisher(path)
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %s", err)
+	}
+	events := []OutboxEvent{
+		{ID: 1, Type: EventUserCreated, UserID: "a", User: json.RawMessage(`{"name":"Foo"}`)},
+		{ID: 2, Type: EventUserDeleted, UserID: "a", User: json.RawMessage(`{"name":"Foo"}`)},
+	}
+	for _, event := range events {
+		err = publisher.Publish(context.Background(), event)
+		if err != nil {
+			t.Fatalf("Failed to publish event: %s", err)
+		}
+	}
+	err = publisher.Close()
+	if err != nil {
+		t.Fatalf("Failed to close publisher: %s", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %s", err)
+	}
+	defer f.Close()
+	var got []OutboxEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event OutboxEvent
+		err = json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			t.Fatalf("Failed to decode line %q: %s", scanner.Text(), err)
+		}
+		got = append(got, event)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Failed to read file: %s", err)
+	}
+	if diff := cmp.Diff(events, got); diff != "" {
+		t.Errorf("Events were not as expected:\n%s", diff)
+	}
+}
@@ -0,0 +1,126 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+const (
+	defaultPurgeRetention = 30 * 24 * time.Hour
+	// importRetention is how long import chunks are recorded,
+	// and so how long an interrupted import can be resumed.
+	importRetention = 7 * 24 * time.Hour
+	// requestRetention is how long add user requests are recorded,
+	// and so how long retries are recognised.
+	requestRetention = 24 * time.Hour
+	purgeInterval    = time.Hour
+	// purgeBatchSize is the number of users deleted per statement,
+	// to avoid holding locks on many rows at once.
+	purgeBatchSize = 1000
+)
+
+// purgeLoop periodically purges users that were soft deleted longer
+// than the retention ago, if enabled, along with expired import chunks,
+// add user requests, published outbox events and finished webhook
+// deliveries, until the context is cancelled.
+func (d Directory) purgeLoop(ctx context.Context) {
+	defer close(d.purgeDone)
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		if d.purgeRetention > 0 {
+			purged, err := d.purgeDeletedUsers(ctx, time.Now().Add(-d.purgeRetention))
+			logPurge(ctx, d.logger, "deleted users", purged, err)
+		}
+		purged, err := d.querier.PurgeImportChunks(ctx, time.Now().Add(-importRetention))
+		logPurge(ctx, d.logger, "import chunks", purged, err)
+		purged, err = d.querier.PurgeAddUserRequests(ctx, time.Now().Add(-requestRetention))
+		logPurge(ctx, d.logger, "add user requests", purged, err)
+		purged, err = d.querier.PurgeOutboxEvents(ctx, time.Now().Add(-outboxRetention))
+		logPurge(ctx, d.logger, "published outbox events", purged, err)
+		purged, err = d.querier.PurgeWebhookDeliveries(ctx, time.Now().Add(-deliveryRetention))
+		logPurge(ctx, d.logger, "finished webhook deliveries", purged, err)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func logPurge(ctx context.Context, logger *slog.Logger, what string, purged int64, err error) {
+	switch {
+	case err != nil && ctx.Err() == nil:
+		logger.Error("Failed to purge "+what, "error", err)
+	case purged > 0:
+		logger.Info("Purged "+what, "count", purged)
+	}
+}
+
+// purgeDeletedUsers permanently deletes users soft deleted before
+// the cutoff, in batches, returning the number of users deleted.
+func (d Directory) purgeDeletedUsers(ctx context.Context, cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		n, err := d.purgeDeletedUsersBatch(ctx, cutoff)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// purgeDeletedUsersBatch permanently deletes a batch of users soft
+// deleted before the cutoff, recording each in the audit log and the
+// outbox in the same transaction, and returns the number of users deleted.
+func (d Directory) purgeDeletedUsersBatch(ctx context.Context, cutoff time.Time) (_ int64, retErr error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = err
+		}
+	}()
+	querier := New(tx)
+
+	pgUsers, err := querier.PurgeUsers(ctx, PurgeUsersParams{
+		Cutoff:    cutoff,
+		BatchSize: purgeBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, pgUser := range pgUsers {
+		user, err := userPostgresToProto(pgUser)
+		if err != nil {
+			return 0, err
+		}
+		err = recordAuditEvent(ctx, querier, auditEvent{
+			action:  userspb.AuditAction_PURGE_USER,
+			userIDs: []string{user.GetId()},
+			before:  user,
+		})
+		if err != nil {
+			return 0, err
+		}
+		err = writeOutboxEvent(ctx, querier, EventUserPurged, user)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(pgUsers)), nil
+}
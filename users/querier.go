@@ -6,13 +6,78 @@ package users
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgtype"
 )
 
 type Querier interface {
+	// AddGroupMember adds the user to the group, unless the user is
+	// soft deleted or already a member.
+	AddGroupMember(ctx context.Context, arg AddGroupMemberParams) (GroupMember, error)
 	AddUser(ctx context.Context, arg AddUserParams) (User, error)
-	DeleteUser(ctx context.Context, id pgtype.UUID) (User, error)
+	// AssignRole assigns the role to the user, unless the user
+	// is soft deleted or already has the role assigned.
+	AssignRole(ctx context.Context, arg AssignRoleParams) (UserRole, error)
+	BatchGetUsers(ctx context.Context, ids []pgtype.UUID) ([]User, error)
+	CreateAddUserRequest(ctx context.Context, arg CreateAddUserRequestParams) (int64, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) error
+	CreateGroup(ctx context.Context, arg CreateGroupParams) (Group, error)
+	CreateImportChunk(ctx context.Context, arg CreateImportChunkParams) (int64, error)
+	CreateOrgUnit(ctx context.Context, arg CreateOrgUnitParams) (OrgUnit, error)
+	CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) error
+	CreateRole(ctx context.Context, arg CreateRoleParams) (RoleDefinition, error)
+	CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error)
+	// CreateWebhookDeliveries fans the outbox event out to the webhooks
+	// subscribed to its type. Relaying the event again is a no-op.
+	CreateWebhookDeliveries(ctx context.Context, arg CreateWebhookDeliveriesParams) error
+	// A version of 0 matches any version.
+	DeleteGroup(ctx context.Context, arg DeleteGroupParams) (Group, error)
+	// A version of 0 matches any version.
+	DeleteOrgUnit(ctx context.Context, arg DeleteOrgUnitParams) (OrgUnit, error)
+	// A version of 0 matches any version.
+	DeleteRole(ctx context.Context, arg DeleteRoleParams) (RoleDefinition, error)
+	// A version of 0 matches any version.
+	DeleteUser(ctx context.Context, arg DeleteUserParams) (User, error)
+	DeleteWebhook(ctx context.Context, id pgtype.UUID) (Webhook, error)
+	GetAddUserRequest(ctx context.Context, requestID string) (AddUserRequest, error)
+	GetGroup(ctx context.Context, id pgtype.UUID) (Group, error)
+	GetGroupMember(ctx context.Context, arg GetGroupMemberParams) (GroupMember, error)
+	GetImportChunk(ctx context.Context, arg GetImportChunkParams) (ImportChunk, error)
+	GetOrgUnit(ctx context.Context, id pgtype.UUID) (OrgUnit, error)
+	GetRole(ctx context.Context, name string) (RoleDefinition, error)
+	GetRoleAssignment(ctx context.Context, arg GetRoleAssignmentParams) (UserRole, error)
+	GetUser(ctx context.Context, id pgtype.UUID) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserForUpdate(ctx context.Context, id pgtype.UUID) (User, error)
+	GetUserOrgUnit(ctx context.Context, userID pgtype.UUID) (OrgUnitUser, error)
+	GetWebhook(ctx context.Context, id pgtype.UUID) (Webhook, error)
+	// IsOrgUnitAncestor returns whether the ancestor is the org unit
+	// itself, or one of its ancestors, by walking up the tree.
+	IsOrgUnitAncestor(ctx context.Context, arg IsOrgUnitAncestorParams) (bool, error)
+	ListPendingOutboxEvents(ctx context.Context, limit int32) ([]Outbox, error)
+	ListPendingWebhookDeliveries(ctx context.Context, limit int32) ([]ListPendingWebhookDeliveriesRow, error)
+	ListRoles(ctx context.Context) ([]RoleDefinition, error)
+	// ListUserRoles lists the built-in role of the user's role column,
+	// along with the roles assigned to the user.
+	ListUserRoles(ctx context.Context, userID pgtype.UUID) ([]RoleDefinition, error)
+	MarkOutboxEventFailed(ctx context.Context, arg MarkOutboxEventFailedParams) error
+	MarkOutboxEventPublished(ctx context.Context, id int64) error
+	PurgeAddUserRequests(ctx context.Context, cutoff time.Time) (int64, error)
+	PurgeImportChunks(ctx context.Context, cutoff time.Time) (int64, error)
+	PurgeOutboxEvents(ctx context.Context, cutoff time.Time) (int64, error)
+	PurgeUsers(ctx context.Context, arg PurgeUsersParams) ([]User, error)
+	PurgeWebhookDeliveries(ctx context.Context, cutoff time.Time) (int64, error)
+	RemoveGroupMember(ctx context.Context, arg RemoveGroupMemberParams) (GroupMember, error)
+	RemoveUserOrgUnit(ctx context.Context, userID pgtype.UUID) (int64, error)
+	SetImportChunkResponse(ctx context.Context, arg SetImportChunkResponseParams) error
+	// SetUserOrgUnit places the user in the org unit, unless
+	// the user is soft deleted.
+	SetUserOrgUnit(ctx context.Context, arg SetUserOrgUnitParams) (OrgUnitUser, error)
+	SoftDeleteUser(ctx context.Context, arg SoftDeleteUserParams) (User, error)
+	UnassignRole(ctx context.Context, arg UnassignRoleParams) (UserRole, error)
+	UndeleteUser(ctx context.Context, arg UndeleteUserParams) (User, error)
+	UpdateWebhookDelivery(ctx context.Context, arg UpdateWebhookDeliveryParams) error
 }
 
 var _ Querier = (*Queries)(nil)
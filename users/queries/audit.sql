@@ -0,0 +1,16 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (
+  actor,
+  peer,
+  action,
+  user_ids,
+  before,
+  after
+) VALUES (
+  @actor,
+  @peer,
+  @action,
+  @user_ids::uuid[],
+  @before,
+  @after
+);
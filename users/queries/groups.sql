@@ -0,0 +1,44 @@
+-- name: CreateGroup :one
+INSERT INTO groups (
+  id,
+  name,
+  description
+) VALUES (
+  $1,
+  $2,
+  $3
+)
+RETURNING *;
+
+-- name: GetGroup :one
+SELECT * FROM groups
+WHERE id = $1;
+
+-- A version of 0 matches any version.
+
+-- name: DeleteGroup :one
+DELETE FROM groups
+WHERE id = @id AND (@version::bigint = 0 OR version = @version)
+RETURNING *;
+
+-- AddGroupMember adds the user to the group, unless the user is
+-- soft deleted or already a member.
+
+-- name: AddGroupMember :one
+INSERT INTO group_members (
+  group_id,
+  user_id
+)
+SELECT @group_id::uuid, id FROM users
+WHERE id = @user_id::uuid AND delete_time IS NULL
+ON CONFLICT (group_id, user_id) DO NOTHING
+RETURNING *;
+
+-- name: GetGroupMember :one
+SELECT * FROM group_members
+WHERE group_id = $1 AND user_id = $2;
+
+-- name: RemoveGroupMember :one
+DELETE FROM group_members
+WHERE group_id = $1 AND user_id = $2
+RETURNING *;
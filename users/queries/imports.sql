@@ -0,0 +1,28 @@
+-- name: CreateImportChunk :execrows
+INSERT INTO import_chunks (
+  import_id,
+  chunk,
+  first_row,
+  row_count,
+  request_hash
+) VALUES (
+  $1,
+  $2,
+  $3,
+  $4,
+  $5
+)
+ON CONFLICT DO NOTHING;
+
+-- name: SetImportChunkResponse :exec
+UPDATE import_chunks
+SET response = $3
+WHERE import_id = $1 AND chunk = $2;
+
+-- name: GetImportChunk :one
+SELECT * FROM import_chunks
+WHERE import_id = $1 AND chunk = $2;
+
+-- name: PurgeImportChunks :execrows
+DELETE FROM import_chunks
+WHERE create_time < @cutoff::timestamptz;
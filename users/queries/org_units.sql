@@ -0,0 +1,60 @@
+-- name: CreateOrgUnit :one
+INSERT INTO org_units (
+  id,
+  parent_id,
+  name
+) VALUES (
+  $1,
+  $2,
+  $3
+)
+RETURNING *;
+
+-- name: GetOrgUnit :one
+SELECT * FROM org_units
+WHERE id = $1;
+
+-- A version of 0 matches any version.
+
+-- name: DeleteOrgUnit :one
+DELETE FROM org_units
+WHERE id = @id AND (@version::bigint = 0 OR version = @version)
+RETURNING *;
+
+-- IsOrgUnitAncestor returns whether the ancestor is the org unit
+-- itself, or one of its ancestors, by walking up the tree.
+
+-- name: IsOrgUnitAncestor :one
+WITH RECURSIVE ancestors AS (
+  SELECT org_units.id, org_units.parent_id FROM org_units
+  WHERE org_units.id = @id::uuid
+  UNION ALL
+  SELECT org_units.id, org_units.parent_id FROM org_units
+  JOIN ancestors ON org_units.id = ancestors.parent_id
+)
+SELECT EXISTS (
+  SELECT 1 FROM ancestors
+  WHERE ancestors.id = @ancestor_id::uuid
+)::bool;
+
+-- SetUserOrgUnit places the user in the org unit, unless
+-- the user is soft deleted.
+
+-- name: SetUserOrgUnit :one
+INSERT INTO org_unit_users (
+  user_id,
+  org_unit_id
+)
+SELECT id, @org_unit_id::uuid FROM users
+WHERE id = @user_id::uuid AND delete_time IS NULL
+ON CONFLICT (user_id) DO UPDATE
+SET org_unit_id = excluded.org_unit_id, update_time = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: GetUserOrgUnit :one
+SELECT * FROM org_unit_users
+WHERE user_id = $1;
+
+-- name: RemoveUserOrgUnit :execrows
+DELETE FROM org_unit_users
+WHERE user_id = $1;
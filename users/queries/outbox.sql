@@ -0,0 +1,30 @@
+-- name: CreateOutboxEvent :exec
+INSERT INTO outbox (
+  event_type,
+  user_id,
+  payload
+) VALUES (
+  $1,
+  $2,
+  $3
+);
+
+-- name: ListPendingOutboxEvents :many
+SELECT * FROM outbox
+WHERE publish_time IS NULL AND next_attempt_time <= CURRENT_TIMESTAMP
+ORDER BY id
+LIMIT $1;
+
+-- name: MarkOutboxEventPublished :exec
+UPDATE outbox
+SET publish_time = CURRENT_TIMESTAMP, attempts = attempts + 1
+WHERE id = $1;
+
+-- name: MarkOutboxEventFailed :exec
+UPDATE outbox
+SET attempts = attempts + 1, next_attempt_time = @next_attempt_time, last_error = @last_error
+WHERE id = @id;
+
+-- name: PurgeOutboxEvents :execrows
+DELETE FROM outbox
+WHERE publish_time < @cutoff::timestamptz;
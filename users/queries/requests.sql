@@ -0,0 +1,19 @@
+-- name: CreateAddUserRequest :execrows
+INSERT INTO add_user_requests (
+  request_id,
+  user_id,
+  request_hash
+) VALUES (
+  $1,
+  $2,
+  $3
+)
+ON CONFLICT DO NOTHING;
+
+-- name: GetAddUserRequest :one
+SELECT * FROM add_user_requests
+WHERE request_id = $1;
+
+-- name: PurgeAddUserRequests :execrows
+DELETE FROM add_user_requests
+WHERE create_time < @cutoff::timestamptz;
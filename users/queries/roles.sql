@@ -0,0 +1,57 @@
+-- name: CreateRole :one
+INSERT INTO roles (
+  name,
+  description,
+  permissions
+) VALUES (
+  $1,
+  $2,
+  $3
+)
+RETURNING *;
+
+-- name: GetRole :one
+SELECT * FROM roles
+WHERE name = $1;
+
+-- name: ListRoles :many
+SELECT * FROM roles
+ORDER BY name;
+
+-- A version of 0 matches any version.
+
+-- name: DeleteRole :one
+DELETE FROM roles
+WHERE name = @name AND NOT builtin AND (@version::bigint = 0 OR version = @version)
+RETURNING *;
+
+-- AssignRole assigns the role to the user, unless the user
+-- is soft deleted or already has the role assigned.
+
+-- name: AssignRole :one
+INSERT INTO user_roles (
+  user_id,
+  role_name
+)
+SELECT id, @role_name::text FROM users
+WHERE id = @user_id::uuid AND delete_time IS NULL
+ON CONFLICT (user_id, role_name) DO NOTHING
+RETURNING *;
+
+-- name: GetRoleAssignment :one
+SELECT * FROM user_roles
+WHERE user_id = $1 AND role_name = $2;
+
+-- name: UnassignRole :one
+DELETE FROM user_roles
+WHERE user_id = $1 AND role_name = $2
+RETURNING *;
+
+-- ListUserRoles lists the built-in role of the user's role column,
+-- along with the roles assigned to the user.
+
+-- name: ListUserRoles :many
+SELECT * FROM roles
+WHERE name = (SELECT users.role::text FROM users WHERE users.id = @user_id::uuid)
+   OR name IN (SELECT user_roles.role_name FROM user_roles WHERE user_roles.user_id = @user_id::uuid)
+ORDER BY name;
@@ -1,14 +1,63 @@
 -- name: AddUser :one
 INSERT INTO users (
+  id,
   role,
-  name
+  name,
+  labels,
+  attributes,
+  email
 ) VALUES (
-  $1, 
-  $2
+  $1,
+  $2,
+  $3,
+  $4,
+  $5,
+  $6
 )
+ON CONFLICT (id) DO NOTHING
 RETURNING *;
 
+-- A version of 0 matches any version.
+
 -- name: DeleteUser :one
 DELETE FROM users
-WHERE id = $1
+WHERE id = @id AND (@version::bigint = 0 OR version = @version)
+RETURNING *;
+
+-- name: SoftDeleteUser :one
+UPDATE users
+SET delete_time = CURRENT_TIMESTAMP, version = version + 1
+WHERE id = @id AND delete_time IS NULL AND (@version::bigint = 0 OR version = @version)
 RETURNING *;
+
+-- name: UndeleteUser :one
+UPDATE users
+SET delete_time = NULL, version = version + 1
+WHERE id = @id AND delete_time IS NOT NULL AND (@version::bigint = 0 OR version = @version)
+RETURNING *;
+
+-- name: PurgeUsers :many
+DELETE FROM users
+WHERE id IN (
+  SELECT id FROM users
+  WHERE delete_time < @cutoff::timestamptz
+  LIMIT @batch_size
+)
+RETURNING *;
+
+-- name: GetUser :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE lower(email) = lower(@email::text);
+
+-- name: BatchGetUsers :many
+SELECT * FROM users
+WHERE id = ANY(@ids::uuid[]);
+
+-- name: GetUserForUpdate :one
+SELECT * FROM users
+WHERE id = $1
+FOR UPDATE;
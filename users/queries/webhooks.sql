@@ -0,0 +1,59 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (
+  url,
+  event_types,
+  secret
+) VALUES (
+  $1,
+  $2,
+  $3
+)
+RETURNING *;
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1;
+
+-- name: DeleteWebhook :one
+DELETE FROM webhooks
+WHERE id = $1
+RETURNING *;
+
+-- CreateWebhookDeliveries fans the outbox event out to the webhooks
+-- subscribed to its type. Relaying the event again is a no-op.
+
+-- name: CreateWebhookDeliveries :exec
+INSERT INTO webhook_deliveries (
+  webhook_id,
+  event_id,
+  event_type,
+  payload
+)
+SELECT id, @event_id::bigint, @event_type::text, @payload::jsonb
+FROM webhooks
+WHERE event_types ? @event_type::text
+ON CONFLICT (webhook_id, event_id) DO NOTHING;
+
+-- name: ListPendingWebhookDeliveries :many
+SELECT webhook_deliveries.id, webhook_deliveries.event_id, webhook_deliveries.payload,
+  webhook_deliveries.attempts, webhooks.url, webhooks.secret
+FROM webhook_deliveries
+JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+WHERE state = 'pending' AND next_attempt_time <= CURRENT_TIMESTAMP
+ORDER BY next_attempt_time
+LIMIT $1;
+
+-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET
+  state = @state,
+  attempts = attempts + 1,
+  next_attempt_time = @next_attempt_time,
+  last_status_code = @last_status_code,
+  last_error = @last_error,
+  update_time = CURRENT_TIMESTAMP
+WHERE id = @id;
+
+-- name: PurgeWebhookDeliveries :execrows
+DELETE FROM webhook_deliveries
+WHERE state <> 'pending' AND update_time < @cutoff::timestamptz;
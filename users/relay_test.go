@@ -0,0 +1,296 @@
+package users_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+	"github.com/johanbrandhorst/grpc-postgres/users"
+)
+
+// flakyPublisher fails to publish each event the first time.
+type flakyPublisher struct {
+	mu        sync.Mutex
+	attempted map[int64]bool
+	published []users.OutboxEvent
+}
+
+func (p *flakyPublisher) Publish(_ context.Context, event users.OutboxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.attempted[event.ID] {
+		p.attempted[event.ID] = true
+		return errors.New("temporary failure")
+	}
+	p.published = append(p.published, event)
+	return nil
+}
+
+func (p *flakyPublisher) events() []users.OutboxEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]users.OutboxEvent(nil), p.published...)
+}
+
+func TestOutboxRelay(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	pgURL := startDatabase(t, log)
+	publisher := &flakyPublisher{attempted: map[int64]bool{}}
+	// Both directories write events, but only one relays them.
+	var directories []*users.Directory
+	for i := 0; i < 2; i++ {
+		directory, err := users.NewDirectory(log, pgURL, users.WithPublisher(publisher))
+		if err != nil {
+			t.Fatalf("Failed to create a new directory: %s", err)
+		}
+		t.Cleanup(func() {
+			err = directory.Close()
+			if err != nil {
+				t.Errorf("Failed to close directory: %s", err)
+			}
+		})
+		directories = append(directories, directory)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	user, err := directories[0].AddUser(ctx, &userspb.AddUserRequest{
+		Role: userspb.Role_MEMBER,
+		Name: "Foo",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add user: %s", err)
+	}
+	addSrv := &addUsersSrvFake{
+		ctx: ctx,
+		reqs: []*userspb.AddUserRequest{
+			{Role: userspb.Role_GUEST, Name: "Bar"},
+		},
+	}
+	err = directories[1].AddUsers(addSrv)
+	if err != nil {
+		t.Fatalf("Failed to add users: %s", err)
+	}
+	deleted, err := directories[1].DeleteUser(ctx, &userspb.DeleteUserRequest{
+		Id: user.GetId(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete user: %s", err)
+	}
+
+	var events []users.OutboxEvent
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		events = publisher.events()
+		if len(events) >= 3 {
+			break
+		}
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 published events, got %d: %v", len(events), events)
+	}
+	wantTypes := []string{users.EventUserCreated, users.EventUserCreated, users.EventUserDeleted}
+	var gotTypes []string
+	for _, event := range events {
+		gotTypes = append(gotTypes, event.Type)
+	}
+	if diff := cmp.Diff(wantTypes, gotTypes); diff != "" {
+		t.Fatalf("Event types were not as expected:\n%s", diff)
+	}
+	for i, want := range []*userspb.User{user, nil, deleted} {
+		got := new(userspb.User)
+		err = protojson.Unmarshal(events[i].User, got)
+		if err != nil {
+			t.Fatalf("Failed to decode user of event %d: %s", i, err)
+		}
+		if want == nil {
+			if got.GetName() != "Bar" || events[i].UserID != got.GetId() {
+				t.Errorf("User of event %d was not as expected: %s", i, events[i].User)
+			}
+			continue
+		}
+		if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+			t.Errorf("User of event %d was not as expected:\n%s", i, diff)
+		}
+		if events[i].UserID != want.GetId() {
+			t.Errorf("Expected event %d for user %q, got %q", i, want.GetId(), events[i].UserID)
+		}
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log), users.WithMaxDeliveryAttempts(2), users.WithPrivateWebhooks())
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	var mu sync.Mutex
+	var requests []received
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read request: %s", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, received{header: r.Header, body: body})
+	}))
+	t.Cleanup(receiver.Close)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+
+	webhook, err := directory.CreateWebhook(ctx, &userspb.CreateWebhookRequest{
+		Url: receiver.URL,
+		EventTypes: []userspb.WebhookEventType{
+			userspb.WebhookEventType_USER_CREATED,
+			userspb.WebhookEventType_USER_DELETED,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %s", err)
+	}
+	if webhook.GetSecret() == "" {
+		t.Fatal("Expected a generated secret")
+	}
+	deadWebhook, err := directory.CreateWebhook(ctx, &userspb.CreateWebhookRequest{
+		Url:        failing.URL,
+		EventTypes: []userspb.WebhookEventType{userspb.WebhookEventType_USER_CREATED},
+		Secret:     "a-secret-of-16-characters",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %s", err)
+	}
+	got, err := directory.GetWebhook(ctx, &userspb.GetWebhookRequest{
+		Id: webhook.GetId(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to get webhook: %s", err)
+	}
+	if got.GetSecret() != "" {
+		t.Error("Expected the secret not to be returned")
+	}
+
+	user, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+		Role: userspb.Role_MEMBER,
+		Name: "Foo",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add user: %s", err)
+	}
+	_, err = directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+		User: &userspb.User{
+			Id:   user.GetId(),
+			Name: "Bar",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update user: %s", err)
+	}
+	_, err = directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+		Id: user.GetId(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete user: %s", err)
+	}
+
+	listDeliveries := func(t *testing.T, webhookID string, state userspb.DeliveryState) []*userspb.WebhookDelivery {
+		t.Helper()
+		resp, err := directory.ListDeliveries(ctx, &userspb.ListDeliveriesRequest{
+			WebhookId: webhookID,
+			State:     state,
+		})
+		if err != nil {
+			t.Fatalf("Failed to list deliveries: %s", err)
+		}
+		return resp.GetDeliveries()
+	}
+	var succeeded, dead []*userspb.WebhookDelivery
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		succeeded = listDeliveries(t, webhook.GetId(), userspb.DeliveryState_SUCCEEDED)
+		dead = listDeliveries(t, deadWebhook.GetId(), userspb.DeliveryState_DEAD)
+		if len(succeeded) == 2 && len(dead) == 1 {
+			break
+		}
+	}
+	if len(succeeded) != 2 || len(dead) != 1 {
+		t.Fatalf("Expected 2 succeeded and 1 dead deliveries, got %v and %v", succeeded, dead)
+	}
+	if dead[0].GetAttempts() != 2 || dead[0].GetLastStatusCode() != http.StatusInternalServerError {
+		t.Errorf("Dead delivery was not as expected: %v", dead[0])
+	}
+	if all := listDeliveries(t, "", userspb.DeliveryState_DELIVERY_STATE_UNSPECIFIED); len(all) != 3 {
+		t.Errorf("Expected 3 deliveries in total, got %d", len(all))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+	// Deliveries are attempted concurrently, so they may arrive in any order.
+	eventID := func(i int) int64 {
+		id, _ := strconv.ParseInt(requests[i].header.Get("Idempotency-Key"), 10, 64)
+		return id
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return eventID(i) < eventID(j)
+	})
+	for i, wantType := range []string{users.EventUserCreated, users.EventUserDeleted} {
+		req := requests[i]
+		timestamp, err := strconv.ParseInt(req.header.Get("Webhook-Timestamp"), 10, 64)
+		if err != nil {
+			t.Fatalf("Failed to parse timestamp: %s", err)
+		}
+		want := users.WebhookSignature(webhook.GetSecret(), time.Unix(timestamp, 0), req.body)
+		if !hmac.Equal([]byte(want), []byte(req.header.Get("Webhook-Signature"))) {
+			t.Errorf("Request %d had an invalid signature", i)
+		}
+		var event users.OutboxEvent
+		err = json.Unmarshal(req.body, &event)
+		if err != nil {
+			t.Fatalf("Failed to decode event: %s", err)
+		}
+		if event.Type != wantType || event.UserID != user.GetId() {
+			t.Errorf("Request %d was not as expected: %s", i, req.body)
+		}
+		if req.header.Get("Idempotency-Key") != strconv.FormatInt(event.ID, 10) {
+			t.Errorf("Expected the event ID as idempotency key, got %q", req.header.Get("Idempotency-Key"))
+		}
+	}
+}
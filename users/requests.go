@@ -0,0 +1,111 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+const maxRequestIDLength = 128
+
+// addUserOnce adds the user, recording the request ID in the same
+// transaction. If the request ID was already recorded, the user added
+// by the first request is returned instead.
+func (d Directory) addUserOnce(ctx context.Context, req *userspb.AddUserRequest, params AddUserParams) (_ *userspb.User, retErr error) {
+	if len(req.GetRequestId()) > maxRequestIDLength {
+		return nil, status.Errorf(codes.InvalidArgument, "request ID must be at most %d characters", maxRequestIDLength)
+	}
+	hash, err := requestHash(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error starting transaction: %s", err.Error())
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+	querier := New(tx)
+
+	// Concurrent requests with the same request ID block here
+	// until the first one commits or rolls back.
+	n, err := querier.CreateAddUserRequest(ctx, CreateAddUserRequestParams{
+		RequestID:   req.GetRequestId(),
+		UserID:      params.ID,
+		RequestHash: hash,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error recording request: %s", err.Error())
+	}
+	if n == 0 {
+		err = tx.Rollback()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unexpected error rolling back transaction: %s", err.Error())
+		}
+		return d.repeatedAddUser(ctx, req, hash)
+	}
+
+	user, err := addUserTx(ctx, querier, params)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Don't record the request, since no user was added.
+			err = tx.Rollback()
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "unexpected error rolling back transaction: %s", err.Error())
+			}
+			return d.existingUser(ctx, req, params.ID)
+		}
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing user: %s", err.Error())
+	}
+	return user, nil
+}
+
+// repeatedAddUser returns the user added by the first request with
+// the request ID.
+func (d Directory) repeatedAddUser(ctx context.Context, req *userspb.AddUserRequest, hash []byte) (*userspb.User, error) {
+	pgReq, err := d.querier.GetAddUserRequest(ctx, req.GetRequestId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error getting request: %s", err.Error())
+	}
+	if !bytes.Equal(pgReq.RequestHash, hash) {
+		return nil, status.Errorf(codes.InvalidArgument, "request ID %q was used for a different request", req.GetRequestId())
+	}
+	pgUser, err := d.querier.GetUser(ctx, pgReq.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "user added by request %q no longer exists", req.GetRequestId())
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+	}
+	return userPostgresToProto(pgUser)
+}
+
+// requestHash identifies the contents of the request, other than the
+// request ID, so that reuse of request IDs can be detected.
+func requestHash(req *userspb.AddUserRequest) ([]byte, error) {
+	req = proto.Clone(req).(*userspb.AddUserRequest)
+	req.RequestId = ""
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error hashing request: %s", err.Error())
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
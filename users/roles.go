@@ -0,0 +1,419 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgtype"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+const (
+	maxRoleNameLength   = 63
+	maxPermissions      = 256
+	maxPermissionLength = 255
+)
+
+var (
+	roleNamePattern = regexp.MustCompile(`^[a-z][-a-z0-9_]*$`)
+	// permissionPattern matches dot separated names, optionally ending
+	// in a wildcard, or a lone wildcard.
+	permissionPattern = regexp.MustCompile(`^([a-z][a-z0-9_]*\.)*([a-z][a-z0-9_]*|\*)$`)
+)
+
+// roleDefinitionColumns are the columns of the roles table, in the order
+// expected by scanRoleDefinition.
+var roleDefinitionColumns = []string{
+	"name",
+	"description",
+	"permissions",
+	"builtin",
+	"create_time",
+	"version",
+}
+
+// scanRoleDefinition scans a row selected with roleDefinitionColumns.
+func scanRoleDefinition(row rowScanner) (RoleDefinition, error) {
+	var pgRole RoleDefinition
+	err := row.Scan(
+		&pgRole.Name,
+		&pgRole.Description,
+		&pgRole.Permissions,
+		&pgRole.Builtin,
+		&pgRole.CreateTime,
+		&pgRole.Version,
+	)
+	return pgRole, err
+}
+
+func roleDefinitionPostgresToProto(pgRole RoleDefinition) (*userspb.RoleDefinition, error) {
+	var permissions []string
+	err := json.Unmarshal(pgRole.Permissions, &permissions)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode permissions: %s", err.Error())
+	}
+	return &userspb.RoleDefinition{
+		Name:        pgRole.Name,
+		Description: pgRole.Description,
+		Permissions: permissions,
+		Builtin:     pgRole.Builtin,
+		CreateTime:  timestamppb.New(pgRole.CreateTime),
+		Etag:        versionEtag(pgRole.Version),
+	}, nil
+}
+
+func roleAssignmentPostgresToProto(pgUserRole UserRole) (*userspb.RoleAssignment, error) {
+	var userID string
+	err := pgUserRole.UserID.AssignTo(&userID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	return &userspb.RoleAssignment{
+		UserId:     userID,
+		Role:       pgUserRole.RoleName,
+		CreateTime: timestamppb.New(pgUserRole.CreateTime),
+	}, nil
+}
+
+func validateRoleName(name string) error {
+	if len(name) > maxRoleNameLength || !roleNamePattern.MatchString(name) {
+		return status.Errorf(codes.InvalidArgument, "invalid role name %q", name)
+	}
+	return nil
+}
+
+// encodePermissions validates the permissions and encodes them as JSON.
+func encodePermissions(permissions []string) (json.RawMessage, error) {
+	if len(permissions) > maxPermissions {
+		return nil, status.Errorf(codes.InvalidArgument, "roles can have at most %d permissions", maxPermissions)
+	}
+	for _, permission := range permissions {
+		if len(permission) > maxPermissionLength || !permissionPattern.MatchString(permission) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid permission %q", permission)
+		}
+	}
+	if permissions == nil {
+		// Avoid encoding as null.
+		permissions = []string{}
+	}
+	b, err := json.Marshal(permissions)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error encoding permissions: %s", err.Error())
+	}
+	return b, nil
+}
+
+// grantsPermission returns whether the granted permission, which
+// may end in a wildcard, grants the requested permission.
+func grantsPermission(granted, requested string) bool {
+	if prefix, ok := strings.CutSuffix(granted, "*"); ok {
+		return strings.HasPrefix(requested, prefix)
+	}
+	return granted == requested
+}
+
+// CreateRole creates a custom role.
+func (d Directory) CreateRole(ctx context.Context, req *userspb.CreateRoleRequest) (*userspb.RoleDefinition, error) {
+	err := validateRoleName(req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := encodePermissions(req.GetPermissions())
+	if err != nil {
+		return nil, err
+	}
+	pgRole, err := d.querier.CreateRole(ctx, CreateRoleParams{
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+		Permissions: permissions,
+	})
+	if err != nil {
+		if err := uniqueViolationError(err); err != nil {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error creating role: %s", err.Error())
+	}
+	return roleDefinitionPostgresToProto(pgRole)
+}
+
+// GetRole gets the role, if found.
+func (d Directory) GetRole(ctx context.Context, req *userspb.GetRoleRequest) (*userspb.RoleDefinition, error) {
+	pgRole, err := d.getRole(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return roleDefinitionPostgresToProto(pgRole)
+}
+
+func (d Directory) getRole(ctx context.Context, name string) (RoleDefinition, error) {
+	pgRole, err := d.querier.GetRole(ctx, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return RoleDefinition{}, status.Errorf(codes.NotFound, "role %q not found", name)
+		}
+		return RoleDefinition{}, status.Errorf(codes.Internal, "unexpected error getting role: %s", err.Error())
+	}
+	return pgRole, nil
+}
+
+// UpdateRole updates the fields of the role selected by the update mask.
+func (d Directory) UpdateRole(ctx context.Context, req *userspb.UpdateRoleRequest) (*userspb.RoleDefinition, error) {
+	name := req.GetRole().GetName()
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		if req.GetRole().GetDescription() != "" {
+			paths = append(paths, "description")
+		}
+		if len(req.GetRole().GetPermissions()) > 0 {
+			paths = append(paths, "permissions")
+		}
+	}
+
+	var updateDescription, updatePermissions bool
+	for _, path := range paths {
+		switch path {
+		case "*":
+			updateDescription, updatePermissions = true, true
+		case "description":
+			updateDescription = true
+		case "permissions":
+			updatePermissions = true
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported update mask path %q", path)
+		}
+	}
+	if !updateDescription && !updatePermissions {
+		return nil, status.Error(codes.InvalidArgument, "no fields to update")
+	}
+
+	version, err := parseEtag(req.GetRole().GetEtag())
+	if err != nil {
+		return nil, err
+	}
+
+	q := d.sb.Update(
+		"roles",
+	).Set(
+		"version", squirrel.Expr("version + 1"),
+	).Where(
+		squirrel.Eq{"name": name, "builtin": false},
+	).Suffix(
+		"RETURNING " + strings.Join(roleDefinitionColumns, ", "),
+	)
+	if version != 0 {
+		q = q.Where(squirrel.Eq{"version": version})
+	}
+	if updateDescription {
+		q = q.Set("description", req.GetRole().GetDescription())
+	}
+	if updatePermissions {
+		permissions, err := encodePermissions(req.GetRole().GetPermissions())
+		if err != nil {
+			return nil, err
+		}
+		q = q.Set("permissions", permissions)
+	}
+
+	pgRole, err := scanRoleDefinition(q.QueryRowContext(ctx))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, d.roleNotChanged(ctx, name, version)
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error updating role: %s", err.Error())
+	}
+	return roleDefinitionPostgresToProto(pgRole)
+}
+
+// DeleteRole deletes the role, if found and not assigned to any users.
+func (d Directory) DeleteRole(ctx context.Context, req *userspb.DeleteRoleRequest) (*userspb.RoleDefinition, error) {
+	version, err := parseEtag(req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+	pgRole, err := d.querier.DeleteRole(ctx, DeleteRoleParams{
+		Name:    req.GetName(),
+		Version: version,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, d.roleNotChanged(ctx, req.GetName(), version)
+		}
+		if isForeignKeyViolation(err) {
+			return nil, status.Errorf(codes.FailedPrecondition, "role %q is assigned to users", req.GetName())
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error deleting role: %s", err.Error())
+	}
+	return roleDefinitionPostgresToProto(pgRole)
+}
+
+// roleNotChanged explains why a mutation of the role matched no rows,
+// returning FAILED_PRECONDITION for built-in roles, ABORTED if the role
+// exists with a version other than the one provided, and NOT_FOUND
+// otherwise.
+func (d Directory) roleNotChanged(ctx context.Context, name string, version int64) error {
+	pgRole, err := d.getRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if pgRole.Builtin {
+		return status.Errorf(codes.FailedPrecondition, "built-in role %q cannot be changed", name)
+	}
+	if version != 0 && pgRole.Version != version {
+		return status.Error(codes.Aborted, "etag does not match the current role, it was changed concurrently")
+	}
+	return status.Errorf(codes.NotFound, "role %q not found", name)
+}
+
+// ListRoles lists all roles. There are few enough roles
+// that they are not paginated.
+func (d Directory) ListRoles(ctx context.Context, _ *userspb.ListRolesRequest) (*userspb.ListRolesResponse, error) {
+	pgRoles, err := d.querier.ListRoles(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error listing roles: %s", err.Error())
+	}
+	resp := new(userspb.ListRolesResponse)
+	for _, pgRole := range pgRoles {
+		role, err := roleDefinitionPostgresToProto(pgRole)
+		if err != nil {
+			return nil, err
+		}
+		resp.Roles = append(resp.Roles, role)
+	}
+	return resp, nil
+}
+
+// AssignRole assigns the role to the user.
+func (d Directory) AssignRole(ctx context.Context, req *userspb.AssignRoleRequest) (*userspb.RoleAssignment, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	pgUserRole, err := d.querier.AssignRole(ctx, AssignRoleParams{
+		UserID:   userID,
+		RoleName: req.GetRole(),
+	})
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, status.Errorf(codes.NotFound, "role %q not found", req.GetRole())
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Errorf(codes.Internal, "unexpected error assigning role: %s", err.Error())
+		}
+		// The role is either already assigned, or the user doesn't exist.
+		pgUserRole, err = d.querier.GetRoleAssignment(ctx, GetRoleAssignmentParams{
+			UserID:   userID,
+			RoleName: req.GetRole(),
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, status.Error(codes.NotFound, "user not found")
+			}
+			return nil, status.Errorf(codes.Internal, "unexpected error getting role assignment: %s", err.Error())
+		}
+	}
+	return roleAssignmentPostgresToProto(pgUserRole)
+}
+
+// UnassignRole removes the role from the user.
+func (d Directory) UnassignRole(ctx context.Context, req *userspb.UnassignRoleRequest) (*userspb.RoleAssignment, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	pgUserRole, err := d.querier.UnassignRole(ctx, UnassignRoleParams{
+		UserID:   userID,
+		RoleName: req.GetRole(),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "role assignment not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error unassigning role: %s", err.Error())
+	}
+	return roleAssignmentPostgresToProto(pgUserRole)
+}
+
+// ListUserRoles lists the roles of the user.
+func (d Directory) ListUserRoles(ctx context.Context, req *userspb.ListUserRolesRequest) (*userspb.ListUserRolesResponse, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	pgRoles, err := d.userRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(userspb.ListUserRolesResponse)
+	for _, pgRole := range pgRoles {
+		role, err := roleDefinitionPostgresToProto(pgRole)
+		if err != nil {
+			return nil, err
+		}
+		resp.Roles = append(resp.Roles, role)
+	}
+	return resp, nil
+}
+
+// userRoles returns the roles of the user, which must exist.
+func (d Directory) userRoles(ctx context.Context, userID pgtype.UUID) ([]RoleDefinition, error) {
+	pgRoles, err := d.querier.ListUserRoles(ctx, userID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error listing user roles: %s", err.Error())
+	}
+	if len(pgRoles) == 0 {
+		// Every user has the built-in role of its role column.
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return pgRoles, nil
+}
+
+// CheckPermission returns whether any role of the user grants the permission.
+func (d Directory) CheckPermission(ctx context.Context, req *userspb.CheckPermissionRequest) (*userspb.CheckPermissionResponse, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	if req.GetPermission() == "" || strings.HasSuffix(req.GetPermission(), "*") || !permissionPattern.MatchString(req.GetPermission()) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid permission %q", req.GetPermission())
+	}
+	pgUser, err := d.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(userspb.CheckPermissionResponse)
+	if pgUser.DeleteTime.Valid {
+		return resp, nil
+	}
+	pgRoles, err := d.userRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, pgRole := range pgRoles {
+		var permissions []string
+		err := json.Unmarshal(pgRole.Permissions, &permissions)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to decode permissions: %s", err.Error())
+		}
+		for _, permission := range permissions {
+			if grantsPermission(permission, req.GetPermission()) {
+				resp.Allowed = true
+				resp.GrantedBy = append(resp.GrantedBy, pgRole.Name)
+				break
+			}
+		}
+	}
+	return resp, nil
+}
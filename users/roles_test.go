@@ -0,0 +1,73 @@
+package users
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGrantsPermission(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		granted   string
+		requested string
+		want      bool
+	}{
+		{granted: "users.get", requested: "users.get", want: true},
+		{granted: "users.get", requested: "users.list", want: false},
+		{granted: "users.*", requested: "users.get", want: true},
+		{granted: "users.*", requested: "users.labels.update", want: true},
+		{granted: "users.*", requested: "groups.get", want: false},
+		{granted: "users.*", requested: "users", want: false},
+		{granted: "users.*", requested: "usersx.get", want: false},
+		{granted: "*", requested: "groups.members.add", want: true},
+	}
+	for _, tt := range tests {
+		if got := grantsPermission(tt.granted, tt.requested); got != tt.want {
+			t.Errorf("grantsPermission(%q, %q) = %t, want %t", tt.granted, tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestEncodePermissions(t *testing.T) {
+	t.Parallel()
+
+	got, err := encodePermissions(nil)
+	if err != nil {
+		t.Fatalf("Failed to encode permissions: %s", err)
+	}
+	if string(got) != "[]" {
+		t.Errorf("Expected empty permissions to encode as [], got %s", got)
+	}
+	got, err = encodePermissions([]string{"users.get", "groups.*", "*"})
+	if err != nil {
+		t.Fatalf("Failed to encode permissions: %s", err)
+	}
+	if string(got) != `["users.get","groups.*","*"]` {
+		t.Errorf("Permissions were not as expected: %s", got)
+	}
+
+	for _, permission := range []string{"", "Users.get", "users..get", "users.*.get", "users.", ".users", "users*"} {
+		_, err := encodePermissions([]string{permission})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for permission %q, got %v", permission, err)
+		}
+	}
+}
+
+func TestValidateRoleName(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"auditor", "support-tier_2"} {
+		if err := validateRoleName(name); err != nil {
+			t.Errorf("Expected role name %q to be valid, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "2fa", "Auditor", "a.b", string(make([]byte, 64))} {
+		if err := validateRoleName(name); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for role name %q, got %v", name, err)
+		}
+	}
+}
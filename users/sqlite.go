@@ -0,0 +1,1186 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgtype"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+// SQLiteStore is a Store keeping users in a SQLite database file, for
+// single node and embedded deployments. It has the same semantics as
+// the Postgres store, except that strings are ordered byte by byte, as
+// with the C collation, and that changes are neither recorded in the
+// audit log nor published. Only the changes made through the store can
+// be watched, not those of other processes sharing the database file.
+type SQLiteStore struct {
+	db             *sql.DB
+	sb             squirrel.StatementBuilderType
+	logger         *slog.Logger
+	newID          func() (pgtype.UUID, error)
+	purgeRetention time.Duration
+	stopPurge      context.CancelFunc
+	purgeDone      chan struct{}
+	watchers       *watchHub
+	// commitMu is held while transactions commit and emit their
+	// changes to the watchers, so that they are emitted in order.
+	commitMu sync.Mutex
+}
+
+func init() {
+	// SQLite's lower only folds ASCII letters, while Postgres
+	// folds all letters, as does strings.ToLower.
+	sqlite.MustRegisterDeterministicScalarFunction("unicode_lower", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return args[0], nil
+		}
+		return strings.ToLower(s), nil
+	})
+}
+
+// sqliteBatchSize is the number of users inserted per statement by
+// BulkAddUsers, standing in for the COPY protocol of Postgres.
+const sqliteBatchSize = 500
+
+// NewSQLiteStore opens the SQLite database at the path of the URL,
+// e.g. sqlite:///var/lib/users.db, creating it if it doesn't exist. Like
+// a Directory, it generates the IDs of new users as set by
+// WithIDStrategy, and purges deleted users as set by WithPurgeRetention,
+// along with expired add user requests and import chunks. Options that
+// don't apply to a SQLiteStore are ignored.
+func NewSQLiteStore(logger *slog.Logger, dbURL *url.URL, opts ...Option) (*SQLiteStore, error) {
+	path := dbURL.Host + dbURL.Path
+	if path == "" {
+		return nil, errors.New("sqlite URL must include the path of the database file")
+	}
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	// Wait for concurrent writers, rather than failing immediately.
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	// Take the write lock when transactions begin, so that
+	// transactions reading before writing can't deadlock.
+	params.Set("_txlock", "immediate")
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("opening sqlite database: %w", err)
+	}
+
+	err = validateSchema(db, "sqlite")
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("validating schema: %w", err)
+	}
+
+	cfg := storeConfig(opts)
+	s := &SQLiteStore{
+		db:             db,
+		sb:             squirrel.StatementBuilder.PlaceholderFormat(squirrel.Question).RunWith(db),
+		logger:         logger,
+		newID:          cfg.newID,
+		purgeRetention: cfg.purgeRetention,
+		purgeDone:      make(chan struct{}),
+		watchers:       newWatchHub(logger, listenLocal),
+	}
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	s.stopPurge = stopPurge
+	go s.purgeLoop(purgeCtx)
+	return s, nil
+}
+
+// sqliteUserColumns are the columns of the users table, in the order
+// expected by scanSQLiteUser.
+var sqliteUserColumns = strings.Join(userColumns, ", ")
+
+// scanSQLiteUser scans a row selected with sqliteUserColumns.
+func scanSQLiteUser(row rowScanner) (User, error) {
+	var (
+		id         []byte
+		role       int64
+		createTime int64
+		deleteTime sql.NullInt64
+		labels     []byte
+		attributes []byte
+		pgUser     User
+	)
+	err := row.Scan(
+		&id,
+		&role,
+		&createTime,
+		&pgUser.Name,
+		&deleteTime,
+		&pgUser.Version,
+		&labels,
+		&attributes,
+		&pgUser.Email,
+	)
+	if err != nil {
+		return User{}, err
+	}
+	err = pgUser.ID.Set(id)
+	if err != nil {
+		return User{}, fmt.Errorf("invalid user ID: %w", err)
+	}
+	pgUser.Role, err = sqliteRole(role)
+	if err != nil {
+		return User{}, err
+	}
+	pgUser.CreateTime = time.UnixMicro(createTime)
+	if deleteTime.Valid {
+		pgUser.DeleteTime = sql.NullTime{Time: time.UnixMicro(deleteTime.Int64), Valid: true}
+	}
+	pgUser.Labels = labels
+	pgUser.Attributes = attributes
+	return pgUser, nil
+}
+
+// sqliteRole returns the role stored as its position in roleOrder.
+func sqliteRole(rank int64) (Role, error) {
+	for role, r := range roleOrder {
+		if int64(r) == rank {
+			return role, nil
+		}
+	}
+	return "", fmt.Errorf("unknown role %d", rank)
+}
+
+// sqliteTime returns the time as stored, in microseconds since the
+// epoch, the precision of Postgres.
+func sqliteTime(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+// sqliteEmailKey returns the key by which the email is unique, since
+// SQLite's lower only folds ASCII letters.
+func sqliteEmailKey(email sql.NullString) sql.NullString {
+	return sql.NullString{String: strings.ToLower(email.String), Valid: email.Valid}
+}
+
+// sqliteUniqueViolationError returns ALREADY_EXISTS if the error is a
+// unique constraint violation, and nil otherwise.
+func sqliteUniqueViolationError(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+	default:
+		return nil
+	}
+	if strings.Contains(sqliteErr.Error(), "users.email_key") {
+		return status.Error(codes.AlreadyExists, "a user with the same email already exists")
+	}
+	return status.Error(codes.AlreadyExists, "a user with the same ID already exists")
+}
+
+// beginTx starts a transaction, which takes the write lock.
+func (s *SQLiteStore) beginTx(ctx context.Context) (*sql.Tx, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error starting transaction: %s", err.Error())
+	}
+	return tx, nil
+}
+
+// commit commits the transaction, then emits the events reporting its
+// changes to the watchers.
+func (s *SQLiteStore) commit(tx *sql.Tx, events ...*userspb.UserEvent) error {
+	// The transaction holds the write lock, so other
+	// transactions commit in turn.
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+	err := tx.Commit()
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		s.watchers.emit(event)
+	}
+	return nil
+}
+
+// getUser returns the user with the ID, or sql.ErrNoRows.
+func (s *SQLiteStore) getUser(ctx context.Context, db DBTX, userID [16]byte) (User, error) {
+	return scanSQLiteUser(db.QueryRowContext(ctx,
+		"SELECT "+sqliteUserColumns+" FROM users WHERE id = ?", userID[:],
+	))
+}
+
+// lockedUser returns the user with the ID, in a transaction holding the
+// write lock. If a version is provided, the user must be at that version.
+func (s *SQLiteStore) lockedUser(ctx context.Context, tx *sql.Tx, userID [16]byte, version int64) (User, error) {
+	pgUser, err := s.getUser(ctx, tx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, status.Error(codes.NotFound, "user not found")
+		}
+		return User{}, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+	}
+	if version != 0 && pgUser.Version != version {
+		return User{}, status.Error(codes.Aborted, "etag does not match the current user, it was changed concurrently")
+	}
+	return pgUser, nil
+}
+
+// AddUser adds a user to the store. Requests with a request ID, or the
+// ID of an existing user, can be retried without adding the user twice.
+func (s *SQLiteStore) AddUser(ctx context.Context, req *userspb.AddUserRequest) (_ *userspb.User, retErr error) {
+	params, err := addUserParams(req, s.newID)
+	if err != nil {
+		return nil, err
+	}
+	var hash []byte
+	if req.GetRequestId() != "" {
+		if len(req.GetRequestId()) > maxRequestIDLength {
+			return nil, status.Errorf(codes.InvalidArgument, "request ID must be at most %d characters", maxRequestIDLength)
+		}
+		hash, err = requestHash(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+
+	if hash != nil {
+		var userID, prevHash []byte
+		err = tx.QueryRowContext(ctx,
+			"SELECT user_id, request_hash FROM add_user_requests WHERE request_id = ?", req.GetRequestId(),
+		).Scan(&userID, &prevHash)
+		switch {
+		case err == nil:
+			if !bytes.Equal(prevHash, hash) {
+				return nil, status.Errorf(codes.InvalidArgument, "request ID %q was used for a different request", req.GetRequestId())
+			}
+			pgUser, err := s.getUser(ctx, tx, [16]byte(userID))
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil, status.Errorf(codes.NotFound, "user added by request %q no longer exists", req.GetRequestId())
+				}
+				return nil, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+			}
+			return userPostgresToProto(pgUser)
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, status.Errorf(codes.Internal, "unexpected error getting request: %s", err.Error())
+		}
+	}
+
+	now := sqliteTime(memoryNow())
+	pgUser, err := scanSQLiteUser(tx.QueryRowContext(ctx,
+		"INSERT INTO users (id, role, create_time, name, labels, attributes, email, email_key) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING RETURNING "+sqliteUserColumns,
+		params.ID.Bytes[:], roleOrder[params.Role], now, params.Name,
+		string(params.Labels), string(params.Attributes), params.Email, sqliteEmailKey(params.Email),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Don't record the request, since no user was added.
+			existing, err := s.getUser(ctx, tx, params.ID.Bytes)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+			}
+			return matchExistingUser(req, existing)
+		}
+		if err := sqliteUniqueViolationError(err); err != nil {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error adding user: %s", err.Error())
+	}
+	if hash != nil {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO add_user_requests (request_id, user_id, request_hash, create_time) VALUES (?, ?, ?, ?)",
+			req.GetRequestId(), params.ID.Bytes[:], hash, now,
+		)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unexpected error recording request: %s", err.Error())
+		}
+	}
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	err = s.commit(tx, userEvent(userspb.UserEventType_CREATED, user, pgUser.CreateTime))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing user: %s", err.Error())
+	}
+	return user, nil
+}
+
+// BulkAddUsers adds the users returned by next, until it returns io.EOF,
+// in a single transaction. The users are inserted in batches, rather
+// than read into memory first, though the events reporting them are held
+// until the transaction commits.
+func (s *SQLiteStore) BulkAddUsers(ctx context.Context, next func() (*userspb.AddUserRequest, error), opts AddUsersOptions) (_ *userspb.AddUsersResponse, retErr error) {
+	var onConflict string
+	switch opts.ConflictMode {
+	case "", ConflictModeError:
+	case ConflictModeIgnore:
+		onConflict = " ON CONFLICT (id) DO NOTHING"
+	case ConflictModeUpdate:
+		// Deleted users are neither updated nor counted.
+		onConflict = " ON CONFLICT (id) DO UPDATE SET " +
+			"role = excluded.role, name = excluded.name, labels = excluded.labels, " +
+			"attributes = excluded.attributes, email = excluded.email, email_key = excluded.email_key, " +
+			"version = users.version + 1 " +
+			"WHERE users.delete_time IS NULL"
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid conflict mode %q", opts.ConflictMode)
+	}
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+
+	src := &usersSource{
+		getUser:        next,
+		newID:          s.newID,
+		reportFailures: opts.ReportFailures,
+	}
+	// Users added together are created at the same time,
+	// like users added in the same transaction.
+	now := sqliteTime(memoryNow())
+	resp := new(userspb.AddUsersResponse)
+	var (
+		added  [][16]byte
+		batch  []AddUserParams
+		events []*userspb.UserEvent
+	)
+	insert := func() error {
+		pgUsers, err := s.insertUsers(ctx, tx, batch, now, onConflict)
+		if err != nil {
+			return err
+		}
+		resp.Count += int64(len(pgUsers))
+		batchEvents, err := sqliteUserEvents(pgUsers, now)
+		if err != nil {
+			return err
+		}
+		events = append(events, batchEvents...)
+		batch = batch[:0]
+		return nil
+	}
+	for src.Next() {
+		batch = append(batch, src.next)
+		added = append(added, src.next.ID.Bytes)
+		if len(batch) == sqliteBatchSize {
+			err = insert()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = src.Err()
+	if err != nil {
+		return nil, err
+	}
+	if len(batch) > 0 {
+		err = insert()
+		if err != nil {
+			return nil, err
+		}
+	}
+	resp.Failures = src.failures
+
+	if opts.ReturnUsers {
+		for _, userID := range added {
+			pgUser, err := s.getUser(ctx, tx, userID)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+			}
+			user, err := userPostgresToProto(pgUser)
+			if err != nil {
+				return nil, err
+			}
+			resp.Users = append(resp.Users, user)
+		}
+	}
+
+	err = s.commit(tx, events...)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing users: %s", err.Error())
+	}
+	return resp, nil
+}
+
+// sqliteUserEvents returns the events reporting the users inserted or
+// updated by insertUsers at the time provided. Inserted users are at the
+// first version, while updates bump it.
+func sqliteUserEvents(pgUsers []User, now int64) ([]*userspb.UserEvent, error) {
+	events := make([]*userspb.UserEvent, 0, len(pgUsers))
+	for _, pgUser := range pgUsers {
+		user, err := userPostgresToProto(pgUser)
+		if err != nil {
+			return nil, err
+		}
+		eventType := userspb.UserEventType_CREATED
+		if pgUser.Version > 1 {
+			eventType = userspb.UserEventType_UPDATED
+		}
+		events = append(events, userEvent(eventType, user, time.UnixMicro(now)))
+	}
+	return events, nil
+}
+
+// insertUsers inserts the users with a single statement, handling
+// conflicts with the clause provided, and returns the users inserted or
+// updated.
+func (s *SQLiteStore) insertUsers(ctx context.Context, tx *sql.Tx, batch []AddUserParams, now int64, onConflict string) (_ []User, retErr error) {
+	var query strings.Builder
+	query.WriteString("INSERT INTO users (id, role, create_time, name, labels, attributes, email, email_key) VALUES ")
+	args := make([]interface{}, 0, len(batch)*8)
+	for i := range batch {
+		// Refer to the batch, since the ID is sliced.
+		p := &batch[i]
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, p.ID.Bytes[:], roleOrder[p.Role], now, p.Name, string(p.Labels), string(p.Attributes), p.Email, sqliteEmailKey(p.Email))
+	}
+	query.WriteString(onConflict)
+	query.WriteString(" RETURNING " + sqliteUserColumns)
+
+	rows, err := tx.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, insertUsersError(err)
+	}
+	defer func() {
+		cerr := rows.Close()
+		if retErr == nil && cerr != nil {
+			retErr = status.Error(codes.Internal, cerr.Error())
+		}
+	}()
+	var pgUsers []User
+	for rows.Next() {
+		pgUser, err := scanSQLiteUser(rows)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		pgUsers = append(pgUsers, pgUser)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, insertUsersError(err)
+	}
+	return pgUsers, nil
+}
+
+func insertUsersError(err error) error {
+	if err := sqliteUniqueViolationError(err); err != nil {
+		return err
+	}
+	return status.Errorf(codes.Internal, "unexpected error inserting users: %s", err.Error())
+}
+
+// ImportChunk adds the users of the chunk, after the previous chunk of
+// the import, recording the chunk and its acknowledgement in the same
+// transaction. If the chunk was already committed, the recorded
+// acknowledgement is returned instead.
+func (s *SQLiteStore) ImportChunk(ctx context.Context, req *userspb.ImportUsersRequest, reportFailures bool) (_ *userspb.ImportUsersResponse, retErr error) {
+	err := validateImportChunk(req)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := chunkHash(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+
+	var firstRow int64
+	if req.GetChunk() > 0 {
+		var prevFirstRow, prevRowCount int64
+		err = tx.QueryRowContext(ctx,
+			"SELECT first_row, row_count FROM import_chunks WHERE import_id = ? AND chunk = ?",
+			req.GetImportId(), req.GetChunk()-1,
+		).Scan(&prevFirstRow, &prevRowCount)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, status.Errorf(codes.FailedPrecondition, "chunk %d of import %q has not been committed", req.GetChunk()-1, req.GetImportId())
+			}
+			return nil, status.Errorf(codes.Internal, "unexpected error getting previous chunk: %s", err.Error())
+		}
+		firstRow = prevFirstRow + prevRowCount
+	}
+
+	var prevHash, recorded []byte
+	err = tx.QueryRowContext(ctx,
+		"SELECT request_hash, response FROM import_chunks WHERE import_id = ? AND chunk = ?",
+		req.GetImportId(), req.GetChunk(),
+	).Scan(&prevHash, &recorded)
+	switch {
+	case err == nil:
+		if !bytes.Equal(prevHash, hash) {
+			return nil, status.Errorf(codes.InvalidArgument, "chunk %d of import %q was committed with different users", req.GetChunk(), req.GetImportId())
+		}
+		resp := new(userspb.ImportUsersResponse)
+		err = protojson.Unmarshal(recorded, resp)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unexpected error decoding acknowledgement: %s", err.Error())
+		}
+		resp.AlreadyCommitted = true
+		return resp, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, status.Errorf(codes.Internal, "unexpected error getting committed chunk: %s", err.Error())
+	}
+
+	reqs := req.GetUsers()
+	src := &usersSource{
+		getUser: func() (*userspb.AddUserRequest, error) {
+			if len(reqs) == 0 {
+				return nil, io.EOF
+			}
+			req := reqs[0]
+			reqs = reqs[1:]
+			return req, nil
+		},
+		newID:          s.newID,
+		reportFailures: reportFailures,
+		index:          firstRow,
+	}
+	var batch []AddUserParams
+	for src.Next() {
+		batch = append(batch, src.next)
+	}
+	err = src.Err()
+	if err != nil {
+		return nil, err
+	}
+	now := sqliteTime(memoryNow())
+	var pgUsers []User
+	for start := 0; start < len(batch); start += sqliteBatchSize {
+		inserted, err := s.insertUsers(ctx, tx, batch[start:min(start+sqliteBatchSize, len(batch))], now, "")
+		if err != nil {
+			return nil, err
+		}
+		pgUsers = append(pgUsers, inserted...)
+	}
+	events, err := sqliteUserEvents(pgUsers, now)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &userspb.ImportUsersResponse{
+		Chunk:    req.GetChunk(),
+		FirstRow: firstRow,
+		RowCount: int64(len(req.GetUsers())),
+		Count:    int64(len(pgUsers)),
+		Ids:      src.ids,
+		Failures: src.failures,
+	}
+	recorded, err = protojson.Marshal(resp)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error encoding acknowledgement: %s", err.Error())
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO import_chunks (import_id, chunk, first_row, row_count, request_hash, response, create_time) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?)",
+		req.GetImportId(), req.GetChunk(), firstRow, resp.GetRowCount(), hash, string(recorded), now,
+	)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error recording chunk: %s", err.Error())
+	}
+	err = s.commit(tx, events...)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing chunk: %s", err.Error())
+	}
+	return resp, nil
+}
+
+// UpdateUser updates the fields of the user selected by the update mask.
+// Soft deleted users cannot be updated.
+func (s *SQLiteStore) UpdateUser(ctx context.Context, req *userspb.UpdateUserRequest) (_ *userspb.User, retErr error) {
+	u, err := parseUserUpdate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+
+	pgUser, err := s.lockedUser(ctx, tx, u.userID.Bytes, u.version)
+	if err != nil {
+		return nil, err
+	}
+	if pgUser.DeleteTime.Valid {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	pgUser = u.apply(pgUser)
+	_, err = tx.ExecContext(ctx,
+		"UPDATE users SET role = ?, name = ?, labels = ?, attributes = ?, email = ?, email_key = ?, version = ? WHERE id = ?",
+		roleOrder[pgUser.Role], pgUser.Name, string(pgUser.Labels), string(pgUser.Attributes),
+		pgUser.Email, sqliteEmailKey(pgUser.Email), pgUser.Version, u.userID.Bytes[:],
+	)
+	if err != nil {
+		if err := sqliteUniqueViolationError(err); err != nil {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error updating user: %s", err.Error())
+	}
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	err = s.commit(tx, userEvent(userspb.UserEventType_UPDATED, user, memoryNow()))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing update: %s", err.Error())
+	}
+	return user, nil
+}
+
+// DeleteUser deletes the user, if found. Users are soft deleted unless
+// force is set, in which case they are deleted permanently, even if they
+// were already soft deleted.
+func (s *SQLiteStore) DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (_ *userspb.User, retErr error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	version, err := parseEtag(req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+
+	pgUser, err := s.lockedUser(ctx, tx, userID.Bytes, version)
+	if err != nil {
+		return nil, err
+	}
+	// Deleting soft deleted users was already reported.
+	report := !pgUser.DeleteTime.Valid
+	now := memoryNow()
+	if req.GetForce() {
+		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userID.Bytes[:])
+	} else {
+		if pgUser.DeleteTime.Valid {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		pgUser, err = scanSQLiteUser(tx.QueryRowContext(ctx,
+			"UPDATE users SET delete_time = ?, version = version + 1 WHERE id = ? RETURNING "+sqliteUserColumns,
+			sqliteTime(now), userID.Bytes[:],
+		))
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error deleting user: %s", err.Error())
+	}
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	var events []*userspb.UserEvent
+	if report {
+		events = append(events, userEvent(userspb.UserEventType_DELETED, user, now))
+	}
+	err = s.commit(tx, events...)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing deletion: %s", err.Error())
+	}
+	return user, nil
+}
+
+// UndeleteUser restores a soft deleted user, if it hasn't been purged.
+func (s *SQLiteStore) UndeleteUser(ctx context.Context, req *userspb.UndeleteUserRequest) (_ *userspb.User, retErr error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	version, err := parseEtag(req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+
+	pgUser, err := s.lockedUser(ctx, tx, userID.Bytes, version)
+	if err != nil {
+		return nil, err
+	}
+	if !pgUser.DeleteTime.Valid {
+		return nil, status.Error(codes.FailedPrecondition, "user is not deleted")
+	}
+	pgUser, err = scanSQLiteUser(tx.QueryRowContext(ctx,
+		"UPDATE users SET delete_time = NULL, version = version + 1 WHERE id = ? RETURNING "+sqliteUserColumns,
+		userID.Bytes[:],
+	))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error undeleting user: %s", err.Error())
+	}
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	err = s.commit(tx, userEvent(userspb.UserEventType_UPDATED, user, memoryNow()))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing undeletion: %s", err.Error())
+	}
+	return user, nil
+}
+
+// GetUser gets the user, if found. Soft deleted users are returned too.
+func (s *SQLiteStore) GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	pgUser, err := s.getUser(ctx, s.db, userID.Bytes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+	}
+	return userPostgresToProto(pgUser)
+}
+
+// GetUserByEmail gets the user with the email address, ignoring case,
+// if found.
+func (s *SQLiteStore) GetUserByEmail(ctx context.Context, req *userspb.GetUserByEmailRequest) (*userspb.User, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email must be set")
+	}
+	pgUser, err := scanSQLiteUser(s.db.QueryRowContext(ctx,
+		"SELECT "+sqliteUserColumns+" FROM users WHERE email_key = ?", sqliteEmailKey(emailParam(req.GetEmail())),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+	}
+	return userPostgresToProto(pgUser)
+}
+
+// BatchGetUsers gets several users at once. The results are returned in
+// the same order as the requested IDs, with IDs that could not be found
+// reported as such.
+func (s *SQLiteStore) BatchGetUsers(ctx context.Context, req *userspb.BatchGetUsersRequest) (_ *userspb.BatchGetUsersResponse, retErr error) {
+	userIDs, err := batchGetUserIDs(req)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]interface{}, 0, len(userIDs))
+	for i := range userIDs {
+		ids = append(ids, userIDs[i].Bytes[:])
+	}
+	rows, err := s.sb.Select(
+		userColumns...,
+	).From(
+		"users",
+	).Where(
+		squirrel.Eq{"id": ids},
+	).QueryContext(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error getting users: %s", err.Error())
+	}
+	defer func() {
+		cerr := rows.Close()
+		if retErr == nil && cerr != nil {
+			retErr = status.Error(codes.Internal, cerr.Error())
+		}
+	}()
+	var pgUsers []User
+	for rows.Next() {
+		pgUser, err := scanSQLiteUser(rows)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		pgUsers = append(pgUsers, pgUser)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error getting users: %s", err.Error())
+	}
+	return batchGetUsersResponse(req, userIDs, pgUsers)
+}
+
+// QueryUsers calls fn for each user selected by the query, in order.
+func (s *SQLiteStore) QueryUsers(ctx context.Context, uq UserQuery, fn func(*userspb.User) error) (retErr error) {
+	order, err := parseOrderBy(uq.Request.GetOrderBy())
+	if err != nil {
+		return err
+	}
+	q := s.sb.Select(
+		userColumns...,
+	).From(
+		"users",
+	).OrderBy(
+		orderByClauses(order)...,
+	)
+	q, err = applySQLiteListFilters(q, uq.Request)
+	if err != nil {
+		return err
+	}
+	if uq.After != nil {
+		cursor, err := cursorUser(uq.After)
+		if err != nil {
+			return err
+		}
+		q = q.Where(afterCursor(order, map[string]interface{}{
+			"create_time": sqliteTime(cursor.CreateTime),
+			"id":          cursor.ID.Bytes[:],
+			"name":        cursor.Name,
+			"role":        roleOrder[cursor.Role],
+		}))
+	}
+	if uq.Limit > 0 {
+		q = q.Limit(uint64(uq.Limit))
+	}
+
+	rows, err := q.QueryContext(ctx)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer func() {
+		cerr := rows.Close()
+		if retErr == nil && cerr != nil {
+			retErr = status.Error(codes.Internal, cerr.Error())
+		}
+	}()
+
+	for rows.Next() {
+		pgUser, err := scanSQLiteUser(rows)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		user, err := userPostgresToProto(pgUser)
+		if err != nil {
+			return err
+		}
+		err = fn(user)
+		if err != nil {
+			return err
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// CountUsers counts the users subject to the request filters.
+func (s *SQLiteStore) CountUsers(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.CountUsersResponse, error) {
+	q, err := applySQLiteListFilters(s.sb.Select("count(*)").From("users"), req)
+	if err != nil {
+		return nil, err
+	}
+	var count int64
+	err = q.QueryRowContext(ctx).Scan(&count)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error counting users: %s", err.Error())
+	}
+	return &userspb.CountUsersResponse{
+		Count: count,
+	}, nil
+}
+
+// GetUserStats computes the number of users per role and a histogram of
+// user creation times, subject to the request filters. The statistics
+// are computed from a single query, so they add up.
+func (s *SQLiteStore) GetUserStats(ctx context.Context, req *userspb.GetUserStatsRequest) (_ *userspb.GetUserStatsResponse, retErr error) {
+	bucket, err := parseTimeBucket(req.GetBucket())
+	if err != nil {
+		return nil, err
+	}
+	query := req.GetQuery()
+	if query == nil {
+		query = new(userspb.ListUsersRequest)
+	}
+	q, err := applySQLiteListFilters(s.sb.Select("role", "create_time").From("users"), query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.QueryContext(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error computing statistics: %s", err.Error())
+	}
+	defer func() {
+		cerr := rows.Close()
+		if retErr == nil && cerr != nil {
+			retErr = status.Error(codes.Internal, cerr.Error())
+		}
+	}()
+	stats := newUserStats(bucket)
+	for rows.Next() {
+		var rank, createTime int64
+		err = rows.Scan(&rank, &createTime)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		role, err := sqliteRole(rank)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		stats.add(role, time.UnixMicro(createTime))
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return stats.response()
+}
+
+// WatchUserEvents calls fn for each change made through the store, as
+// they happen, until fn fails or the context is cancelled.
+func (s *SQLiteStore) WatchUserEvents(ctx context.Context, fn func(*userspb.UserEvent) error) error {
+	return s.watchers.watch(ctx, fn)
+}
+
+// applySQLiteListFilters applies the filters of the request to the query,
+// like applyListFilters does for Postgres.
+func applySQLiteListFilters(q squirrel.SelectBuilder, req *userspb.ListUsersRequest) (squirrel.SelectBuilder, error) {
+	if !req.GetShowDeleted() {
+		q = q.Where(squirrel.Eq{
+			"delete_time": nil,
+		})
+	}
+	if req.GetLabelSelector() != "" {
+		pred, err := sqliteLabelSelector(req.GetLabelSelector())
+		if err != nil {
+			return q, err
+		}
+		q = q.Where(pred)
+	}
+	// Times are compared with the precision of Postgres.
+	if req.GetCreatedSince() != nil {
+		q = q.Where(squirrel.Gt{
+			"create_time": sqliteTime(req.GetCreatedSince().AsTime()),
+		})
+	}
+	if req.GetOlderThan() != nil {
+		q = q.Where(squirrel.Lt{
+			"create_time": sqliteTime(time.Now()) - req.GetOlderThan().AsDuration().Microseconds(),
+		})
+	}
+	if req.GetCreatedBefore() != nil {
+		q = q.Where(squirrel.Lt{
+			"create_time": sqliteTime(req.GetCreatedBefore().AsTime()),
+		})
+	}
+	if len(req.GetRoles()) > 0 {
+		roles := make([]int, 0, len(req.GetRoles()))
+		for _, role := range req.GetRoles() {
+			pgRole, err := roleProtoToPostgres(role)
+			if err != nil {
+				return q, err
+			}
+			roles = append(roles, roleOrder[pgRole])
+		}
+		q = q.Where(squirrel.Eq{
+			"role": roles,
+		})
+	}
+	if prefix := req.GetNamePrefix(); prefix != "" {
+		// Unlike LIKE, substr is case sensitive.
+		q = q.Where("substr(name, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix)
+	}
+	if req.GetNameContains() != "" {
+		q = q.Where("instr(unicode_lower(name), ?) > 0", strings.ToLower(req.GetNameContains()))
+	}
+	expr, err := parseFilter(req.GetFilter())
+	if err != nil {
+		return q, err
+	}
+	if expr != nil {
+		pred, err := filterToSql(expr, comparisonToSQLite)
+		if err != nil {
+			return q, err
+		}
+		q = q.Where(pred)
+	}
+	return q, nil
+}
+
+// comparisonToSQLite translates a comparison into a SQLite predicate,
+// comparing the values as stored by SQLiteStore.
+func comparisonToSQLite(c comparison) (squirrel.Sqlizer, error) {
+	field, value, err := comparisonValue(c)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case string:
+		if c.op == ":" {
+			return squirrel.Expr("instr(unicode_lower("+field.column+"), ?) > 0", strings.ToLower(v)), nil
+		}
+	case pgtype.UUID:
+		value = v.Bytes[:]
+	case Role:
+		value = roleOrder[v]
+	case pgtype.Timestamptz:
+		value = sqliteTime(v.Time)
+	}
+	return compareColumn(field.column, c.op, value), nil
+}
+
+// sqliteLabelSelector translates a label selector into a predicate on
+// the labels, which are stored as JSON objects.
+func sqliteLabelSelector(selector string) (squirrel.Sqlizer, error) {
+	requirements, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	const hasLabel = "EXISTS (SELECT 1 FROM json_each(users.labels) WHERE key = ?"
+	var and squirrel.And
+	for _, r := range requirements {
+		switch r.op {
+		case "=":
+			and = append(and, squirrel.Expr(hasLabel+" AND value = ?)", r.key, r.value))
+		case "!=":
+			and = append(and, squirrel.Expr("NOT "+hasLabel+" AND value = ?)", r.key, r.value))
+		case "exists":
+			and = append(and, squirrel.Expr(hasLabel+")", r.key))
+		case "!exists":
+			and = append(and, squirrel.Expr("NOT "+hasLabel+")", r.key))
+		}
+	}
+	return and, nil
+}
+
+// Close stops purging, drops all watchers and closes the database.
+func (s *SQLiteStore) Close() error {
+	s.stopPurge()
+	<-s.purgeDone
+	s.watchers.close()
+	return s.db.Close()
+}
+
+// purgeLoop periodically purges the database, until the context is
+// cancelled.
+func (s *SQLiteStore) purgeLoop(ctx context.Context) {
+	defer close(s.purgeDone)
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		s.purge(ctx, time.Now())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// purge permanently deletes users soft deleted longer than the retention
+// before now, if enabled, and import chunks and add user requests recorded
+// longer than importRetention and requestRetention before now, like the
+// purge of the Directory.
+func (s *SQLiteStore) purge(ctx context.Context, now time.Time) {
+	if s.purgeRetention > 0 {
+		purged, err := s.purgeDeletedUsers(ctx, sqliteTime(now.Add(-s.purgeRetention)))
+		logPurge(ctx, s.logger, "deleted users", purged, err)
+	}
+	purged, err := s.exec(ctx,
+		"DELETE FROM import_chunks WHERE create_time < ?", sqliteTime(now.Add(-importRetention)),
+	)
+	logPurge(ctx, s.logger, "import chunks", purged, err)
+	purged, err = s.exec(ctx,
+		"DELETE FROM add_user_requests WHERE create_time < ?", sqliteTime(now.Add(-requestRetention)),
+	)
+	logPurge(ctx, s.logger, "add user requests", purged, err)
+}
+
+// purgeDeletedUsers permanently deletes users soft deleted before the
+// cutoff, in batches, returning the number of users deleted.
+func (s *SQLiteStore) purgeDeletedUsers(ctx context.Context, cutoff int64) (int64, error) {
+	var total int64
+	for {
+		n, err := s.exec(ctx,
+			"DELETE FROM users WHERE id IN (SELECT id FROM users WHERE delete_time < ? LIMIT ?)",
+			cutoff, purgeBatchSize,
+		)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// exec executes the statement, returning the number of rows affected.
+func (s *SQLiteStore) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
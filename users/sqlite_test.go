@@ -0,0 +1,77 @@
+package users
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+func TestSQLiteStorePurge(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	store, err := NewSQLiteStore(log, &url.URL{
+		Scheme: "sqlite",
+		Path:   filepath.Join(t.TempDir(), "users.db"),
+	}, WithPurgeRetention(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to open the SQLite store: %s", err)
+	}
+	t.Cleanup(func() {
+		err := store.Close()
+		if err != nil {
+			t.Errorf("Failed to close the SQLite store: %s", err)
+		}
+	})
+	ctx := context.Background()
+
+	req := &userspb.AddUserRequest{Name: "alice", Email: "alice@example.com", RequestId: "add-alice"}
+	alice, err := store.AddUser(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to add user: %s", err)
+	}
+	bobReq := &userspb.AddUserRequest{Name: "bob", RequestId: "add-bob"}
+	bob, err := store.AddUser(ctx, bobReq)
+	if err != nil {
+		t.Fatalf("Failed to add user: %s", err)
+	}
+	_, err = store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: alice.GetId()})
+	if err != nil {
+		t.Fatalf("Failed to delete user: %s", err)
+	}
+
+	store.purge(ctx, time.Now().Add(30*time.Minute))
+	_, err = store.AddUser(ctx, req)
+	if err != nil {
+		t.Fatalf("Expected the request to be recognised before it expires: %s", err)
+	}
+
+	store.purge(ctx, time.Now().Add(2*time.Hour))
+	_, err = store.AddUser(ctx, req)
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected the purged user to be gone, got %v", err)
+	}
+	// The email of the purged user is free again.
+	_, err = store.AddUser(ctx, &userspb.AddUserRequest{Name: "alicia", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to add user with the email of the purged user: %s", err)
+	}
+
+	store.purge(ctx, time.Now().Add(requestRetention+time.Hour))
+	again, err := store.AddUser(ctx, bobReq)
+	if err != nil {
+		t.Fatalf("Expected the expired request ID to be reusable: %s", err)
+	}
+	if again.GetId() == bob.GetId() {
+		t.Error("Expected a new user to be added for the expired request ID")
+	}
+}
@@ -0,0 +1,237 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+// timeBucket is a bucket of the creation histogram.
+type timeBucket struct {
+	// unit is the unit of date_trunc.
+	unit string
+	// truncate truncates a time in UTC like date_trunc, for stores
+	// computing the histogram themselves.
+	truncate func(time.Time) time.Time
+}
+
+var timeBuckets = map[userspb.TimeBucket]timeBucket{
+	userspb.TimeBucket_HOUR: {
+		unit: "hour",
+		truncate: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, time.UTC)
+		},
+	},
+	userspb.TimeBucket_DAY: {
+		unit: "day",
+		truncate: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		},
+	},
+	userspb.TimeBucket_WEEK: {
+		unit: "week",
+		truncate: func(t time.Time) time.Time {
+			// Weeks start on Monday, as with date_trunc.
+			daysSinceMonday := (int(t.Weekday()) + 6) % 7
+			return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+		},
+	},
+	userspb.TimeBucket_MONTH: {
+		unit: "month",
+		truncate: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		},
+	},
+}
+
+// parseTimeBucket returns the bucket of the creation histogram requested.
+func parseTimeBucket(bucket userspb.TimeBucket) (timeBucket, error) {
+	tb, ok := timeBuckets[bucket]
+	if !ok {
+		return timeBucket{}, status.Errorf(codes.InvalidArgument, "unknown time bucket %q", bucket)
+	}
+	return tb, nil
+}
+
+// userStats accumulates the statistics of GetUserStats, for stores
+// computing them from the users rather than in the database.
+type userStats struct {
+	bucket    timeBucket
+	count     int64
+	roles     map[Role]int64
+	histogram map[time.Time]int64
+}
+
+func newUserStats(bucket timeBucket) *userStats {
+	return &userStats{
+		bucket:    bucket,
+		roles:     map[Role]int64{},
+		histogram: map[time.Time]int64{},
+	}
+}
+
+// add counts a user with the role, created at the time provided.
+func (s *userStats) add(role Role, createTime time.Time) {
+	s.count++
+	s.roles[role]++
+	s.histogram[s.bucket.truncate(createTime.UTC())]++
+}
+
+// response returns the statistics, ordered like those of the Directory.
+func (s *userStats) response() (*userspb.GetUserStatsResponse, error) {
+	resp := &userspb.GetUserStatsResponse{
+		Count: s.count,
+	}
+	for role, count := range s.roles {
+		protoRole, err := rolePostgresToProto(role)
+		if err != nil {
+			return nil, err
+		}
+		resp.RoleCounts = append(resp.RoleCounts, &userspb.RoleCount{
+			Role:  protoRole,
+			Count: count,
+		})
+	}
+	sort.Slice(resp.RoleCounts, func(i, j int) bool {
+		return resp.RoleCounts[i].GetRole() < resp.RoleCounts[j].GetRole()
+	})
+	for start, count := range s.histogram {
+		resp.CreationHistogram = append(resp.CreationHistogram, &userspb.CreationBucket{
+			StartTime: timestamppb.New(start),
+			Count:     count,
+		})
+	}
+	sort.Slice(resp.CreationHistogram, func(i, j int) bool {
+		return resp.CreationHistogram[i].GetStartTime().AsTime().Before(resp.CreationHistogram[j].GetStartTime().AsTime())
+	})
+	return resp, nil
+}
+
+// CountUsers counts the users in the directory, subject to the request filters.
+func (d Directory) CountUsers(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.CountUsersResponse, error) {
+	q, err := applyListFilters(d.sb.Select("count(*)").From("users"), req)
+	if err != nil {
+		return nil, err
+	}
+	var count int64
+	err = q.QueryRowContext(ctx).Scan(&count)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error counting users: %s", err.Error())
+	}
+	return &userspb.CountUsersResponse{
+		Count: count,
+	}, nil
+}
+
+// GetUserStats computes the number of users per role and a histogram of
+// user creation times, subject to the request filters.
+func (d Directory) GetUserStats(ctx context.Context, req *userspb.GetUserStatsRequest) (_ *userspb.GetUserStatsResponse, retErr error) {
+	tb, err := parseTimeBucket(req.GetBucket())
+	if err != nil {
+		return nil, err
+	}
+
+	query := req.GetQuery()
+	if query == nil {
+		query = new(userspb.ListUsersRequest)
+	}
+
+	// Compute all statistics from the same snapshot, so they add up.
+	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error starting transaction: %s", err.Error())
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+	sb := d.sb.RunWith(tx)
+
+	resp := new(userspb.GetUserStatsResponse)
+
+	roleQuery, err := applyListFilters(
+		sb.Select("role", "count(*)").From("users").GroupBy("role").OrderBy("role"),
+		query,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := roleQuery.QueryContext(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error counting roles: %s", err.Error())
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pgRole Role
+		var count int64
+		err = rows.Scan(&pgRole, &count)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		protoRole, err := rolePostgresToProto(pgRole)
+		if err != nil {
+			return nil, err
+		}
+		resp.RoleCounts = append(resp.RoleCounts, &userspb.RoleCount{
+			Role:  protoRole,
+			Count: count,
+		})
+		resp.Count += count
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// The unit is interpolated rather than passed as an argument
+	// so that the select and group by expressions are identical.
+	// It's safe, since it's one of the constants above.
+	bucket := "date_trunc('" + tb.unit + "', create_time AT TIME ZONE 'UTC')"
+	histogramQuery, err := applyListFilters(
+		sb.Select(bucket, "count(*)").From("users").GroupBy(bucket).OrderBy(bucket),
+		query,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rows, err = histogramQuery.QueryContext(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error computing histogram: %s", err.Error())
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var start time.Time
+		var count int64
+		err = rows.Scan(&start, &count)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		resp.CreationHistogram = append(resp.CreationHistogram, &userspb.CreationBucket{
+			// The bucket has no time zone, but is in UTC.
+			StartTime: timestamppb.New(time.Date(
+				start.Year(), start.Month(), start.Day(),
+				start.Hour(), start.Minute(), start.Second(), start.Nanosecond(),
+				time.UTC,
+			)),
+			Count: count,
+		})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
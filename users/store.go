@@ -0,0 +1,322 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+// Store stores users. Directory is the Postgres implementation, while
+// MemoryStore and SQLiteStore implement the same semantics in memory and
+// in a SQLite database.
+// Errors are gRPC status errors.
+type Store interface {
+	// AddUser adds a user. Requests with a request ID, or the ID of an
+	// existing user, can be retried without adding the user twice.
+	AddUser(ctx context.Context, req *userspb.AddUserRequest) (*userspb.User, error)
+	// BulkAddUsers adds the users returned by next, until it returns
+	// io.EOF. Either all valid users are added, or none are.
+	BulkAddUsers(ctx context.Context, next func() (*userspb.AddUserRequest, error), opts AddUsersOptions) (*userspb.AddUsersResponse, error)
+	// ImportChunk adds the users of a chunk of an import, after the
+	// previous chunk. Committed chunks are acknowledged again, rather
+	// than imported twice.
+	ImportChunk(ctx context.Context, req *userspb.ImportUsersRequest, reportFailures bool) (*userspb.ImportUsersResponse, error)
+	// UpdateUser updates the fields of the user selected by the update
+	// mask. Soft deleted users cannot be updated.
+	UpdateUser(ctx context.Context, req *userspb.UpdateUserRequest) (*userspb.User, error)
+	// DeleteUser deletes the user, if found. Users are soft deleted
+	// unless force is set, in which case they are deleted permanently.
+	DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (*userspb.User, error)
+	// UndeleteUser restores a soft deleted user.
+	UndeleteUser(ctx context.Context, req *userspb.UndeleteUserRequest) (*userspb.User, error)
+	// GetUser gets the user, even if soft deleted.
+	GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error)
+	// GetUserByEmail gets the user with the email, ignoring case.
+	GetUserByEmail(ctx context.Context, req *userspb.GetUserByEmailRequest) (*userspb.User, error)
+	// BatchGetUsers gets several users, in the order requested.
+	BatchGetUsers(ctx context.Context, req *userspb.BatchGetUsersRequest) (*userspb.BatchGetUsersResponse, error)
+	// QueryUsers calls fn for each user selected by the query, in order.
+	QueryUsers(ctx context.Context, q UserQuery, fn func(*userspb.User) error) error
+	// CountUsers counts the users subject to the request filters.
+	CountUsers(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.CountUsersResponse, error)
+	// GetUserStats computes statistics of the users subject to the
+	// request filters.
+	GetUserStats(ctx context.Context, req *userspb.GetUserStatsRequest) (*userspb.GetUserStatsResponse, error)
+	// WatchUserEvents calls fn for each change to users, as they happen,
+	// until fn fails or the context is cancelled.
+	WatchUserEvents(ctx context.Context, fn func(*userspb.UserEvent) error) error
+	// Close releases any resources.
+	Close() error
+}
+
+var (
+	_ Store = Directory{}
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*SQLiteStore)(nil)
+)
+
+// storeConfig returns a Directory configured by the options, from which
+// MemoryStore and SQLiteStore take the configuration they share with it.
+func storeConfig(opts []Option) *Directory {
+	d := &Directory{
+		newID:          IDStrategyRandom.generator(),
+		purgeRetention: defaultPurgeRetention,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// UserQuery selects users to list.
+type UserQuery struct {
+	// Request holds the filters and order of the users. Its page size
+	// and tokens are ignored.
+	Request *userspb.ListUsersRequest
+	// After, if set, continues the listing right after this user, in
+	// the order of the request. Only the fields ordered by, and the ID,
+	// need to be set.
+	After *userspb.User
+	// Limit is the maximum number of users to list, or 0 for no limit.
+	Limit int
+}
+
+// UserServer serves the UserService from a Store.
+type UserServer struct {
+	userspb.UnimplementedUserServiceServer
+
+	store        Store
+	pageTokenKey []byte
+}
+
+// NewUserServer creates a server for the users of the store. Page tokens
+// are signed with the key. If the key is nil, a random key is generated,
+// and page tokens are only valid for the lifetime of the server.
+func NewUserServer(store Store, pageTokenKey []byte) (*UserServer, error) {
+	if pageTokenKey == nil {
+		pageTokenKey = make([]byte, 32)
+		_, err := rand.Read(pageTokenKey)
+		if err != nil {
+			return nil, fmt.Errorf("generating page token key: %w", err)
+		}
+	}
+	return &UserServer{
+		store:        store,
+		pageTokenKey: pageTokenKey,
+	}, nil
+}
+
+// AddUser adds a user to the store.
+func (s *UserServer) AddUser(ctx context.Context, req *userspb.AddUserRequest) (*userspb.User, error) {
+	err := rejectAddUsersOptions(ctx, "AddUser", ReturnUsersKey, ValidationModeKey, ConflictModeKey)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.AddUser(ctx, req)
+}
+
+// AddUsers adds all the users sent, configured by the request metadata.
+func (s *UserServer) AddUsers(srv userspb.UserService_AddUsersServer) error {
+	opts, err := addUsersOptions(srv.Context())
+	if err != nil {
+		return err
+	}
+	resp, err := s.store.BulkAddUsers(srv.Context(), srv.Recv, opts)
+	if err != nil {
+		return err
+	}
+	return srv.SendAndClose(resp)
+}
+
+// ImportUsers adds users in chunks, committing and acknowledging each
+// chunk in turn. Since the next chunk is only received once the previous
+// one is acknowledged, clients are slowed down to the pace of the store.
+func (s *UserServer) ImportUsers(srv userspb.UserService_ImportUsersServer) error {
+	err := rejectAddUsersOptions(srv.Context(), "ImportUsers", ReturnUsersKey, ConflictModeKey)
+	if err != nil {
+		return err
+	}
+	opts, err := addUsersOptions(srv.Context())
+	if err != nil {
+		return err
+	}
+	for {
+		req, err := srv.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		resp, err := s.store.ImportChunk(srv.Context(), req, opts.ReportFailures)
+		if err != nil {
+			return err
+		}
+		err = srv.Send(resp)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// UpdateUser updates the fields of the user selected by the update mask.
+func (s *UserServer) UpdateUser(ctx context.Context, req *userspb.UpdateUserRequest) (*userspb.User, error) {
+	return s.store.UpdateUser(ctx, req)
+}
+
+// DeleteUser deletes the user, if found.
+func (s *UserServer) DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (*userspb.User, error) {
+	return s.store.DeleteUser(ctx, req)
+}
+
+// UndeleteUser restores a soft deleted user.
+func (s *UserServer) UndeleteUser(ctx context.Context, req *userspb.UndeleteUserRequest) (*userspb.User, error) {
+	return s.store.UndeleteUser(ctx, req)
+}
+
+// GetUser gets the user, if found.
+func (s *UserServer) GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	return s.store.GetUser(ctx, req)
+}
+
+// GetUserByEmail gets the user with the email address, if found.
+func (s *UserServer) GetUserByEmail(ctx context.Context, req *userspb.GetUserByEmailRequest) (*userspb.User, error) {
+	return s.store.GetUserByEmail(ctx, req)
+}
+
+// BatchGetUsers gets several users at once.
+func (s *UserServer) BatchGetUsers(ctx context.Context, req *userspb.BatchGetUsersRequest) (*userspb.BatchGetUsersResponse, error) {
+	return s.store.BatchGetUsers(ctx, req)
+}
+
+// ListUsers streams the users subject to the request filters. If
+// requested, each user carries a resume token that can be used to
+// continue the stream right after it, should it be interrupted.
+func (s *UserServer) ListUsers(req *userspb.ListUsersRequest, srv userspb.UserService_ListUsersServer) error {
+	q, order, filter, err := s.userQuery(req)
+	if err != nil {
+		return err
+	}
+	if req.GetPageSize() < 0 {
+		return status.Error(codes.InvalidArgument, "page size must not be negative")
+	}
+	q.Limit = int(req.GetPageSize())
+
+	return s.store.QueryUsers(srv.Context(), q, func(user *userspb.User) error {
+		if req.GetIncludeResumeTokens() {
+			token, err := s.encodeUserToken(user, order, filter)
+			if err != nil {
+				return status.Errorf(codes.Internal, "failed to create resume token: %s", err.Error())
+			}
+			user.ResumeToken = token
+		}
+		err := srv.Send(user)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		return nil
+	})
+}
+
+// ListUsersPage lists a single page of users subject to the request filters.
+func (s *UserServer) ListUsersPage(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.ListUsersPageResponse, error) {
+	q, order, filter, err := s.userQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	pageSize, err := normalizePageSize(req.GetPageSize())
+	if err != nil {
+		return nil, err
+	}
+	// Fetch one extra user to find out whether there is another page.
+	q.Limit = pageSize + 1
+
+	resp := new(userspb.ListUsersPageResponse)
+	err = s.store.QueryUsers(ctx, q, func(user *userspb.User) error {
+		resp.Users = append(resp.Users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Users) > pageSize {
+		resp.Users = resp.Users[:pageSize]
+		resp.NextPageToken, err = s.encodeUserToken(resp.Users[pageSize-1], order, filter)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to create page token: %s", err.Error())
+		}
+	}
+	return resp, nil
+}
+
+// CountUsers counts the users subject to the request filters.
+func (s *UserServer) CountUsers(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.CountUsersResponse, error) {
+	return s.store.CountUsers(ctx, req)
+}
+
+// GetUserStats computes statistics of the users subject to the request
+// filters.
+func (s *UserServer) GetUserStats(ctx context.Context, req *userspb.GetUserStatsRequest) (*userspb.GetUserStatsResponse, error) {
+	return s.store.GetUserStats(ctx, req)
+}
+
+// WatchUsers streams changes to users as they happen.
+func (s *UserServer) WatchUsers(_ *userspb.WatchUsersRequest, srv userspb.UserService_WatchUsersServer) error {
+	return s.store.WatchUserEvents(srv.Context(), func(event *userspb.UserEvent) error {
+		err := srv.Send(event)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		return nil
+	})
+}
+
+// userQuery returns the query for listing users subject to the request
+// filters, order and page or resume token. It also returns the order and
+// the hash of the filters, for use in any tokens issued for the request.
+func (s *UserServer) userQuery(req *userspb.ListUsersRequest) (UserQuery, []orderKey, []byte, error) {
+	q := UserQuery{Request: req}
+	order, err := parseOrderBy(req.GetOrderBy())
+	if err != nil {
+		return q, nil, nil, err
+	}
+	filter, err := filterHash(req)
+	if err != nil {
+		return q, nil, nil, status.Errorf(codes.Internal, "failed to hash filters: %s", err.Error())
+	}
+
+	token := req.GetPageToken()
+	if req.GetResumeToken() != "" {
+		if token != "" {
+			return q, nil, nil, status.Error(codes.InvalidArgument, "page token and resume token are mutually exclusive")
+		}
+		token = req.GetResumeToken()
+	}
+	if token != "" {
+		pt, err := decodePageToken(s.pageTokenKey, token, filter)
+		if err != nil {
+			return q, nil, nil, err
+		}
+		q.After, err = pt.user()
+		if err != nil {
+			return q, nil, nil, err
+		}
+	}
+	return q, order, filter, nil
+}
+
+// encodeUserToken returns a signed token continuing the listing after the user.
+func (s *UserServer) encodeUserToken(user *userspb.User, order []orderKey, filter []byte) (string, error) {
+	pt, err := userPageToken(user, order, filter)
+	if err != nil {
+		return "", err
+	}
+	return encodePageToken(s.pageTokenKey, pt)
+}
@@ -0,0 +1,1089 @@
+package users_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+	"github.com/johanbrandhorst/grpc-postgres/users"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	store := users.NewMemoryStore()
+	t.Cleanup(func() {
+		err := store.Close()
+		if err != nil {
+			t.Errorf("Failed to close the memory store: %s", err)
+		}
+	})
+	testStore(t, store)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	store, err := users.NewSQLiteStore(log, &url.URL{
+		Scheme: "sqlite",
+		Path:   filepath.Join(t.TempDir(), "users.db"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open the SQLite store: %s", err)
+	}
+	t.Cleanup(func() {
+		err := store.Close()
+		if err != nil {
+			t.Errorf("Failed to close the SQLite store: %s", err)
+		}
+	})
+	testStore(t, store)
+}
+
+func TestPostgresStore(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	testStore(t, directory)
+}
+
+// testStore runs the tests every Store must pass, against an empty store.
+// The subtests share the store, so each one labels its users with its
+// name, and only lists users with that label.
+func testStore(t *testing.T, store users.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	t.Run("AddUser", func(t *testing.T) {
+		req := &userspb.AddUserRequest{
+			Id:     "bbb0f5a8-29d7-4a4b-a1f5-1f0b5d1f3a9e",
+			Role:   userspb.Role_ADMIN,
+			Name:   "alice",
+			Labels: map[string]string{"case": "add-user", "team": "a"},
+			Attributes: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"age": structpb.NewNumberValue(42),
+			}},
+			Email: "alice@example.com",
+		}
+		user, err := store.AddUser(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		want := &userspb.User{
+			Id:         req.GetId(),
+			Role:       req.GetRole(),
+			Name:       req.GetName(),
+			Etag:       "1",
+			Labels:     req.GetLabels(),
+			Attributes: req.GetAttributes(),
+			Email:      req.GetEmail(),
+		}
+		if diff := cmp.Diff(want, user, protocmp.Transform(), protocmp.IgnoreFields(&userspb.User{}, "create_time")); diff != "" {
+			t.Errorf("User was not as expected:\n%s", diff)
+		}
+		if user.GetCreateTime() == nil {
+			t.Error("Expected the create time to be set")
+		}
+
+		again, err := store.AddUser(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to add the same user again: %s", err)
+		}
+		if diff := cmp.Diff(user, again, protocmp.Transform()); diff != "" {
+			t.Errorf("Expected the existing user:\n%s", diff)
+		}
+
+		for _, tt := range []struct {
+			name string
+			req  *userspb.AddUserRequest
+			code codes.Code
+		}{
+			{
+				name: "different user with the same ID",
+				req:  &userspb.AddUserRequest{Id: req.GetId(), Name: "bob"},
+				code: codes.AlreadyExists,
+			},
+			{
+				name: "same email in another case",
+				req:  &userspb.AddUserRequest{Name: "bob", Email: "ALICE@example.com"},
+				code: codes.AlreadyExists,
+			},
+			{
+				name: "invalid ID",
+				req:  &userspb.AddUserRequest{Id: "not-a-uuid", Name: "bob"},
+				code: codes.InvalidArgument,
+			},
+			{
+				name: "invalid label",
+				req:  &userspb.AddUserRequest{Name: "bob", Labels: map[string]string{"Team": "a"}},
+				code: codes.InvalidArgument,
+			},
+			{
+				name: "invalid email",
+				req:  &userspb.AddUserRequest{Name: "bob", Email: "bob"},
+				code: codes.InvalidArgument,
+			},
+		} {
+			_, err := store.AddUser(ctx, tt.req)
+			if status.Code(err) != tt.code {
+				t.Errorf("%s: expected %s, got %v", tt.name, tt.code, err)
+			}
+		}
+
+		// Emails are compared case insensitively beyond ASCII.
+		_, err = store.AddUser(ctx, &userspb.AddUserRequest{Name: "élodie", Email: "élodie@example.com"})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		_, err = store.AddUser(ctx, &userspb.AddUserRequest{Name: "Élodie", Email: "ÉLODIE@example.com"})
+		if status.Code(err) != codes.AlreadyExists {
+			t.Errorf("Expected the same email in another case to fail with AlreadyExists, got %v", err)
+		}
+	})
+
+	t.Run("AddUserRequestID", func(t *testing.T) {
+		req := &userspb.AddUserRequest{
+			Name:      "alice",
+			Labels:    map[string]string{"case": "request-id"},
+			RequestId: "request-1",
+		}
+		first, err := store.AddUser(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		second, err := store.AddUser(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to retry adding user: %s", err)
+		}
+		if diff := cmp.Diff(first, second, protocmp.Transform()); diff != "" {
+			t.Errorf("Expected the user added by the first request:\n%s", diff)
+		}
+		if got := listNames(t, store, &userspb.ListUsersRequest{LabelSelector: "case=request-id"}); len(got) != 1 {
+			t.Errorf("Expected a single user, got %v", got)
+		}
+		_, err = store.AddUser(ctx, &userspb.AddUserRequest{
+			Name:      "bob",
+			RequestId: req.GetRequestId(),
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected reusing the request ID to fail with InvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("BulkAddUsers", func(t *testing.T) {
+		labels := map[string]string{"case": "bulk"}
+		existing, err := store.AddUser(ctx, &userspb.AddUserRequest{
+			Name:   "alice",
+			Labels: labels,
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		deleted, err := store.AddUser(ctx, &userspb.AddUserRequest{
+			Name:   "bob",
+			Labels: labels,
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		_, err = store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: deleted.GetId()})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
+
+		resp, err := store.BulkAddUsers(ctx, requests(
+			&userspb.AddUserRequest{Name: "carol", Labels: labels},
+			&userspb.AddUserRequest{Name: "dave", Labels: labels, Email: "dave@example.com"},
+		), users.AddUsersOptions{ReturnUsers: true})
+		if err != nil {
+			t.Fatalf("Failed to add users: %s", err)
+		}
+		if resp.GetCount() != 2 || len(resp.GetUsers()) != 2 {
+			t.Fatalf("Expected 2 added users, got %v", resp)
+		}
+		if resp.GetUsers()[0].GetName() != "carol" || resp.GetUsers()[1].GetEmail() != "dave@example.com" {
+			t.Errorf("Added users were not as expected: %v", resp.GetUsers())
+		}
+
+		// Failing batches add no users.
+		for _, tt := range []struct {
+			name string
+			reqs []*userspb.AddUserRequest
+			code codes.Code
+		}{
+			{
+				name: "existing ID",
+				reqs: []*userspb.AddUserRequest{
+					{Name: "erin", Labels: labels},
+					{Id: existing.GetId(), Name: "alice", Labels: labels},
+				},
+				code: codes.AlreadyExists,
+			},
+			{
+				name: "existing email",
+				reqs: []*userspb.AddUserRequest{
+					{Name: "erin", Labels: labels},
+					{Name: "frank", Labels: labels, Email: "Dave@example.com"},
+				},
+				code: codes.AlreadyExists,
+			},
+			{
+				name: "invalid user",
+				reqs: []*userspb.AddUserRequest{
+					{Name: "erin", Labels: labels},
+					{Name: "frank", Labels: map[string]string{"-": ""}},
+				},
+				code: codes.InvalidArgument,
+			},
+			{
+				name: "request ID",
+				reqs: []*userspb.AddUserRequest{
+					{Name: "erin", Labels: labels},
+					{Name: "frank", Labels: labels, RequestId: "add-frank"},
+				},
+				code: codes.InvalidArgument,
+			},
+		} {
+			_, err := store.BulkAddUsers(ctx, requests(tt.reqs...), users.AddUsersOptions{})
+			if status.Code(err) != tt.code {
+				t.Errorf("%s: expected %s, got %v", tt.name, tt.code, err)
+			}
+		}
+		want := []string{"alice", "carol", "dave"}
+		if diff := cmp.Diff(want, listNames(t, store, &userspb.ListUsersRequest{LabelSelector: "case=bulk", OrderBy: "name"})); diff != "" {
+			t.Errorf("Users were not as expected:\n%s", diff)
+		}
+
+		resp, err = store.BulkAddUsers(ctx, requests(
+			&userspb.AddUserRequest{Name: "erin", Labels: labels},
+			&userspb.AddUserRequest{Name: "frank", Labels: map[string]string{"-": ""}},
+		), users.AddUsersOptions{ReportFailures: true})
+		if err != nil {
+			t.Fatalf("Failed to add users: %s", err)
+		}
+		if resp.GetCount() != 1 || len(resp.GetFailures()) != 1 || resp.GetFailures()[0].GetIndex() != 1 {
+			t.Errorf("Expected the second user to be reported, got %v", resp)
+		}
+
+		resp, err = store.BulkAddUsers(ctx, requests(
+			&userspb.AddUserRequest{Id: existing.GetId(), Name: "alicia", Labels: labels},
+			&userspb.AddUserRequest{Name: "gina", Labels: labels},
+		), users.AddUsersOptions{ConflictMode: users.ConflictModeIgnore})
+		if err != nil {
+			t.Fatalf("Failed to add users: %s", err)
+		}
+		if resp.GetCount() != 1 {
+			t.Errorf("Expected only the new user to be counted, got %d", resp.GetCount())
+		}
+
+		resp, err = store.BulkAddUsers(ctx, requests(
+			&userspb.AddUserRequest{Id: existing.GetId(), Role: userspb.Role_ADMIN, Name: "alicia", Labels: labels},
+			&userspb.AddUserRequest{Id: deleted.GetId(), Name: "robert", Labels: labels},
+		), users.AddUsersOptions{ConflictMode: users.ConflictModeUpdate, ReturnUsers: true})
+		if err != nil {
+			t.Fatalf("Failed to add users: %s", err)
+		}
+		if resp.GetCount() != 1 {
+			t.Errorf("Expected only the existing user to be counted, got %d", resp.GetCount())
+		}
+		if len(resp.GetUsers()) != 2 {
+			t.Fatalf("Expected 2 returned users, got %d", len(resp.GetUsers()))
+		}
+		updated := resp.GetUsers()[0]
+		if updated.GetName() != "alicia" || updated.GetRole() != userspb.Role_ADMIN || updated.GetEtag() != "2" {
+			t.Errorf("Expected the existing user to be updated, got %v", updated)
+		}
+		if resp.GetUsers()[1].GetName() != "bob" {
+			t.Errorf("Expected the deleted user not to be updated, got %v", resp.GetUsers()[1])
+		}
+
+		// Failing batches don't update users either.
+		_, err = store.BulkAddUsers(ctx, requests(
+			&userspb.AddUserRequest{Id: existing.GetId(), Name: "alison", Labels: labels, Email: "alison@example.com"},
+			&userspb.AddUserRequest{Name: "hank", Labels: labels, Email: "Alison@example.com"},
+		), users.AddUsersOptions{ConflictMode: users.ConflictModeUpdate})
+		if status.Code(err) != codes.AlreadyExists {
+			t.Errorf("Expected an existing email to fail with AlreadyExists, got %v", err)
+		}
+		_, err = store.AddUser(ctx, &userspb.AddUserRequest{Name: "ivan", Email: "alison@example.com"})
+		if err != nil {
+			t.Errorf("Expected the email of the failed batch to be free: %s", err)
+		}
+
+		want = []string{"alicia", "carol", "dave", "erin", "gina"}
+		if diff := cmp.Diff(want, listNames(t, store, &userspb.ListUsersRequest{LabelSelector: "case=bulk", OrderBy: "name"})); diff != "" {
+			t.Errorf("Users were not as expected:\n%s", diff)
+		}
+
+		_, err = store.BulkAddUsers(ctx, requests(), users.AddUsersOptions{ConflictMode: "replace"})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected an invalid conflict mode to fail with InvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("DeleteUser", func(t *testing.T) {
+		user, err := store.AddUser(ctx, &userspb.AddUserRequest{
+			Name:   "alice",
+			Labels: map[string]string{"case": "delete"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		_, err = store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: user.GetId(), Etag: "2"})
+		if status.Code(err) != codes.Aborted {
+			t.Errorf("Expected a stale etag to fail with Aborted, got %v", err)
+		}
+		deleted, err := store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: user.GetId(), Etag: user.GetEtag()})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
+		if deleted.GetDeleteTime() == nil || deleted.GetEtag() != "2" {
+			t.Errorf("Expected the user to be soft deleted, got %v", deleted)
+		}
+		_, err = store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: user.GetId()})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected deleting a deleted user to fail with NotFound, got %v", err)
+		}
+		if got := listNames(t, store, &userspb.ListUsersRequest{LabelSelector: "case=delete"}); len(got) != 0 {
+			t.Errorf("Expected deleted users to be hidden, got %v", got)
+		}
+		if got := listNames(t, store, &userspb.ListUsersRequest{LabelSelector: "case=delete", ShowDeleted: true}); len(got) != 1 {
+			t.Errorf("Expected deleted users to be shown, got %v", got)
+		}
+
+		forced, err := store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: user.GetId(), Force: true})
+		if err != nil {
+			t.Fatalf("Failed to force delete user: %s", err)
+		}
+		if diff := cmp.Diff(deleted, forced, protocmp.Transform()); diff != "" {
+			t.Errorf("Expected the deleted user:\n%s", diff)
+		}
+		if got := listNames(t, store, &userspb.ListUsersRequest{LabelSelector: "case=delete", ShowDeleted: true}); len(got) != 0 {
+			t.Errorf("Expected force deleted users to be gone, got %v", got)
+		}
+		_, err = store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: user.GetId(), Force: true})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected deleting a missing user to fail with NotFound, got %v", err)
+		}
+		_, err = store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: "not-a-uuid"})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected an invalid ID to fail with InvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("QueryUsers", func(t *testing.T) {
+		for _, req := range []*userspb.AddUserRequest{
+			{Name: "alice", Role: userspb.Role_ADMIN, Labels: map[string]string{"team": "a"}, Email: "alice@example.org"},
+			{Name: "bob", Role: userspb.Role_MEMBER, Labels: map[string]string{"team": "b"}},
+			{Name: "carol", Role: userspb.Role_GUEST, Labels: map[string]string{"team": "a"}, Email: "carol@example.org"},
+			{Name: "dave", Role: userspb.Role_MEMBER},
+			{Name: "ann", Role: userspb.Role_GUEST},
+		} {
+			if req.Labels == nil {
+				req.Labels = map[string]string{}
+			}
+			req.Labels["case"] = "query"
+			_, err := store.AddUser(ctx, req)
+			if err != nil {
+				t.Fatalf("Failed to add user: %s", err)
+			}
+		}
+
+		for _, tt := range []struct {
+			name string
+			req  *userspb.ListUsersRequest
+			want []string
+		}{
+			{
+				name: "name",
+				req:  &userspb.ListUsersRequest{OrderBy: "name"},
+				want: []string{"alice", "ann", "bob", "carol", "dave"},
+			},
+			{
+				name: "name descending",
+				req:  &userspb.ListUsersRequest{OrderBy: "name desc"},
+				want: []string{"dave", "carol", "bob", "ann", "alice"},
+			},
+			{
+				name: "role",
+				req:  &userspb.ListUsersRequest{OrderBy: "role desc, name"},
+				want: []string{"alice", "bob", "dave", "ann", "carol"},
+			},
+			{
+				name: "roles",
+				req:  &userspb.ListUsersRequest{OrderBy: "name", Roles: []userspb.Role{userspb.Role_GUEST, userspb.Role_ADMIN}},
+				want: []string{"alice", "ann", "carol"},
+			},
+			{
+				name: "name prefix",
+				req:  &userspb.ListUsersRequest{OrderBy: "name", NamePrefix: "a"},
+				want: []string{"alice", "ann"},
+			},
+			{
+				name: "name contains",
+				req:  &userspb.ListUsersRequest{OrderBy: "name", NameContains: "AR"},
+				want: []string{"carol"},
+			},
+			{
+				name: "labels",
+				req:  &userspb.ListUsersRequest{OrderBy: "name", LabelSelector: "team=a"},
+				want: []string{"alice", "carol"},
+			},
+			{
+				name: "missing label",
+				req:  &userspb.ListUsersRequest{OrderBy: "name", LabelSelector: "!team"},
+				want: []string{"ann", "dave"},
+			},
+			{
+				name: "other label value",
+				req:  &userspb.ListUsersRequest{OrderBy: "name", LabelSelector: "team!=a"},
+				want: []string{"ann", "bob", "dave"},
+			},
+			{
+				name: "filter",
+				req:  &userspb.ListUsersRequest{OrderBy: "name", Filter: `role = ADMIN OR name:"AV"`},
+				want: []string{"alice", "dave"},
+			},
+			{
+				name: "filter comparing names",
+				req:  &userspb.ListUsersRequest{OrderBy: "name", Filter: `name > "b" AND name <= "carol"`},
+				want: []string{"bob", "carol"},
+			},
+			{
+				// Comparisons with missing emails are neither true nor false.
+				name: "filter on missing values",
+				req:  &userspb.ListUsersRequest{OrderBy: "name", Filter: `NOT email = "alice@example.org"`},
+				want: []string{"carol"},
+			},
+			{
+				name: "filter on email",
+				req:  &userspb.ListUsersRequest{OrderBy: "name", Filter: `email:"EXAMPLE"`},
+				want: []string{"alice", "carol"},
+			},
+		} {
+			tt.req.LabelSelector = strings.Join(append([]string{"case=query"}, nonEmpty(tt.req.LabelSelector)...), ",")
+			if diff := cmp.Diff(tt.want, listNames(t, store, tt.req)); diff != "" {
+				t.Errorf("%s: users were not as expected:\n%s", tt.name, diff)
+			}
+		}
+
+		// The users are listed in order of creation by default.
+		var all []*userspb.User
+		err := store.QueryUsers(ctx, users.UserQuery{
+			Request: &userspb.ListUsersRequest{LabelSelector: "case=query"},
+		}, func(user *userspb.User) error {
+			all = append(all, user)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to query users: %s", err)
+		}
+		if len(all) != 5 {
+			t.Fatalf("Expected 5 users, got %d", len(all))
+		}
+		for i := 1; i < len(all); i++ {
+			prev, next := all[i-1], all[i]
+			if next.GetCreateTime().AsTime().Before(prev.GetCreateTime().AsTime()) {
+				t.Errorf("Expected %q to be created after %q", next.GetName(), prev.GetName())
+			}
+		}
+
+		// Listing after a user continues right after it.
+		req := &userspb.ListUsersRequest{LabelSelector: "case=query", OrderBy: "role, name desc"}
+		want := listNames(t, store, req)
+		var got []string
+		var after *userspb.User
+		for {
+			var page []*userspb.User
+			err := store.QueryUsers(ctx, users.UserQuery{
+				Request: req,
+				After:   after,
+				Limit:   2,
+			}, func(user *userspb.User) error {
+				page = append(page, user)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to query users: %s", err)
+			}
+			for _, user := range page {
+				got = append(got, user.GetName())
+			}
+			if len(page) < 2 {
+				break
+			}
+			after = page[len(page)-1]
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Pages were not as expected:\n%s", diff)
+		}
+
+		for _, req := range []*userspb.ListUsersRequest{
+			{OrderBy: "email"},
+			{Filter: "unknown = 1"},
+			{Filter: "role < ADMIN"},
+			{LabelSelector: "team=a,team=b"},
+		} {
+			err := store.QueryUsers(ctx, users.UserQuery{Request: req}, func(*userspb.User) error { return nil })
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Expected %v to fail with InvalidArgument, got %v", req, err)
+			}
+		}
+
+		// Names are matched case insensitively beyond ASCII.
+		_, err = store.AddUser(ctx, &userspb.AddUserRequest{
+			Name:   "Émilie",
+			Role:   userspb.Role_MEMBER,
+			Labels: map[string]string{"case": "unicode"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		for _, req := range []*userspb.ListUsersRequest{
+			{LabelSelector: "case=unicode", NameContains: "émi"},
+			{LabelSelector: "case=unicode", Filter: `name:"ÉMI"`},
+		} {
+			if diff := cmp.Diff([]string{"Émilie"}, listNames(t, store, req)); diff != "" {
+				t.Errorf("%v: users were not as expected:\n%s", req, diff)
+			}
+		}
+	})
+
+	t.Run("GetUser", func(t *testing.T) {
+		user, err := store.AddUser(ctx, &userspb.AddUserRequest{
+			Name:   "grace",
+			Labels: map[string]string{"case": "get"},
+			Email:  "Grace@Example.org",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		got, err := store.GetUser(ctx, &userspb.GetUserRequest{Id: user.GetId()})
+		if err != nil {
+			t.Fatalf("Failed to get user: %s", err)
+		}
+		if diff := cmp.Diff(user, got, protocmp.Transform()); diff != "" {
+			t.Errorf("User was not as expected:\n%s", diff)
+		}
+		got, err = store.GetUserByEmail(ctx, &userspb.GetUserByEmailRequest{Email: "grace@EXAMPLE.org"})
+		if err != nil {
+			t.Fatalf("Failed to get user by email: %s", err)
+		}
+		if diff := cmp.Diff(user, got, protocmp.Transform()); diff != "" {
+			t.Errorf("User was not as expected:\n%s", diff)
+		}
+
+		const missingID = "5f1d0a3c-8b0e-4f7a-9c55-2a7f0d6e4b11"
+		_, err = store.GetUser(ctx, &userspb.GetUserRequest{Id: missingID})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected getting a missing user to fail with NotFound, got %v", err)
+		}
+		_, err = store.GetUser(ctx, &userspb.GetUserRequest{Id: "not-a-uuid"})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected an invalid ID to fail with InvalidArgument, got %v", err)
+		}
+		_, err = store.GetUserByEmail(ctx, &userspb.GetUserByEmailRequest{Email: "heidi@example.org"})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected getting a missing email to fail with NotFound, got %v", err)
+		}
+		_, err = store.GetUserByEmail(ctx, &userspb.GetUserByEmailRequest{})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected an empty email to fail with InvalidArgument, got %v", err)
+		}
+
+		resp, err := store.BatchGetUsers(ctx, &userspb.BatchGetUsersRequest{Ids: []string{missingID, user.GetId()}})
+		if err != nil {
+			t.Fatalf("Failed to batch get users: %s", err)
+		}
+		want := &userspb.BatchGetUsersResponse{
+			Results: []*userspb.BatchGetUsersResult{
+				{Id: missingID, Result: &userspb.BatchGetUsersResult_NotFound{NotFound: true}},
+				{Id: user.GetId(), Result: &userspb.BatchGetUsersResult_User{User: user}},
+			},
+		}
+		if diff := cmp.Diff(want, resp, protocmp.Transform()); diff != "" {
+			t.Errorf("Results were not as expected:\n%s", diff)
+		}
+		_, err = store.BatchGetUsers(ctx, &userspb.BatchGetUsersRequest{Ids: make([]string, 101)})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected too many IDs to fail with InvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("UpdateUser", func(t *testing.T) {
+		user, err := store.AddUser(ctx, &userspb.AddUserRequest{
+			Name:   "ivan",
+			Labels: map[string]string{"case": "update"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		_, err = store.AddUser(ctx, &userspb.AddUserRequest{
+			Name:   "judy",
+			Labels: map[string]string{"case": "update"},
+			Email:  "judy@example.org",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+
+		updated, err := store.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{
+				Id:    user.GetId(),
+				Name:  "ivy",
+				Role:  userspb.Role_ADMIN,
+				Etag:  user.GetEtag(),
+				Email: "ivy@example.org",
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "email"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update user: %s", err)
+		}
+		want := proto.Clone(user).(*userspb.User)
+		want.Name = "ivy"
+		want.Email = "ivy@example.org"
+		want.Etag = "2"
+		if diff := cmp.Diff(want, updated, protocmp.Transform()); diff != "" {
+			t.Errorf("Updated user was not as expected:\n%s", diff)
+		}
+		got, err := store.GetUser(ctx, &userspb.GetUserRequest{Id: user.GetId()})
+		if err != nil {
+			t.Fatalf("Failed to get user: %s", err)
+		}
+		if diff := cmp.Diff(updated, got, protocmp.Transform()); diff != "" {
+			t.Errorf("Stored user was not as expected:\n%s", diff)
+		}
+
+		for _, tt := range []struct {
+			name string
+			req  *userspb.UpdateUserRequest
+			want codes.Code
+		}{
+			{
+				name: "stale etag",
+				req:  &userspb.UpdateUserRequest{User: &userspb.User{Id: user.GetId(), Name: "ivo", Etag: "1"}},
+				want: codes.Aborted,
+			},
+			{
+				name: "taken email",
+				req:  &userspb.UpdateUserRequest{User: &userspb.User{Id: user.GetId(), Email: "JUDY@example.org"}},
+				want: codes.AlreadyExists,
+			},
+			{
+				name: "no fields",
+				req:  &userspb.UpdateUserRequest{User: &userspb.User{Id: user.GetId()}},
+				want: codes.InvalidArgument,
+			},
+			{
+				name: "unknown path",
+				req: &userspb.UpdateUserRequest{
+					User:       &userspb.User{Id: user.GetId()},
+					UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"create_time"}},
+				},
+				want: codes.InvalidArgument,
+			},
+			{
+				name: "missing user",
+				req:  &userspb.UpdateUserRequest{User: &userspb.User{Id: "5f1d0a3c-8b0e-4f7a-9c55-2a7f0d6e4b11", Name: "ivo"}},
+				want: codes.NotFound,
+			},
+		} {
+			_, err := store.UpdateUser(ctx, tt.req)
+			if status.Code(err) != tt.want {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+			}
+		}
+
+		deleted, err := store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: user.GetId()})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
+		_, err = store.UpdateUser(ctx, &userspb.UpdateUserRequest{User: &userspb.User{Id: user.GetId(), Name: "ivo"}})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected updating a deleted user to fail with NotFound, got %v", err)
+		}
+		_, err = store.UndeleteUser(ctx, &userspb.UndeleteUserRequest{Id: user.GetId(), Etag: "2"})
+		if status.Code(err) != codes.Aborted {
+			t.Errorf("Expected a stale etag to fail with Aborted, got %v", err)
+		}
+		undeleted, err := store.UndeleteUser(ctx, &userspb.UndeleteUserRequest{Id: user.GetId(), Etag: deleted.GetEtag()})
+		if err != nil {
+			t.Fatalf("Failed to undelete user: %s", err)
+		}
+		want.Etag = "4"
+		if diff := cmp.Diff(want, undeleted, protocmp.Transform()); diff != "" {
+			t.Errorf("Undeleted user was not as expected:\n%s", diff)
+		}
+		_, err = store.UndeleteUser(ctx, &userspb.UndeleteUserRequest{Id: user.GetId()})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Expected undeleting a user that isn't deleted to fail with FailedPrecondition, got %v", err)
+		}
+		_, err = store.UndeleteUser(ctx, &userspb.UndeleteUserRequest{Id: "5f1d0a3c-8b0e-4f7a-9c55-2a7f0d6e4b11"})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected undeleting a missing user to fail with NotFound, got %v", err)
+		}
+	})
+
+	t.Run("GetUserStats", func(t *testing.T) {
+		var created []*userspb.User
+		for _, role := range []userspb.Role{userspb.Role_MEMBER, userspb.Role_ADMIN, userspb.Role_MEMBER} {
+			user, err := store.AddUser(ctx, &userspb.AddUserRequest{
+				Name:   "stats",
+				Role:   role,
+				Labels: map[string]string{"case": "stats"},
+			})
+			if err != nil {
+				t.Fatalf("Failed to add user: %s", err)
+			}
+			created = append(created, user)
+		}
+		query := &userspb.ListUsersRequest{LabelSelector: "case=stats"}
+		count, err := store.CountUsers(ctx, query)
+		if err != nil {
+			t.Fatalf("Failed to count users: %s", err)
+		}
+		if count.GetCount() != 3 {
+			t.Errorf("Got %d users, wanted 3", count.GetCount())
+		}
+
+		resp, err := store.GetUserStats(ctx, &userspb.GetUserStatsRequest{
+			Query:  query,
+			Bucket: userspb.TimeBucket_MONTH,
+		})
+		if err != nil {
+			t.Fatalf("Failed to get user stats: %s", err)
+		}
+		wantRoles := []*userspb.RoleCount{
+			{Role: userspb.Role_MEMBER, Count: 2},
+			{Role: userspb.Role_ADMIN, Count: 1},
+		}
+		if resp.GetCount() != 3 {
+			t.Errorf("Got a total of %d users, wanted 3", resp.GetCount())
+		}
+		if diff := cmp.Diff(wantRoles, resp.GetRoleCounts(), protocmp.Transform()); diff != "" {
+			t.Errorf("Role counts were not as expected:\n%s", diff)
+		}
+		var histogramCount int64
+		for _, bucket := range resp.GetCreationHistogram() {
+			histogramCount += bucket.GetCount()
+			start := bucket.GetStartTime().AsTime()
+			if start.Day() != 1 || start.Hour() != 0 || start.After(created[0].GetCreateTime().AsTime()) {
+				t.Errorf("Bucket start %s was not the start of the month of the users", start)
+			}
+		}
+		if histogramCount != 3 {
+			t.Errorf("Got %d users in histogram, wanted 3", histogramCount)
+		}
+
+		_, err = store.GetUserStats(ctx, &userspb.GetUserStatsRequest{Bucket: userspb.TimeBucket(42)})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected an unknown bucket to fail with InvalidArgument, got %v", err)
+		}
+	})
+
+	t.Run("ImportChunk", func(t *testing.T) {
+		chunk := func(n int64, names ...string) *userspb.ImportUsersRequest {
+			req := &userspb.ImportUsersRequest{ImportId: "store-import", Chunk: n}
+			for _, name := range names {
+				req.Users = append(req.Users, &userspb.AddUserRequest{
+					Name:   name,
+					Labels: map[string]string{"case": "import"},
+				})
+			}
+			return req
+		}
+
+		_, err := store.ImportChunk(ctx, chunk(1, "kim"), false)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Expected importing out of order to fail with FailedPrecondition, got %v", err)
+		}
+		_, err = store.ImportChunk(ctx, chunk(0), false)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected an empty chunk to fail with InvalidArgument, got %v", err)
+		}
+
+		first := chunk(0, "kim", "lee")
+		first.Users[1].Labels["bad key!"] = "x"
+		resp, err := store.ImportChunk(ctx, first, true)
+		if err != nil {
+			t.Fatalf("Failed to import chunk: %s", err)
+		}
+		if resp.GetCount() != 1 || len(resp.GetIds()) != 1 || len(resp.GetFailures()) != 1 || resp.GetFailures()[0].GetIndex() != 1 {
+			t.Errorf("Expected one user to be imported and one to fail, got %v", resp)
+		}
+		again, err := store.ImportChunk(ctx, first, true)
+		if err != nil {
+			t.Fatalf("Failed to import chunk again: %s", err)
+		}
+		resp.AlreadyCommitted = true
+		if diff := cmp.Diff(resp, again, protocmp.Transform()); diff != "" {
+			t.Errorf("Expected the recorded acknowledgement:\n%s", diff)
+		}
+		_, err = store.ImportChunk(ctx, chunk(0, "mia"), true)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected resuming with different users to fail with InvalidArgument, got %v", err)
+		}
+
+		second, err := store.ImportChunk(ctx, chunk(1, "mia", "ned"), false)
+		if err != nil {
+			t.Fatalf("Failed to import chunk: %s", err)
+		}
+		if second.GetFirstRow() != 2 || second.GetCount() != 2 {
+			t.Errorf("Expected the second chunk to start at row 2 with 2 users, got %v", second)
+		}
+		got := listNames(t, store, &userspb.ListUsersRequest{LabelSelector: "case=import", OrderBy: "name"})
+		if diff := cmp.Diff([]string{"kim", "mia", "ned"}, got); diff != "" {
+			t.Errorf("Imported users were not as expected:\n%s", diff)
+		}
+	})
+
+	t.Run("WatchUserEvents", func(t *testing.T) {
+		watchCtx, watchCancel := context.WithCancel(ctx)
+		defer watchCancel()
+		events := make(chan *userspb.UserEvent, 10)
+		watchErr := make(chan error, 1)
+		go func() {
+			watchErr <- store.WatchUserEvents(watchCtx, func(event *userspb.UserEvent) error {
+				if event.GetUser().GetLabels()["case"] == "watch" {
+					events <- event
+				}
+				return nil
+			})
+		}()
+
+		// Give the watcher some time to start listening
+		time.Sleep(time.Second)
+
+		added, err := store.AddUser(ctx, &userspb.AddUserRequest{
+			Name:   "olga",
+			Labels: map[string]string{"case": "watch"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		updated, err := store.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{Id: added.GetId(), Name: "oleg"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update user: %s", err)
+		}
+		deleted, err := store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: added.GetId()})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
+		undeleted, err := store.UndeleteUser(ctx, &userspb.UndeleteUserRequest{Id: added.GetId()})
+		if err != nil {
+			t.Fatalf("Failed to undelete user: %s", err)
+		}
+		forced, err := store.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: added.GetId(), Force: true})
+		if err != nil {
+			t.Fatalf("Failed to force delete user: %s", err)
+		}
+
+		wantEvents := []*userspb.UserEvent{
+			{Type: userspb.UserEventType_CREATED, User: added},
+			{Type: userspb.UserEventType_UPDATED, User: updated},
+			{Type: userspb.UserEventType_DELETED, User: deleted},
+			{Type: userspb.UserEventType_UPDATED, User: undeleted},
+			{Type: userspb.UserEventType_DELETED, User: forced},
+		}
+		for _, want := range wantEvents {
+			select {
+			case got := <-events:
+				if diff := cmp.Diff(want, got, protocmp.Transform(), protocmp.IgnoreFields(&userspb.UserEvent{}, "event_time")); diff != "" {
+					t.Errorf("Event was not as expected:\n%s", diff)
+				}
+				if got.GetEventTime() == nil {
+					t.Error("EventTime was not set")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out waiting for %s event", want.GetType())
+			}
+		}
+
+		watchCancel()
+		err = <-watchErr
+		if status.Code(err) != codes.Canceled {
+			t.Errorf("Got error %v when cancelling watch, wanted Canceled", err)
+		}
+	})
+}
+
+// listNames lists the names of the users selected by the request.
+func listNames(t *testing.T, store users.Store, req *userspb.ListUsersRequest) []string {
+	t.Helper()
+	var names []string
+	err := store.QueryUsers(context.Background(), users.UserQuery{Request: req}, func(user *userspb.User) error {
+		names = append(names, user.GetName())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to query users: %s", err)
+	}
+	return names
+}
+
+// requests returns a function returning the requests, then io.EOF.
+func requests(reqs ...*userspb.AddUserRequest) func() (*userspb.AddUserRequest, error) {
+	return func() (*userspb.AddUserRequest, error) {
+		if len(reqs) == 0 {
+			return nil, io.EOF
+		}
+		req := reqs[0]
+		reqs = reqs[1:]
+		return req, nil
+	}
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+func TestUserServer(t *testing.T) {
+	t.Parallel()
+
+	store := users.NewMemoryStore()
+	t.Cleanup(func() {
+		err := store.Close()
+		if err != nil {
+			t.Errorf("Failed to close the memory store: %s", err)
+		}
+	})
+	server, err := users.NewUserServer(store, nil)
+	if err != nil {
+		t.Fatalf("Failed to create server: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	addSrv := &addUsersSrvFake{ctx: ctx}
+	for _, name := range []string{"alice", "bob", "carol", "dave", "erin"} {
+		addSrv.reqs = append(addSrv.reqs, &userspb.AddUserRequest{Name: name})
+	}
+	err = server.AddUsers(addSrv)
+	if err != nil {
+		t.Fatalf("Failed to add users: %s", err)
+	}
+	if addSrv.resp.GetCount() != 5 {
+		t.Fatalf("Expected 5 users to be added, got %d", addSrv.resp.GetCount())
+	}
+
+	req := &userspb.ListUsersRequest{PageSize: 2, OrderBy: "name desc"}
+	var names []string
+	for {
+		resp, err := server.ListUsersPage(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+		for _, user := range resp.GetUsers() {
+			names = append(names, user.GetName())
+		}
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+	if diff := cmp.Diff([]string{"erin", "dave", "carol", "bob", "alice"}, names); diff != "" {
+		t.Errorf("Pages were not as expected:\n%s", diff)
+	}
+
+	listSrv := &listUsersSrvFake{ctx: ctx}
+	err = server.ListUsers(&userspb.ListUsersRequest{OrderBy: "name", IncludeResumeTokens: true, PageSize: 2}, listSrv)
+	if err != nil {
+		t.Fatalf("Failed to list users: %s", err)
+	}
+	if len(listSrv.users) != 2 {
+		t.Fatalf("Expected 2 users, got %d", len(listSrv.users))
+	}
+	resumeSrv := &listUsersSrvFake{ctx: ctx}
+	err = server.ListUsers(&userspb.ListUsersRequest{OrderBy: "name", ResumeToken: listSrv.users[1].GetResumeToken()}, resumeSrv)
+	if err != nil {
+		t.Fatalf("Failed to resume listing users: %s", err)
+	}
+	names = nil
+	for _, user := range resumeSrv.users {
+		names = append(names, user.GetName())
+	}
+	if diff := cmp.Diff([]string{"carol", "dave", "erin"}, names); diff != "" {
+		t.Errorf("Resumed users were not as expected:\n%s", diff)
+	}
+
+	_, err = server.ListUsersPage(ctx, &userspb.ListUsersRequest{OrderBy: "name", PageToken: req.GetPageToken()})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected a token for other filters to fail with InvalidArgument, got %v", err)
+	}
+	_, err = server.AddUser(
+		metadata.NewIncomingContext(ctx, metadata.Pairs(users.ConflictModeKey, users.ConflictModeIgnore)),
+		&userspb.AddUserRequest{Name: "frank"},
+	)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected AddUser with AddUsers metadata to fail with InvalidArgument, got %v", err)
+	}
+	user, err := server.GetUser(ctx, &userspb.GetUserRequest{Id: resumeSrv.users[0].GetId()})
+	if err != nil {
+		t.Fatalf("Failed to get user: %s", err)
+	}
+	if user.GetName() != "carol" {
+		t.Errorf("Got user %q, wanted carol", user.GetName())
+	}
+
+	importSrv := &importUsersSrvFake{
+		ctx: ctx,
+		reqs: []*userspb.ImportUsersRequest{
+			{ImportId: "server", Chunk: 0, Users: []*userspb.AddUserRequest{{Name: "grace"}}},
+			{ImportId: "server", Chunk: 1, Users: []*userspb.AddUserRequest{{Name: "heidi"}, {Name: "ivan"}}},
+		},
+	}
+	err = server.ImportUsers(importSrv)
+	if err != nil {
+		t.Fatalf("Failed to import users: %s", err)
+	}
+	if len(importSrv.resps) != 2 || importSrv.resps[1].GetFirstRow() != 1 || importSrv.resps[1].GetCount() != 2 {
+		t.Errorf("Import acknowledgements were not as expected: %v", importSrv.resps)
+	}
+	err = server.ImportUsers(&importUsersSrvFake{
+		ctx: metadata.NewIncomingContext(ctx, metadata.Pairs(users.ReturnUsersKey, "true")),
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected ImportUsers with unsupported metadata to fail with InvalidArgument, got %v", err)
+	}
+	count, err := server.CountUsers(ctx, new(userspb.ListUsersRequest))
+	if err != nil {
+		t.Fatalf("Failed to count users: %s", err)
+	}
+	if count.GetCount() != 8 {
+		t.Errorf("Got %d users, wanted 8", count.GetCount())
+	}
+}
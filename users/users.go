@@ -2,10 +2,16 @@ package users
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/jackc/pgtype"
@@ -15,22 +21,72 @@ import (
 	slogadapter "github.com/mcosta74/pgx-slog"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/proto"
 
 	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
 )
 
-// Directory stores a directory of users.
+// maxBatchGetUsers is the maximum number of users that can be
+// requested in a single BatchGetUsers call.
+const maxBatchGetUsers = 100
+
+// Directory stores a directory of users in Postgres. It implements Store,
+// and serves all the services.
 type Directory struct {
-	logger  *slog.Logger
-	db      *sql.DB
-	sb      squirrel.StatementBuilderType
-	querier Querier
+	logger       *slog.Logger
+	db           *sql.DB
+	sb           squirrel.StatementBuilderType
+	querier      Querier
+	pageTokenKey []byte
+	watchers     *watchHub
+	newID        func() (pgtype.UUID, error)
+
+	purgeRetention time.Duration
+	stopPurge      context.CancelFunc
+	purgeDone      chan struct{}
+
+	publisher           Publisher
+	privateWebhooks     bool
+	webhookClient       *http.Client
+	maxDeliveryAttempts int32
+	stopRelay           context.CancelFunc
+	relayDone           chan struct{}
+}
+
+// Option configures optional behaviour of a Directory. MemoryStore and
+// SQLiteStore accept the same options, ignoring those that don't apply.
+type Option func(*Directory)
+
+// WithPageTokenKey sets the key used to sign page tokens. Directories
+// sharing a database should use the same key, so that page tokens issued
+// by one are accepted by the others. By default, a random key is generated,
+// and page tokens are only valid for the lifetime of the Directory.
+func WithPageTokenKey(key []byte) Option {
+	return func(d *Directory) {
+		d.pageTokenKey = key
+	}
+}
+
+// WithIDStrategy sets how the IDs of new users are generated, unless
+// chosen by the client. Defaults to IDStrategyRandom.
+func WithIDStrategy(strategy IDStrategy) Option {
+	return func(d *Directory) {
+		d.newID = strategy.generator()
+	}
+}
+
+// WithPurgeRetention sets how long soft deleted users are kept before
+// being purged permanently. A retention of 0 disables purging. Defaults
+// to 30 days.
+func WithPurgeRetention(retention time.Duration) Option {
+	return func(d *Directory) {
+		d.purgeRetention = retention
+	}
 }
 
 // NewDirectory creates a new Directory, connecting it to the postgres server on
 // the URL provided.
-func NewDirectory(logger *slog.Logger, pgURL *url.URL) (*Directory, error) {
+func NewDirectory(logger *slog.Logger, pgURL *url.URL, opts ...Option) (*Directory, error) {
 	connURL := *pgURL
 	if connURL.Scheme == "cockroachdb" {
 		// Overwrite the scheme before parsing with pgx, since
@@ -42,6 +98,11 @@ func NewDirectory(logger *slog.Logger, pgURL *url.URL) (*Directory, error) {
 		return nil, fmt.Errorf("parsing postgres URI: %w", err)
 	}
 
+	if pgURL.Scheme == "cockroachdb" {
+		// Used to merge users in AddUsers.
+		c.RuntimeParams["experimental_enable_temp_tables"] = "on"
+	}
+
 	c.Tracer = &tracelog.TraceLog{
 		Logger:   slogadapter.NewLogger(logger),
 		LogLevel: tracelog.LogLevelTrace,
@@ -53,40 +114,252 @@ func NewDirectory(logger *slog.Logger, pgURL *url.URL) (*Directory, error) {
 		return nil, fmt.Errorf("validating schema: %w", err)
 	}
 
-	return &Directory{
-		logger:  logger,
-		db:      db,
-		sb:      squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).RunWith(db),
-		querier: New(db),
-	}, nil
+	// Changes are watched on a dedicated connection.
+	listen := listenPostgres(c.Copy())
+	if pgURL.Scheme == "cockroachdb" {
+		listen = listenCockroachDB(c.Copy())
+	}
+
+	d := &Directory{
+		logger:   logger,
+		db:       db,
+		sb:       squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).RunWith(db),
+		querier:  New(db),
+		watchers: newWatchHub(logger, listen),
+		newID:    IDStrategyRandom.generator(),
+
+		purgeRetention: defaultPurgeRetention,
+
+		maxDeliveryAttempts: defaultMaxDeliveryAttempts,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.webhookClient = newWebhookClient(d.privateWebhooks)
+	if d.pageTokenKey == nil {
+		d.pageTokenKey = make([]byte, 32)
+		_, err = rand.Read(d.pageTokenKey)
+		if err != nil {
+			return nil, fmt.Errorf("generating page token key: %w", err)
+		}
+	}
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	d.stopPurge = stopPurge
+	d.purgeDone = make(chan struct{})
+	go d.purgeLoop(purgeCtx)
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	d.stopRelay = stopRelay
+	d.relayDone = make(chan struct{})
+	go d.relayLoop(relayCtx)
+
+	return d, nil
 }
 
 // Close releases any resources.
 func (d Directory) Close() error {
+	d.stopPurge()
+	<-d.purgeDone
+	d.stopRelay()
+	<-d.relayDone
+	d.watchers.close()
 	return d.db.Close()
 }
 
-// AddUser adds a user to the directory.
-func (d Directory) AddUser(ctx context.Context, req *userspb.AddUserRequest) (*userspb.User, error) {
-	pgRole, err := roleProtoToPostgres(req.Role)
+// AddUser adds a user to the directory. Requests with a request ID, or
+// the ID of an existing user, can be retried without adding the user twice.
+func (d Directory) AddUser(ctx context.Context, req *userspb.AddUserRequest) (_ *userspb.User, retErr error) {
+	err := rejectAddUsersOptions(ctx, "AddUser", ReturnUsersKey, ValidationModeKey, ConflictModeKey)
 	if err != nil {
 		return nil, err
 	}
-	pgUser, err := d.querier.AddUser(ctx, AddUserParams{
-		Role: pgRole,
-		Name: req.Name,
-	})
+	params, err := addUserParams(req, d.newID)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetRequestId() != "" {
+		return d.addUserOnce(ctx, req, params)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error starting transaction: %s", err.Error())
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+	querier := New(tx)
+
+	user, err := addUserTx(ctx, querier, params)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = tx.Rollback()
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "unexpected error rolling back transaction: %s", err.Error())
+			}
+			return d.existingUser(ctx, req, params.ID)
+		}
+		return nil, err
+	}
+	err = tx.Commit()
 	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing user: %s", err.Error())
+	}
+	return user, nil
+}
+
+// addUserTx adds the user, recording it in the audit log and the outbox,
+// using the querier of a transaction. It returns sql.ErrNoRows if a user
+// with the same ID already exists.
+func addUserTx(ctx context.Context, querier Querier, params AddUserParams) (*userspb.User, error) {
+	pgUser, err := querier.AddUser(ctx, params)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err := uniqueViolationError(err); err != nil {
+			return nil, err
+		}
 		return nil, status.Errorf(codes.Internal, "unexpected error adding user: %s", err.Error())
 	}
-	return userPostgresToProto(pgUser)
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	err = recordAuditEvent(ctx, querier, auditEvent{
+		action:  userspb.AuditAction_ADD_USER,
+		userIDs: []string{user.GetId()},
+		after:   user,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = writeOutboxEvent(ctx, querier, EventUserCreated, user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// addUserParams validates the request, returning the parameters to add
+// the user with. The ID is generated with newID, unless requested.
+func addUserParams(req *userspb.AddUserRequest, newID func() (pgtype.UUID, error)) (AddUserParams, error) {
+	pgRole, err := roleProtoToPostgres(req.GetRole())
+	if err != nil {
+		return AddUserParams{}, err
+	}
+	labels, err := encodeLabels(req.GetLabels())
+	if err != nil {
+		return AddUserParams{}, err
+	}
+	attributes, err := encodeAttributes(req.GetAttributes())
+	if err != nil {
+		return AddUserParams{}, err
+	}
+	err = validateEmail(req.GetEmail())
+	if err != nil {
+		return AddUserParams{}, err
+	}
+	userID, err := requestUserID(req, newID)
+	if err != nil {
+		return AddUserParams{}, err
+	}
+	return AddUserParams{
+		ID:         userID,
+		Role:       pgRole,
+		Name:       req.GetName(),
+		Labels:     labels,
+		Attributes: attributes,
+		Email:      emailParam(req.GetEmail()),
+	}, nil
+}
+
+// requestUserID returns the ID requested for the user, or generates one.
+func requestUserID(req *userspb.AddUserRequest, newID func() (pgtype.UUID, error)) (pgtype.UUID, error) {
+	if req.GetId() == "" {
+		userID, err := newID()
+		if err != nil {
+			return userID, status.Errorf(codes.Internal, "unexpected error generating ID: %s", err.Error())
+		}
+		return userID, nil
+	}
+	var userID pgtype.UUID
+	err := userID.Set(req.GetId())
+	if err != nil {
+		return userID, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	return userID, nil
+}
+
+// existingUser returns the user with the ID requested, which already
+// existed, if it matches the request.
+func (d Directory) existingUser(ctx context.Context, req *userspb.AddUserRequest, userID pgtype.UUID) (*userspb.User, error) {
+	pgUser, err := d.querier.GetUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// The user was deleted in the meantime.
+			return nil, status.Error(codes.Aborted, "user was concurrently deleted")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+	}
+	return matchExistingUser(req, pgUser)
+}
+
+// matchExistingUser returns the existing user with the ID requested,
+// if it matches the request, and ALREADY_EXISTS otherwise.
+func matchExistingUser(req *userspb.AddUserRequest, pgUser User) (*userspb.User, error) {
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	existing := &userspb.AddUserRequest{
+		Id:         user.GetId(),
+		Role:       user.GetRole(),
+		Name:       user.GetName(),
+		Labels:     user.GetLabels(),
+		Attributes: user.GetAttributes(),
+		Email:      user.GetEmail(),
+	}
+	requested := &userspb.AddUserRequest{
+		Id:     user.GetId(),
+		Role:   req.GetRole(),
+		Name:   req.GetName(),
+		Labels: req.GetLabels(),
+		Email:  req.GetEmail(),
+	}
+	if len(req.GetAttributes().GetFields()) > 0 {
+		// Empty attributes are returned as unset.
+		requested.Attributes = req.GetAttributes()
+	}
+	if !proto.Equal(existing, requested) {
+		return nil, status.Errorf(codes.AlreadyExists, "a different user with ID %q already exists", user.GetId())
+	}
+	return user, nil
 }
 
 // AddUsers adds a large amount of users efficiently.
-func (d Directory) AddUsers(srv userspb.UserService_AddUsersServer) (retErr error) {
-	conn, err := d.db.Conn(srv.Context())
+func (d Directory) AddUsers(srv userspb.UserService_AddUsersServer) error {
+	return d.userServer().AddUsers(srv)
+}
+
+// BulkAddUsers adds the users returned by next, until it returns io.EOF,
+// in a single transaction. The users are streamed into the database, so
+// that they don't need to be held in memory.
+func (d Directory) BulkAddUsers(ctx context.Context, next func() (*userspb.AddUserRequest, error), opts AddUsersOptions) (_ *userspb.AddUsersResponse, retErr error) {
+	var merge bool
+	switch opts.ConflictMode {
+	case "", ConflictModeError:
+	case ConflictModeIgnore, ConflictModeUpdate:
+		merge = true
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid conflict mode %q", opts.ConflictMode)
+	}
+
+	conn, err := d.db.Conn(ctx)
 	if err != nil {
-		status.Errorf(codes.Internal, "unexpected error getting connection: %s", err.Error())
+		return nil, status.Errorf(codes.Internal, "unexpected error getting connection: %s", err.Error())
 	}
 	defer func() {
 		err := conn.Close()
@@ -94,61 +367,797 @@ func (d Directory) AddUsers(srv userspb.UserService_AddUsersServer) (retErr erro
 			retErr = err
 		}
 	}()
-	err = conn.Raw(func(driverConn interface{}) error {
+
+	resp := new(userspb.AddUsersResponse)
+	err = conn.Raw(func(driverConn interface{}) (retErr error) {
 		conn := driverConn.(*stdlib.Conn).Conn()
-		// CopyFrom uses the Postgres COPY protocol to perform bulk data insertion.
-		// CopyFrom can be faster than an insert with as few as 5 rows.
-		_, err = conn.CopyFrom(
-			srv.Context(),
-			pgx.Identifier{"users"},
-			[]string{"role", "name"},
-			&usersSource{
-				getUser: srv.Recv,
-			},
-		)
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return status.Errorf(codes.Internal, "unexpected error starting transaction: %s", err.Error())
+		}
+		defer func() {
+			err := tx.Rollback(context.Background())
+			if retErr == nil && err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+				retErr = status.Error(codes.Internal, err.Error())
+			}
+		}()
+
+		src := &usersSource{
+			getUser:        next,
+			newID:          d.newID,
+			reportFailures: opts.ReportFailures,
+		}
+		var created, updated []string
+		if merge {
+			created, updated, err = mergeUsers(ctx, tx, src, opts.ConflictMode == ConflictModeUpdate)
+			resp.Count = int64(len(created) + len(updated))
+		} else {
+			resp.Count, err = copyUsers(ctx, tx.Conn(), "users", src)
+			created = src.ids
+		}
 		if err != nil {
-			return status.Errorf(codes.Internal, "unexpected error inserting users: %s", err.Error())
+			return err
+		}
+		resp.Failures = src.failures
+
+		// The users are left out of the audit log, to keep the event
+		// small. Only the users created or updated are recorded, by ID,
+		// leaving out the existing users that were ignored.
+		changed := make([]string, 0, len(created)+len(updated))
+		changed = append(append(changed, created...), updated...)
+		err = recordAuditEventTx(ctx, tx, auditEvent{
+			action:  userspb.AuditAction_ADD_USERS,
+			userIDs: changed,
+			after:   resp,
+		})
+		if err != nil {
+			return err
+		}
+
+		added, err := d.selectAddedUsers(ctx, tx, src.ids)
+		if err != nil {
+			return err
+		}
+		err = copyOutboxEvents(ctx, tx, added, created, updated)
+		if err != nil {
+			return err
+		}
+		if opts.ReturnUsers {
+			resp.Users = added
+		}
+
+		err = tx.Commit(ctx)
+		if err != nil {
+			return status.Errorf(codes.Internal, "unexpected error committing users: %s", err.Error())
 		}
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return resp, nil
+}
+
+// copyColumns are the columns inserted by copyUsers.
+var copyColumns = []string{"id", "role", "name", "labels", "attributes", "email"}
+
+// copyUsers inserts the users from the source into the table.
+func copyUsers(ctx context.Context, conn *pgx.Conn, table string, src *usersSource) (int64, error) {
+	// CopyFrom uses the Postgres COPY protocol to perform bulk data insertion.
+	// CopyFrom can be faster than an insert with as few as 5 rows.
+	n, err := conn.CopyFrom(
+		ctx,
+		pgx.Identifier{table},
+		copyColumns,
+		src,
+	)
+	if err != nil {
+		if src.err != nil {
+			// Errors from the source are already status errors.
+			return 0, src.err
+		}
+		if err := uniqueViolationError(err); err != nil {
+			return 0, err
+		}
+		return 0, status.Errorf(codes.Internal, "unexpected error inserting users: %s", err.Error())
+	}
+	return n, nil
+}
+
+// mergeUsers inserts the users from the source, ignoring or updating
+// existing users with the same IDs, and returns the IDs of the users
+// created and updated. Since COPY doesn't support conflict handling,
+// the users are copied into a temporary table first.
+func mergeUsers(ctx context.Context, tx pgx.Tx, src *usersSource, update bool) (created, updated []string, _ error) {
+	_, err := tx.Exec(ctx, "CREATE TEMPORARY TABLE added_users ("+
+		"id UUID NOT NULL, role role NOT NULL, name TEXT NOT NULL, labels JSONB NOT NULL, attributes JSONB NOT NULL, email TEXT)")
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "unexpected error creating temporary table: %s", err.Error())
+	}
+	_, err = copyUsers(ctx, tx.Conn(), "added_users", src)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing := map[string]bool{}
+	if update {
+		// Updated users are told apart from created users by whether
+		// they existed before the merge. A user added concurrently in
+		// between is reported as created.
+		rows, err := tx.Query(ctx, "SELECT id FROM users WHERE id IN (SELECT id FROM added_users)")
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "unexpected error selecting existing users: %s", err.Error())
+		}
+		ids, err := scanIDs(rows)
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "unexpected error selecting existing users: %s", err.Error())
+		}
+		for _, id := range ids {
+			existing[id] = true
+		}
+	}
+	columns := strings.Join(copyColumns, ", ")
+	merge := "INSERT INTO users (" + columns + ") SELECT " + columns + " FROM added_users ON CONFLICT (id) "
+	if update {
+		merge += "DO UPDATE SET role = excluded.role, name = excluded.name, labels = excluded.labels, " +
+			"attributes = excluded.attributes, email = excluded.email, version = users.version + 1 WHERE users.delete_time IS NULL"
+	} else {
+		merge += "DO NOTHING"
+	}
+	rows, err := tx.Query(ctx, merge+" RETURNING id")
+	if err == nil {
+		var ids []string
+		ids, err = scanIDs(rows)
+		for _, id := range ids {
+			if existing[id] {
+				updated = append(updated, id)
+			} else {
+				created = append(created, id)
+			}
+		}
+	}
+	if err != nil {
+		if err := uniqueViolationError(err); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, status.Errorf(codes.Internal, "unexpected error merging users: %s", err.Error())
+	}
+	// The table is dropped explicitly rather than with ON COMMIT DROP,
+	// which CockroachDB doesn't support.
+	_, err = tx.Exec(ctx, "DROP TABLE added_users")
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "unexpected error dropping temporary table: %s", err.Error())
+	}
+	return created, updated, nil
+}
+
+// scanIDs reads the IDs from the rows, and closes them.
+func scanIDs(rows pgx.Rows) ([]string, error) {
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var pgID pgtype.UUID
+		err := rows.Scan(&pgID)
+		if err != nil {
+			return nil, err
+		}
+		var id string
+		err = pgID.AssignTo(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// pgxConn is implemented by *pgx.Conn and pgx.Tx.
+type pgxConn interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// selectAddedUsers reads back the users with the IDs provided, in order.
+func (d Directory) selectAddedUsers(ctx context.Context, conn pgxConn, ids []string) ([]*userspb.User, error) {
+	query, args, err := d.sb.Select(
+		userColumns...,
+	).From(
+		"users",
+	).Where(
+		"id = ANY(?::uuid[])", ids,
+	).ToSql()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error building query: %s", err.Error())
+	}
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error reading added users: %s", err.Error())
+	}
+	defer rows.Close()
+	added := make(map[string]*userspb.User, len(ids))
+	for rows.Next() {
+		pgUser, err := scanUser(rows)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unexpected error scanning user: %s", err.Error())
+		}
+		protoUser, err := userPostgresToProto(pgUser)
+		if err != nil {
+			return nil, err
+		}
+		added[protoUser.GetId()] = protoUser
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error reading added users: %s", err.Error())
+	}
+	users := make([]*userspb.User, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, added[id])
+	}
+	return users, nil
+}
+
+// userUpdate is an update of a user, with the values of the fields
+// selected by the update mask validated and encoded for storage.
+type userUpdate struct {
+	userID  pgtype.UUID
+	version int64
+
+	updateName, updateRole, updateLabels, updateAttributes, updateEmail bool
+
+	name       string
+	role       Role
+	labels     json.RawMessage
+	attributes json.RawMessage
+	email      sql.NullString
+}
+
+// parseUserUpdate parses the update requested. Without an update mask,
+// the populated fields are updated.
+func parseUserUpdate(req *userspb.UpdateUserRequest) (userUpdate, error) {
+	var u userUpdate
+	err := u.userID.Set(req.GetUser().GetId())
+	if err != nil {
+		return u, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		// Follow https://google.aip.dev/134 and treat a missing
+		// mask as a mask of all populated fields.
+		if req.GetUser().GetName() != "" {
+			paths = append(paths, "name")
+		}
+		if req.GetUser().GetRole() != userspb.Role_GUEST {
+			paths = append(paths, "role")
+		}
+		if len(req.GetUser().GetLabels()) > 0 {
+			paths = append(paths, "labels")
+		}
+		if req.GetUser().GetAttributes() != nil {
+			paths = append(paths, "attributes")
+		}
+		if req.GetUser().GetEmail() != "" {
+			paths = append(paths, "email")
+		}
+	}
+
+	for _, path := range paths {
+		switch path {
+		case "*":
+			u.updateName, u.updateRole, u.updateLabels, u.updateAttributes, u.updateEmail = true, true, true, true, true
+		case "name":
+			u.updateName = true
+		case "role":
+			u.updateRole = true
+		case "labels":
+			u.updateLabels = true
+		case "attributes":
+			u.updateAttributes = true
+		case "email":
+			u.updateEmail = true
+		default:
+			return u, status.Errorf(codes.InvalidArgument, "unsupported update mask path %q", path)
+		}
+	}
+	if !u.updateName && !u.updateRole && !u.updateLabels && !u.updateAttributes && !u.updateEmail {
+		return u, status.Error(codes.InvalidArgument, "no fields to update")
+	}
+
+	u.version, err = parseEtag(req.GetUser().GetEtag())
+	if err != nil {
+		return u, err
+	}
+	if u.updateName {
+		u.name = req.GetUser().GetName()
+	}
+	if u.updateRole {
+		u.role, err = roleProtoToPostgres(req.GetUser().GetRole())
+		if err != nil {
+			return u, err
+		}
+	}
+	if u.updateLabels {
+		u.labels, err = encodeLabels(req.GetUser().GetLabels())
+		if err != nil {
+			return u, err
+		}
+	}
+	if u.updateAttributes {
+		u.attributes, err = encodeAttributes(req.GetUser().GetAttributes())
+		if err != nil {
+			return u, err
+		}
+	}
+	if u.updateEmail {
+		err = validateEmail(req.GetUser().GetEmail())
+		if err != nil {
+			return u, err
+		}
+		u.email = emailParam(req.GetUser().GetEmail())
+	}
+	return u, nil
+}
+
+// apply returns the user with the update applied, at the next version.
+func (u userUpdate) apply(pgUser User) User {
+	if u.updateName {
+		pgUser.Name = u.name
+	}
+	if u.updateRole {
+		pgUser.Role = u.role
+	}
+	if u.updateLabels {
+		pgUser.Labels = u.labels
+	}
+	if u.updateAttributes {
+		pgUser.Attributes = u.attributes
+	}
+	if u.updateEmail {
+		pgUser.Email = u.email
 	}
-	return srv.SendAndClose(new(emptypb.Empty))
+	pgUser.Version++
+	return pgUser
 }
 
-// DeleteUser deletes the user, if found.
-func (d Directory) DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (*userspb.User, error) {
+// UpdateUser updates the fields of the user selected by the update mask.
+// Only the masked columns are written. Soft deleted users cannot be updated.
+func (d Directory) UpdateUser(ctx context.Context, req *userspb.UpdateUserRequest) (_ *userspb.User, retErr error) {
+	u, err := parseUserUpdate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error starting transaction: %s", err.Error())
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+	querier := New(tx)
+
+	// Lock the user, so that the snapshot in the audit log
+	// is the user that was updated.
+	pgBefore, err := querier.GetUserForUpdate(ctx, u.userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+	}
+
+	q := d.sb.RunWith(tx).Update(
+		"users",
+	).Set(
+		"version", squirrel.Expr("version + 1"),
+	).Where(
+		squirrel.Eq{"id": u.userID, "delete_time": nil},
+	).Suffix(
+		"RETURNING " + strings.Join(userColumns, ", "),
+	)
+	if u.version != 0 {
+		q = q.Where(squirrel.Eq{"version": u.version})
+	}
+	if u.updateName {
+		q = q.Set("name", u.name)
+	}
+	if u.updateRole {
+		q = q.Set("role", u.role)
+	}
+	if u.updateLabels {
+		q = q.Set("labels", u.labels)
+	}
+	if u.updateAttributes {
+		q = q.Set("attributes", u.attributes)
+	}
+	if u.updateEmail {
+		q = q.Set("email", u.email)
+	}
+
+	pgUser, err := scanUser(q.QueryRowContext(ctx))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = d.checkVersion(ctx, u.userID, u.version)
+			if err != nil {
+				return nil, err
+			}
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		if err := uniqueViolationError(err); err != nil {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error updating user: %s", err.Error())
+	}
+	before, err := userPostgresToProto(pgBefore)
+	if err != nil {
+		return nil, err
+	}
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	err = recordAuditEvent(ctx, querier, auditEvent{
+		action:  userspb.AuditAction_UPDATE_USER,
+		userIDs: []string{user.GetId()},
+		before:  before,
+		after:   user,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = writeOutboxEvent(ctx, querier, EventUserUpdated, user)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing update: %s", err.Error())
+	}
+	return user, nil
+}
+
+// DeleteUser deletes the user, if found. Users are soft deleted unless
+// force is set, in which case they are deleted permanently, even if they
+// were already soft deleted.
+func (d Directory) DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (_ *userspb.User, retErr error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	version, err := parseEtag(req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error starting transaction: %s", err.Error())
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+	querier := New(tx)
+
+	// Lock the user, so that the snapshot in the audit log
+	// is the user that was deleted.
+	pgBefore, err := querier.GetUserForUpdate(ctx, userID)
+	if err != nil {
+		return nil, d.deleteUserError(ctx, err, userID, version)
+	}
+	var pgUser User
+	if req.GetForce() {
+		pgUser, err = querier.DeleteUser(ctx, DeleteUserParams{
+			ID:      userID,
+			Version: version,
+		})
+	} else {
+		pgUser, err = querier.SoftDeleteUser(ctx, SoftDeleteUserParams{
+			ID:      userID,
+			Version: version,
+		})
+	}
+	if err != nil {
+		return nil, d.deleteUserError(ctx, err, userID, version)
+	}
+	before, err := userPostgresToProto(pgBefore)
+	if err != nil {
+		return nil, err
+	}
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	event := auditEvent{
+		action:  userspb.AuditAction_DELETE_USER,
+		userIDs: []string{user.GetId()},
+		before:  before,
+	}
+	if !req.GetForce() {
+		// Soft deleted users can still be retrieved.
+		event.after = user
+	}
+	err = recordAuditEvent(ctx, querier, event)
+	if err != nil {
+		return nil, err
+	}
+	err = writeOutboxEvent(ctx, querier, EventUserDeleted, user)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing deletion: %s", err.Error())
+	}
+	return user, nil
+}
+
+// deleteUserError returns the error to report for a failed deletion.
+func (d Directory) deleteUserError(ctx context.Context, err error, userID pgtype.UUID, version int64) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = d.checkVersion(ctx, userID, version)
+		if err != nil {
+			return err
+		}
+		return status.Error(codes.NotFound, "user not found")
+	}
+	return status.Errorf(codes.Internal, "unexpected error deleting user: %s", err.Error())
+}
+
+// UndeleteUser restores a soft deleted user, if it hasn't been purged.
+func (d Directory) UndeleteUser(ctx context.Context, req *userspb.UndeleteUserRequest) (_ *userspb.User, retErr error) {
 	var userID pgtype.UUID
 	err := userID.Set(req.GetId())
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
 	}
-	pgUser, err := d.querier.DeleteUser(ctx, userID)
+	version, err := parseEtag(req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error starting transaction: %s", err.Error())
+	}
+	defer func() {
+		err := tx.Rollback()
+		if retErr == nil && err != nil && err != sql.ErrTxDone {
+			retErr = status.Error(codes.Internal, err.Error())
+		}
+	}()
+	querier := New(tx)
+
+	// Lock the user, so that the snapshot in the audit log
+	// is the user that was undeleted.
+	pgBefore, err := querier.GetUserForUpdate(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+	}
+	pgUser, err := querier.UndeleteUser(ctx, UndeleteUserParams{
+		ID:      userID,
+		Version: version,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = d.checkVersion(ctx, userID, version)
+			if err != nil {
+				return nil, err
+			}
+			_, err = d.querier.GetUser(ctx, userID)
+			if err == nil {
+				return nil, status.Error(codes.FailedPrecondition, "user is not deleted")
+			}
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error undeleting user: %s", err.Error())
+	}
+	before, err := userPostgresToProto(pgBefore)
+	if err != nil {
+		return nil, err
+	}
+	user, err := userPostgresToProto(pgUser)
+	if err != nil {
+		return nil, err
+	}
+	err = recordAuditEvent(ctx, querier, auditEvent{
+		action:  userspb.AuditAction_UNDELETE_USER,
+		userIDs: []string{user.GetId()},
+		before:  before,
+		after:   user,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = writeOutboxEvent(ctx, querier, EventUserUndeleted, user)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error committing undeletion: %s", err.Error())
+	}
+	return user, nil
+}
+
+// GetUser gets the user, if found. Soft deleted users are returned too.
+func (d Directory) GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	var userID pgtype.UUID
+	err := userID.Set(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	pgUser, err := d.getUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 	return userPostgresToProto(pgUser)
 }
 
+func (d Directory) getUser(ctx context.Context, userID pgtype.UUID) (User, error) {
+	pgUser, err := d.querier.GetUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, status.Error(codes.NotFound, "user not found")
+		}
+		return User{}, status.Errorf(codes.Internal, "unexpected error getting user: %s", err.Error())
+	}
+	return pgUser, nil
+}
+
+// BatchGetUsers gets several users at once. The results are returned in the
+// same order as the requested IDs, with IDs that could not be found reported
+// as such instead of failing the whole request.
+func (d Directory) BatchGetUsers(ctx context.Context, req *userspb.BatchGetUsersRequest) (*userspb.BatchGetUsersResponse, error) {
+	userIDs, err := batchGetUserIDs(req)
+	if err != nil {
+		return nil, err
+	}
+	pgUsers, err := d.querier.BatchGetUsers(ctx, userIDs)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error getting users: %s", err.Error())
+	}
+	return batchGetUsersResponse(req, userIDs, pgUsers)
+}
+
+// batchGetUserIDs returns the IDs of the users requested.
+func batchGetUserIDs(req *userspb.BatchGetUsersRequest) ([]pgtype.UUID, error) {
+	if len(req.GetIds()) > maxBatchGetUsers {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d users may be requested at once", maxBatchGetUsers)
+	}
+	userIDs := make([]pgtype.UUID, 0, len(req.GetIds()))
+	for _, id := range req.GetIds() {
+		var userID pgtype.UUID
+		err := userID.Set(id)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid UUID provided: %q", id)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
+
+// batchGetUsersResponse returns the results for the users requested,
+// in order, given the users found.
+func batchGetUsersResponse(req *userspb.BatchGetUsersRequest, userIDs []pgtype.UUID, pgUsers []User) (*userspb.BatchGetUsersResponse, error) {
+	found := make(map[[16]byte]*userspb.User, len(pgUsers))
+	for _, pgUser := range pgUsers {
+		protoUser, err := userPostgresToProto(pgUser)
+		if err != nil {
+			return nil, err
+		}
+		found[pgUser.ID.Bytes] = protoUser
+	}
+	resp := &userspb.BatchGetUsersResponse{
+		Results: make([]*userspb.BatchGetUsersResult, 0, len(userIDs)),
+	}
+	for i, userID := range userIDs {
+		result := &userspb.BatchGetUsersResult{
+			Id: req.GetIds()[i],
+		}
+		if protoUser, ok := found[userID.Bytes]; ok {
+			result.Result = &userspb.BatchGetUsersResult_User{User: protoUser}
+		} else {
+			result.Result = &userspb.BatchGetUsersResult_NotFound{NotFound: true}
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
 // ListUsers lists users in the directory, subject to the request filters.
-func (d Directory) ListUsers(req *userspb.ListUsersRequest, srv userspb.UserService_ListUsersServer) (retErr error) {
+// If requested, each user carries a resume token that can be used to
+// continue the stream right after it, should it be interrupted.
+func (d Directory) ListUsers(req *userspb.ListUsersRequest, srv userspb.UserService_ListUsersServer) error {
+	return d.userServer().ListUsers(req, srv)
+}
+
+// ListUsersPage lists a single page of users in the directory, subject to
+// the request filters.
+func (d Directory) ListUsersPage(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.ListUsersPageResponse, error) {
+	return d.userServer().ListUsersPage(ctx, req)
+}
+
+// userServer returns a server for the users of the directory.
+func (d Directory) userServer() *UserServer {
+	return &UserServer{
+		store:        d,
+		pageTokenKey: d.pageTokenKey,
+	}
+}
+
+// QueryUsers calls fn for each user selected by the query, in order.
+func (d Directory) QueryUsers(ctx context.Context, uq UserQuery, fn func(*userspb.User) error) error {
+	order, err := parseOrderBy(uq.Request.GetOrderBy())
+	if err != nil {
+		return err
+	}
 	q := d.sb.Select(
-		"id",
-		"role",
-		"create_time",
-		"name",
+		userColumns...,
 	).From(
 		"users",
 	).OrderBy(
-		"create_time ASC",
+		orderByClauses(order)...,
 	)
 
+	q, err = applyListFilters(q, uq.Request)
+	if err != nil {
+		return err
+	}
+
+	if uq.After != nil {
+		pt, err := userPageToken(uq.After, order, nil)
+		if err != nil {
+			return err
+		}
+		values, err := pt.values()
+		if err != nil {
+			return err
+		}
+		q = q.Where(afterCursor(order, values))
+	}
+	if uq.Limit > 0 {
+		q = q.Limit(uint64(uq.Limit))
+	}
+
+	return d.queryUsers(ctx, q, func(pgUser User) error {
+		protoUser, err := userPostgresToProto(pgUser)
+		if err != nil {
+			return err
+		}
+		return fn(protoUser)
+	})
+}
+
+// applyListFilters applies the filters of the request to the query.
+func applyListFilters(q squirrel.SelectBuilder, req *userspb.ListUsersRequest) (squirrel.SelectBuilder, error) {
+	if !req.GetShowDeleted() {
+		q = q.Where(squirrel.Eq{
+			"delete_time": nil,
+		})
+	}
+	if req.GetLabelSelector() != "" {
+		pred, err := labelSelectorToSql(req.GetLabelSelector())
+		if err != nil {
+			return q, err
+		}
+		q = q.Where(pred)
+	}
+
 	if req.GetCreatedSince() != nil {
 		var pgTime pgtype.Timestamptz
 		err := pgTime.Set(req.GetCreatedSince().AsTime())
 		if err != nil {
-			return status.Errorf(codes.InvalidArgument, "invalid timestamp: %s", err.Error())
+			return q, status.Errorf(codes.InvalidArgument, "invalid timestamp: %s", err.Error())
 		}
 		q = q.Where(squirrel.Gt{
 			"create_time": pgTime,
@@ -159,7 +1168,7 @@ func (d Directory) ListUsers(req *userspb.ListUsersRequest, srv userspb.UserServ
 		var pgInterval pgtype.Interval
 		err := pgInterval.Set(req.GetOlderThan().AsDuration())
 		if err != nil {
-			return status.Errorf(codes.InvalidArgument, "invalid duration: %s", err.Error())
+			return q, status.Errorf(codes.InvalidArgument, "invalid duration: %s", err.Error())
 		}
 		q = q.Where(
 			squirrel.Expr(
@@ -168,7 +1177,61 @@ func (d Directory) ListUsers(req *userspb.ListUsersRequest, srv userspb.UserServ
 		)
 	}
 
-	rows, retErr := q.QueryContext(srv.Context())
+	if req.GetCreatedBefore() != nil {
+		var pgTime pgtype.Timestamptz
+		err := pgTime.Set(req.GetCreatedBefore().AsTime())
+		if err != nil {
+			return q, status.Errorf(codes.InvalidArgument, "invalid timestamp: %s", err.Error())
+		}
+		q = q.Where(squirrel.Lt{
+			"create_time": pgTime,
+		})
+	}
+
+	if len(req.GetRoles()) > 0 {
+		pgRoles := make([]Role, 0, len(req.GetRoles()))
+		for _, role := range req.GetRoles() {
+			pgRole, err := roleProtoToPostgres(role)
+			if err != nil {
+				return q, err
+			}
+			pgRoles = append(pgRoles, pgRole)
+		}
+		q = q.Where(squirrel.Eq{
+			"role": pgRoles,
+		})
+	}
+
+	if req.GetNamePrefix() != "" {
+		q = q.Where(squirrel.Like{
+			"name": escapeLike(req.GetNamePrefix()) + "%",
+		})
+	}
+
+	if req.GetNameContains() != "" {
+		q = q.Where(squirrel.ILike{
+			"name": "%" + escapeLike(req.GetNameContains()) + "%",
+		})
+	}
+
+	expr, err := parseFilter(req.GetFilter())
+	if err != nil {
+		return q, err
+	}
+	if expr != nil {
+		pred, err := filterToSql(expr, comparisonToSql)
+		if err != nil {
+			return q, err
+		}
+		q = q.Where(pred)
+	}
+
+	return q, nil
+}
+
+// queryUsers runs the query and calls fn for each user returned.
+func (d Directory) queryUsers(ctx context.Context, q squirrel.SelectBuilder, fn func(User) error) (retErr error) {
+	rows, retErr := q.QueryContext(ctx)
 	if retErr != nil {
 		return status.Error(codes.Internal, retErr.Error())
 	}
@@ -180,24 +1243,14 @@ func (d Directory) ListUsers(req *userspb.ListUsersRequest, srv userspb.UserServ
 	}()
 
 	for rows.Next() {
-		var pgUser User
-		err := rows.Scan(
-			&pgUser.ID,
-			&pgUser.Role,
-			&pgUser.CreateTime,
-			&pgUser.Name,
-		)
+		pgUser, err := scanUser(rows)
 		if err != nil {
 			return status.Error(codes.Internal, err.Error())
 		}
-		protoUser, err := userPostgresToProto(pgUser)
+		err = fn(pgUser)
 		if err != nil {
 			return err
 		}
-		err = srv.Send(protoUser)
-		if err != nil {
-			return status.Error(codes.Internal, err.Error())
-		}
 	}
 
 	retErr = rows.Err()
@@ -7,52 +7,304 @@ package users
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
 
 	"github.com/jackc/pgtype"
+	"github.com/lib/pq"
 )
 
 const addUser = `-- name: AddUser :one
 INSERT INTO users (
+  id,
   role,
-  name
+  name,
+  labels,
+  attributes,
+  email
 ) VALUES (
-  $1, 
-  $2
+  $1,
+  $2,
+  $3,
+  $4,
+  $5,
+  $6
 )
-RETURNING id, role, create_time, name
+ON CONFLICT (id) DO NOTHING
+RETURNING id, role, create_time, name, delete_time, version, labels, attributes, email
 `
 
 type AddUserParams struct {
-	Role Role
-	Name string
+	ID         pgtype.UUID
+	Role       Role
+	Name       string
+	Labels     json.RawMessage
+	Attributes json.RawMessage
+	Email      sql.NullString
 }
 
 func (q *Queries) AddUser(ctx context.Context, arg AddUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, addUser, arg.Role, arg.Name)
+	row := q.db.QueryRowContext(ctx, addUser,
+		arg.ID,
+		arg.Role,
+		arg.Name,
+		arg.Labels,
+		arg.Attributes,
+		arg.Email,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
 		&i.Role,
 		&i.CreateTime,
 		&i.Name,
+		&i.DeleteTime,
+		&i.Version,
+		&i.Labels,
+		&i.Attributes,
+		&i.Email,
 	)
 	return i, err
 }
 
+const batchGetUsers = `-- name: BatchGetUsers :many
+SELECT id, role, create_time, name, delete_time, version, labels, attributes, email FROM users
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) BatchGetUsers(ctx context.Context, ids []pgtype.UUID) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, batchGetUsers, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Role,
+			&i.CreateTime,
+			&i.Name,
+			&i.DeleteTime,
+			&i.Version,
+			&i.Labels,
+			&i.Attributes,
+			&i.Email,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const deleteUser = `-- name: DeleteUser :one
+
 DELETE FROM users
+WHERE id = $1 AND ($2::bigint = 0 OR version = $2)
+RETURNING id, role, create_time, name, delete_time, version, labels, attributes, email
+`
+
+type DeleteUserParams struct {
+	ID      pgtype.UUID
+	Version int64
+}
+
+// A version of 0 matches any version.
+func (q *Queries) DeleteUser(ctx context.Context, arg DeleteUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, deleteUser, arg.ID, arg.Version)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.CreateTime,
+		&i.Name,
+		&i.DeleteTime,
+		&i.Version,
+		&i.Labels,
+		&i.Attributes,
+		&i.Email,
+	)
+	return i, err
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, role, create_time, name, delete_time, version, labels, attributes, email FROM users
 WHERE id = $1
-RETURNING id, role, create_time, name
 `
 
-func (q *Queries) DeleteUser(ctx context.Context, id pgtype.UUID) (User, error) {
-	row := q.db.QueryRowContext(ctx, deleteUser, id)
+func (q *Queries) GetUser(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.CreateTime,
+		&i.Name,
+		&i.DeleteTime,
+		&i.Version,
+		&i.Labels,
+		&i.Attributes,
+		&i.Email,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, role, create_time, name, delete_time, version, labels, attributes, email FROM users
+WHERE lower(email) = lower($1::text)
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.CreateTime,
+		&i.Name,
+		&i.DeleteTime,
+		&i.Version,
+		&i.Labels,
+		&i.Attributes,
+		&i.Email,
+	)
+	return i, err
+}
+
+const getUserForUpdate = `-- name: GetUserForUpdate :one
+SELECT id, role, create_time, name, delete_time, version, labels, attributes, email FROM users
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetUserForUpdate(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.CreateTime,
+		&i.Name,
+		&i.DeleteTime,
+		&i.Version,
+		&i.Labels,
+		&i.Attributes,
+		&i.Email,
+	)
+	return i, err
+}
+
+const purgeUsers = `-- name: PurgeUsers :many
+DELETE FROM users
+WHERE id IN (
+  SELECT id FROM users
+  WHERE delete_time < $1::timestamptz
+  LIMIT $2
+)
+RETURNING id, role, create_time, name, delete_time, version, labels, attributes, email
+`
+
+type PurgeUsersParams struct {
+	Cutoff    time.Time
+	BatchSize int32
+}
+
+func (q *Queries) PurgeUsers(ctx context.Context, arg PurgeUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, purgeUsers, arg.Cutoff, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Role,
+			&i.CreateTime,
+			&i.Name,
+			&i.DeleteTime,
+			&i.Version,
+			&i.Labels,
+			&i.Attributes,
+			&i.Email,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteUser = `-- name: SoftDeleteUser :one
+UPDATE users
+SET delete_time = CURRENT_TIMESTAMP, version = version + 1
+WHERE id = $1 AND delete_time IS NULL AND ($2::bigint = 0 OR version = $2)
+RETURNING id, role, create_time, name, delete_time, version, labels, attributes, email
+`
+
+type SoftDeleteUserParams struct {
+	ID      pgtype.UUID
+	Version int64
+}
+
+func (q *Queries) SoftDeleteUser(ctx context.Context, arg SoftDeleteUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, softDeleteUser, arg.ID, arg.Version)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.CreateTime,
+		&i.Name,
+		&i.DeleteTime,
+		&i.Version,
+		&i.Labels,
+		&i.Attributes,
+		&i.Email,
+	)
+	return i, err
+}
+
+const undeleteUser = `-- name: UndeleteUser :one
+UPDATE users
+SET delete_time = NULL, version = version + 1
+WHERE id = $1 AND delete_time IS NOT NULL AND ($2::bigint = 0 OR version = $2)
+RETURNING id, role, create_time, name, delete_time, version, labels, attributes, email
+`
+
+type UndeleteUserParams struct {
+	ID      pgtype.UUID
+	Version int64
+}
+
+func (q *Queries) UndeleteUser(ctx context.Context, arg UndeleteUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, undeleteUser, arg.ID, arg.Version)
 	var i User
 	err := row.Scan(
 		&i.ID,
 		&i.Role,
 		&i.CreateTime,
 		&i.Name,
+		&i.DeleteTime,
+		&i.Version,
+		&i.Labels,
+		&i.Attributes,
+		&i.Email,
 	)
 	return i, err
 }
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,10 +19,13 @@ import (
 	"github.com/ory/dockertest/v3/docker"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
 	"google.golang.org/protobuf/types/known/durationpb"
-	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
 	"github.com/johanbrandhorst/grpc-postgres/users"
@@ -167,9 +171,273 @@ func TestAddDeleteUser(t *testing.T) {
 			t.Fatalf("Failed to delete user: %s", err)
 		}
 
+		if diff := cmp.Diff(user1, user2, protocmp.Transform(), protocmp.IgnoreFields(&userspb.User{}, "delete_time", "etag")); diff != "" {
+			t.Fatalf("Deleted user differed from created user:\n%s", diff)
+		}
+		if user2.GetDeleteTime() == nil {
+			t.Fatal("DeleteTime was not set")
+		}
+
+		_, err = directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{
+				Id:   user1.GetId(),
+				Name: "Bar",
+			},
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Did not get correct error when updating deleted user: %s", err)
+		}
+
+		_, err = directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id: user1.GetId(),
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Did not get correct error when deleting deleted user: %s", err)
+		}
+	})
+
+	t.Run("When undeleting a deleted user", func(t *testing.T) {
+		t.Parallel()
+
+		user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_MEMBER,
+			Name: "Undeleted",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+
+		_, err = directory.UndeleteUser(ctx, &userspb.UndeleteUserRequest{
+			Id: user1.GetId(),
+		})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("Did not get correct error when undeleting user that isn't deleted: %s", err)
+		}
+
+		_, err = directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id: user1.GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
+
+		user2, err := directory.UndeleteUser(ctx, &userspb.UndeleteUserRequest{
+			Id: user1.GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to undelete user: %s", err)
+		}
+		if diff := cmp.Diff(user1, user2, protocmp.Transform(), protocmp.IgnoreFields(&userspb.User{}, "etag")); diff != "" {
+			t.Fatalf("Undeleted user differed from created user:\n%s", diff)
+		}
+	})
+
+	t.Run("When listing deleted users", func(t *testing.T) {
+		t.Parallel()
+
+		user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_GUEST,
+			Name: "Listed after deletion",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+		user2, err := directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id: user1.GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
+
+		srv := &listUsersSrvFake{ctx: ctx}
+		err = directory.ListUsers(&userspb.ListUsersRequest{
+			NamePrefix: "Listed after deletion",
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+		if len(srv.users) != 0 {
+			t.Fatalf("Got %d deleted users, wanted none", len(srv.users))
+		}
+
+		srv = &listUsersSrvFake{ctx: ctx}
+		err = directory.ListUsers(&userspb.ListUsersRequest{
+			NamePrefix:  "Listed after deletion",
+			ShowDeleted: true,
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+		if diff := cmp.Diff([]*userspb.User{user2}, srv.users, protocmp.Transform()); diff != "" {
+			t.Fatalf("Deleted users were not as expected:\n%s", diff)
+		}
+	})
+
+	t.Run("When force deleting a user", func(t *testing.T) {
+		t.Parallel()
+
+		user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_ADMIN,
+			Name: "Forced",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+		user2, err := directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id:    user1.GetId(),
+			Force: true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
 		if diff := cmp.Diff(user1, user2, protocmp.Transform()); diff != "" {
 			t.Fatalf("Deleted user differed from created user:\n%s", diff)
 		}
+
+		_, err = directory.GetUser(ctx, &userspb.GetUserRequest{
+			Id: user1.GetId(),
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Did not get correct error when getting force deleted user: %s", err)
+		}
+		_, err = directory.UndeleteUser(ctx, &userspb.UndeleteUserRequest{
+			Id: user1.GetId(),
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Did not get correct error when undeleting force deleted user: %s", err)
+		}
+	})
+
+	t.Run("When deleting with an etag", func(t *testing.T) {
+		t.Parallel()
+
+		user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_MEMBER,
+			Name: "Etag",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+		user2, err := directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{
+				Id:   user1.GetId(),
+				Name: "Etag updated",
+				Etag: user1.GetEtag(),
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update user: %s", err)
+		}
+
+		_, err = directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{
+				Id:   user1.GetId(),
+				Name: "Etag stale",
+				Etag: user1.GetEtag(),
+			},
+		})
+		if status.Code(err) != codes.Aborted {
+			t.Fatalf("Did not get correct error when updating with a stale etag: %s", err)
+		}
+		_, err = directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id:   user1.GetId(),
+			Etag: user1.GetEtag(),
+		})
+		if status.Code(err) != codes.Aborted {
+			t.Fatalf("Did not get correct error when deleting with a stale etag: %s", err)
+		}
+		_, err = directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id:   user1.GetId(),
+			Etag: "not an etag",
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when deleting with an invalid etag: %s", err)
+		}
+
+		user3, err := directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id:   user1.GetId(),
+			Etag: user2.GetEtag(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete user with current etag: %s", err)
+		}
+		_, err = directory.UndeleteUser(ctx, &userspb.UndeleteUserRequest{
+			Id:   user1.GetId(),
+			Etag: user2.GetEtag(),
+		})
+		if status.Code(err) != codes.Aborted {
+			t.Fatalf("Did not get correct error when undeleting with a stale etag: %s", err)
+		}
+		_, err = directory.UndeleteUser(ctx, &userspb.UndeleteUserRequest{
+			Id:   user1.GetId(),
+			Etag: user3.GetEtag(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to undelete user with current etag: %s", err)
+		}
+	})
+
+	t.Run("When retrying with a request ID", func(t *testing.T) {
+		t.Parallel()
+
+		req := &userspb.AddUserRequest{
+			Role:      userspb.Role_MEMBER,
+			Name:      "Retried",
+			RequestId: "retried-request",
+		}
+		user1, err := directory.AddUser(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+		user2, err := directory.AddUser(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to retry adding a user: %s", err)
+		}
+		if diff := cmp.Diff(user1, user2, protocmp.Transform()); diff != "" {
+			t.Fatalf("Retried user differed from added user:\n%s", diff)
+		}
+
+		_, err = directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role:      userspb.Role_MEMBER,
+			Name:      "Not retried",
+			RequestId: "retried-request",
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when reusing a request ID: %s", err)
+		}
+	})
+
+	t.Run("When retrying with a client ID", func(t *testing.T) {
+		t.Parallel()
+
+		req := &userspb.AddUserRequest{
+			Id:   "6ba7b810-9dad-41d1-80b4-00c04fd430c8",
+			Role: userspb.Role_GUEST,
+			Name: "Client ID",
+		}
+		user1, err := directory.AddUser(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+		if user1.GetId() != req.GetId() {
+			t.Fatalf("Got ID %q, wanted %q", user1.GetId(), req.GetId())
+		}
+		user2, err := directory.AddUser(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to retry adding a user: %s", err)
+		}
+		if diff := cmp.Diff(user1, user2, protocmp.Transform()); diff != "" {
+			t.Fatalf("Retried user differed from added user:\n%s", diff)
+		}
+
+		_, err = directory.AddUser(ctx, &userspb.AddUserRequest{
+			Id:   req.GetId(),
+			Role: userspb.Role_GUEST,
+			Name: "Someone else",
+		})
+		if status.Code(err) != codes.AlreadyExists {
+			t.Fatalf("Did not get correct error when reusing an ID: %s", err)
+		}
 	})
 
 	t.Run("When using a non-uuid in DeleteUser", func(t *testing.T) {
@@ -182,9 +450,1452 @@ func TestAddDeleteUser(t *testing.T) {
 			t.Fatalf("Did not get correct error when using non-UUID ID in DeleteUser")
 		}
 	})
+
+	t.Run("When deleting a missing user", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id: "00000000-0000-0000-0000-000000000000",
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Did not get correct error when deleting missing user: %s", err)
+		}
+	})
 }
 
-func TestListUsers(t *testing.T) {
+func TestUpdateUser(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	t.Run("When updating only the name", func(t *testing.T) {
+		t.Parallel()
+
+		user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_MEMBER,
+			Name: "Foo",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+
+		user2, err := directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{
+				Id:   user1.GetId(),
+				Name: "Bar",
+				Role: userspb.Role_ADMIN,
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update user: %s", err)
+		}
+
+		want := proto.Clone(user1).(*userspb.User)
+		want.Name = "Bar"
+		if diff := cmp.Diff(want, user2, protocmp.Transform(), protocmp.IgnoreFields(&userspb.User{}, "etag")); diff != "" {
+			t.Fatalf("Updated user was not as expected:\n%s", diff)
+		}
+		if user2.GetEtag() == user1.GetEtag() {
+			t.Fatalf("Etag was not changed by update")
+		}
+	})
+
+	t.Run("When updating without a mask", func(t *testing.T) {
+		t.Parallel()
+
+		user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_MEMBER,
+			Name: "Foo",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+
+		user2, err := directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{
+				Id:   user1.GetId(),
+				Role: userspb.Role_ADMIN,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update user: %s", err)
+		}
+
+		want := proto.Clone(user1).(*userspb.User)
+		want.Role = userspb.Role_ADMIN
+		if diff := cmp.Diff(want, user2, protocmp.Transform(), protocmp.IgnoreFields(&userspb.User{}, "etag")); diff != "" {
+			t.Fatalf("Updated user was not as expected:\n%s", diff)
+		}
+	})
+
+	t.Run("When using an unknown mask path", func(t *testing.T) {
+		t.Parallel()
+
+		user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_MEMBER,
+			Name: "Foo",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+
+		_, err = directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{
+				Id: user1.GetId(),
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"create_time"}},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when using unknown mask path: %s", err)
+		}
+	})
+
+	t.Run("When updating a missing user", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{
+				Id:   "00000000-0000-0000-0000-000000000000",
+				Name: "Bar",
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Did not get correct error when updating missing user: %s", err)
+		}
+	})
+}
+
+func TestGetUsers(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+		Role: userspb.Role_GUEST,
+		Name: "Foo",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a user: %s", err)
+	}
+	user2, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+		Role: userspb.Role_ADMIN,
+		Name: "Bar",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a user: %s", err)
+	}
+	// A valid UUID that doesn't belong to any user.
+	missingID := "00000000-0000-0000-0000-000000000000"
+
+	t.Run("When getting an added user", func(t *testing.T) {
+		t.Parallel()
+
+		user, err := directory.GetUser(ctx, &userspb.GetUserRequest{
+			Id: user1.GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to get user: %s", err)
+		}
+		if diff := cmp.Diff(user1, user, protocmp.Transform()); diff != "" {
+			t.Fatalf("Got user differed from created user:\n%s", diff)
+		}
+	})
+
+	t.Run("When getting a missing user", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := directory.GetUser(ctx, &userspb.GetUserRequest{
+			Id: missingID,
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Did not get correct error when getting missing user: %s", err)
+		}
+	})
+
+	t.Run("When using a non-uuid in GetUser", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := directory.GetUser(ctx, &userspb.GetUserRequest{
+			Id: "not_a_UUID",
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when using non-UUID ID in GetUser: %s", err)
+		}
+	})
+
+	t.Run("When batch getting users", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := directory.BatchGetUsers(ctx, &userspb.BatchGetUsersRequest{
+			Ids: []string{user2.GetId(), missingID, user1.GetId()},
+		})
+		if err != nil {
+			t.Fatalf("Failed to batch get users: %s", err)
+		}
+		want := &userspb.BatchGetUsersResponse{
+			Results: []*userspb.BatchGetUsersResult{
+				{
+					Id:     user2.GetId(),
+					Result: &userspb.BatchGetUsersResult_User{User: user2},
+				},
+				{
+					Id:     missingID,
+					Result: &userspb.BatchGetUsersResult_NotFound{NotFound: true},
+				},
+				{
+					Id:     user1.GetId(),
+					Result: &userspb.BatchGetUsersResult_User{User: user1},
+				},
+			},
+		}
+		if diff := cmp.Diff(want, resp, protocmp.Transform()); diff != "" {
+			t.Fatalf("Batch get response was not as expected:\n%s", diff)
+		}
+	})
+
+	t.Run("When batch getting too many users", func(t *testing.T) {
+		t.Parallel()
+
+		ids := make([]string, 101)
+		for i := range ids {
+			ids[i] = user1.GetId()
+		}
+		_, err := directory.BatchGetUsers(ctx, &userspb.BatchGetUsersRequest{
+			Ids: ids,
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when requesting too many users: %s", err)
+		}
+	})
+
+	t.Run("When using a non-uuid in BatchGetUsers", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := directory.BatchGetUsers(ctx, &userspb.BatchGetUsersRequest{
+			Ids: []string{user1.GetId(), "not_a_UUID"},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when using non-UUID ID in BatchGetUsers: %s", err)
+		}
+	})
+}
+
+func TestListUsers(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+		Role: userspb.Role_GUEST,
+		Name: "Foo",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a user: %s", err)
+	}
+
+	// Sleep so we have slightly different create times
+	time.Sleep(500 * time.Millisecond)
+
+	user2, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+		Role: userspb.Role_MEMBER,
+		Name: "Bar",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a user: %s", err)
+	}
+
+	// Sleep so we have slightly different create times
+	time.Sleep(500 * time.Millisecond)
+
+	user3, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+		Role: userspb.Role_ADMIN,
+		Name: "Baz",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a user: %s", err)
+	}
+
+	t.Run("Returning all users", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(new(userspb.ListUsersRequest), srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		if len(srv.users) != 3 {
+			t.Fatal("Did not receive 3 users as expected")
+		}
+		if diff := cmp.Diff(srv.users[0], user1, protocmp.Transform()); diff != "" {
+			t.Errorf("First user didn't match user1: %s", diff)
+		}
+		if diff := cmp.Diff(srv.users[1], user2, protocmp.Transform()); diff != "" {
+			t.Errorf("Second user didn't match user2: %s", diff)
+		}
+		if diff := cmp.Diff(srv.users[2], user3, protocmp.Transform()); diff != "" {
+			t.Errorf("Third user didn't match user3: %s", diff)
+		}
+	})
+
+	t.Run("Filtering by age", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		olderThan := time.Since(user2.GetCreateTime().AsTime())
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			OlderThan: durationpb.New(olderThan),
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		if len(srv.users) != 2 {
+			t.Fatal("Did not receive 2 users as expected")
+		}
+		if diff := cmp.Diff(srv.users[0], user1, protocmp.Transform()); diff != "" {
+			t.Errorf("First user didn't match user1: %s", diff)
+		}
+		if diff := cmp.Diff(srv.users[1], user2, protocmp.Transform()); diff != "" {
+			t.Errorf("Second user didn't match user2: %s", diff)
+		}
+	})
+
+	t.Run("Filtering by create time", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			CreatedSince: user1.GetCreateTime(),
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		if len(srv.users) != 2 {
+			t.Fatal("Did not receive 2 users as expected")
+		}
+		if diff := cmp.Diff(srv.users[0], user2, protocmp.Transform()); diff != "" {
+			t.Errorf("First user didn't match user2: %s", diff)
+		}
+		if diff := cmp.Diff(srv.users[1], user3, protocmp.Transform()); diff != "" {
+			t.Errorf("Second user didn't match user3: %s", diff)
+		}
+	})
+
+	t.Run("Filtering by age and create time", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		olderThan := time.Since(user2.GetCreateTime().AsTime())
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			CreatedSince: user1.GetCreateTime(),
+			OlderThan:    durationpb.New(olderThan),
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+		if len(srv.users) != 1 {
+			t.Fatal("Did not receive 2 users as expected")
+		}
+		if diff := cmp.Diff(srv.users[0], user2, protocmp.Transform()); diff != "" {
+			t.Errorf("First user didn't match user2: %s", diff)
+		}
+	})
+
+	t.Run("Filtering by roles", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			Roles: []userspb.Role{userspb.Role_GUEST, userspb.Role_ADMIN},
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		if len(srv.users) != 2 {
+			t.Fatal("Did not receive 2 users as expected")
+		}
+		if diff := cmp.Diff(srv.users[0], user1, protocmp.Transform()); diff != "" {
+			t.Errorf("First user didn't match user1: %s", diff)
+		}
+		if diff := cmp.Diff(srv.users[1], user3, protocmp.Transform()); diff != "" {
+			t.Errorf("Second user didn't match user3: %s", diff)
+		}
+	})
+
+	t.Run("Filtering by name prefix", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			NamePrefix: "Ba",
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		if len(srv.users) != 2 {
+			t.Fatal("Did not receive 2 users as expected")
+		}
+		if diff := cmp.Diff(srv.users[0], user2, protocmp.Transform()); diff != "" {
+			t.Errorf("First user didn't match user2: %s", diff)
+		}
+		if diff := cmp.Diff(srv.users[1], user3, protocmp.Transform()); diff != "" {
+			t.Errorf("Second user didn't match user3: %s", diff)
+		}
+	})
+
+	t.Run("Filtering by name prefix with pattern characters", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			NamePrefix: "%",
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		if len(srv.users) != 0 {
+			t.Fatalf("Expected no users, got %d", len(srv.users))
+		}
+	})
+
+	t.Run("Filtering by name substring", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			NameContains: "AZ",
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		if len(srv.users) != 1 {
+			t.Fatal("Did not receive 1 user as expected")
+		}
+		if diff := cmp.Diff(srv.users[0], user3, protocmp.Transform()); diff != "" {
+			t.Errorf("First user didn't match user3: %s", diff)
+		}
+	})
+
+	t.Run("Filtering by create time range", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			CreatedSince:  user1.GetCreateTime(),
+			CreatedBefore: user3.GetCreateTime(),
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		if len(srv.users) != 1 {
+			t.Fatal("Did not receive 1 user as expected")
+		}
+		if diff := cmp.Diff(srv.users[0], user2, protocmp.Transform()); diff != "" {
+			t.Errorf("First user didn't match user2: %s", diff)
+		}
+	})
+
+	t.Run("Filtering by expression", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			Filter: `role = ADMIN OR name:"oo"`,
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		if len(srv.users) != 2 {
+			t.Fatal("Did not receive 2 users as expected")
+		}
+		if diff := cmp.Diff(srv.users[0], user1, protocmp.Transform()); diff != "" {
+			t.Errorf("First user didn't match user1: %s", diff)
+		}
+		if diff := cmp.Diff(srv.users[1], user3, protocmp.Transform()); diff != "" {
+			t.Errorf("Second user didn't match user3: %s", diff)
+		}
+	})
+
+	t.Run("Filtering by invalid expression", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			Filter: `role = ADMIN AND`,
+		}, srv)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when using invalid filter: %s", err)
+		}
+	})
+
+	t.Run("Ordering by name descending", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			OrderBy: "name desc",
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		if len(srv.users) != 3 {
+			t.Fatal("Did not receive 3 users as expected")
+		}
+		if diff := cmp.Diff(srv.users[0], user1, protocmp.Transform()); diff != "" {
+			t.Errorf("First user didn't match user1: %s", diff)
+		}
+		if diff := cmp.Diff(srv.users[1], user3, protocmp.Transform()); diff != "" {
+			t.Errorf("Second user didn't match user3: %s", diff)
+		}
+		if diff := cmp.Diff(srv.users[2], user2, protocmp.Transform()); diff != "" {
+			t.Errorf("Third user didn't match user2: %s", diff)
+		}
+	})
+
+	t.Run("Ordering by unknown field", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			OrderBy: "password",
+		}, srv)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when ordering by unknown field: %s", err)
+		}
+	})
+}
+
+func TestListUsersPage(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	addSrv := &addUsersSrvFake{
+		ctx: ctx,
+	}
+	numUsers := 5
+	for i := 0; i < numUsers; i++ {
+		addSrv.reqs = append(addSrv.reqs, &userspb.AddUserRequest{
+			Role: userspb.Role_MEMBER,
+			Name: fmt.Sprintf("User %d", i),
+		})
+	}
+	// All users added in the same COPY share a create time,
+	// which exercises the ID tie-breaker.
+	err = directory.AddUsers(addSrv)
+	if err != nil {
+		t.Fatalf("Failed to add users: %s", err)
+	}
+
+	listSrv := &listUsersSrvFake{
+		ctx: ctx,
+	}
+	err = directory.ListUsers(new(userspb.ListUsersRequest), listSrv)
+	if err != nil {
+		t.Fatalf("Failed to list users: %s", err)
+	}
+	if len(listSrv.users) != numUsers {
+		t.Fatalf("Expected %d users, got %d", numUsers, len(listSrv.users))
+	}
+
+	t.Run("Paging through all users", func(t *testing.T) {
+		t.Parallel()
+
+		var got []*userspb.User
+		req := &userspb.ListUsersRequest{
+			PageSize: 2,
+		}
+		for {
+			resp, err := directory.ListUsersPage(ctx, req)
+			if err != nil {
+				t.Fatalf("Failed to list users page: %s", err)
+			}
+			if len(resp.GetUsers()) > 2 {
+				t.Fatalf("Got %d users in page of size 2", len(resp.GetUsers()))
+			}
+			got = append(got, resp.GetUsers()...)
+			if resp.GetNextPageToken() == "" {
+				break
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+
+		if diff := cmp.Diff(listSrv.users, got, protocmp.Transform()); diff != "" {
+			t.Errorf("Paged users didn't match listed users: %s", diff)
+		}
+	})
+
+	t.Run("Paging through users in a custom order", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			OrderBy: "role desc, name desc",
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		var got []*userspb.User
+		req := &userspb.ListUsersRequest{
+			PageSize: 2,
+			OrderBy:  "role desc, name desc",
+		}
+		for {
+			resp, err := directory.ListUsersPage(ctx, req)
+			if err != nil {
+				t.Fatalf("Failed to list users page: %s", err)
+			}
+			got = append(got, resp.GetUsers()...)
+			if resp.GetNextPageToken() == "" {
+				break
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+
+		if diff := cmp.Diff(srv.users, got, protocmp.Transform()); diff != "" {
+			t.Errorf("Paged users didn't match listed users: %s", diff)
+		}
+		if got[0].GetName() != fmt.Sprintf("User %d", numUsers-1) {
+			t.Errorf("Users were not ordered by name descending")
+		}
+	})
+
+	t.Run("Resuming a stream from a page token", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := directory.ListUsersPage(ctx, &userspb.ListUsersRequest{
+			PageSize: 3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to list users page: %s", err)
+		}
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+		err = directory.ListUsers(&userspb.ListUsersRequest{
+			PageToken: resp.GetNextPageToken(),
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+		if diff := cmp.Diff(listSrv.users[3:], srv.users, protocmp.Transform()); diff != "" {
+			t.Errorf("Streamed users didn't match remaining users: %s", diff)
+		}
+	})
+
+	t.Run("Resuming an interrupted stream", func(t *testing.T) {
+		t.Parallel()
+
+		req := &userspb.ListUsersRequest{
+			IncludeResumeTokens: true,
+		}
+		srv := &listUsersSrvFake{
+			ctx:       ctx,
+			failAfter: 2,
+		}
+		err := directory.ListUsers(req, srv)
+		if err == nil {
+			t.Fatal("Expected the stream to be interrupted")
+		}
+		if len(srv.users) != 2 {
+			t.Fatalf("Expected 2 users before interruption, got %d", len(srv.users))
+		}
+
+		req.ResumeToken = srv.users[1].GetResumeToken()
+		resumeSrv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+		err = directory.ListUsers(req, resumeSrv)
+		if err != nil {
+			t.Fatalf("Failed to resume listing users: %s", err)
+		}
+
+		got := append(srv.users, resumeSrv.users...)
+		if diff := cmp.Diff(listSrv.users, got, protocmp.Transform(), protocmp.IgnoreFields(&userspb.User{}, "resume_token")); diff != "" {
+			t.Errorf("Resumed users didn't match listed users: %s", diff)
+		}
+	})
+
+	t.Run("Resuming a stream with different filters", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+		err := directory.ListUsers(&userspb.ListUsersRequest{
+			IncludeResumeTokens: true,
+		}, srv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+
+		err = directory.ListUsers(&userspb.ListUsersRequest{
+			ResumeToken: srv.users[0].GetResumeToken(),
+			OlderThan:   durationpb.New(time.Second),
+		}, &listUsersSrvFake{
+			ctx: ctx,
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when changing filters: %s", err)
+		}
+	})
+
+	t.Run("Using a page token with different filters", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := directory.ListUsersPage(ctx, &userspb.ListUsersRequest{
+			PageSize: 1,
+		})
+		if err != nil {
+			t.Fatalf("Failed to list users page: %s", err)
+		}
+
+		_, err = directory.ListUsersPage(ctx, &userspb.ListUsersRequest{
+			PageSize:     1,
+			PageToken:    resp.GetNextPageToken(),
+			CreatedSince: listSrv.users[0].GetCreateTime(),
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when changing filters: %s", err)
+		}
+	})
+
+	t.Run("Using a tampered page token", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := directory.ListUsersPage(ctx, &userspb.ListUsersRequest{
+			PageSize: 1,
+		})
+		if err != nil {
+			t.Fatalf("Failed to list users page: %s", err)
+		}
+
+		token := []byte(resp.GetNextPageToken())
+		if token[0] == 'A' {
+			token[0] = 'B'
+		} else {
+			token[0] = 'A'
+		}
+		_, err = directory.ListUsersPage(ctx, &userspb.ListUsersRequest{
+			PageSize:  1,
+			PageToken: string(token),
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when using tampered token: %s", err)
+		}
+	})
+}
+
+func TestUserLabels(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	attributes, err := structpb.NewStruct(map[string]interface{}{
+		"locale":       "en-GB",
+		"external_ids": []interface{}{"a1", "b2"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create attributes: %s", err)
+	}
+	user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+		Role:       userspb.Role_MEMBER,
+		Name:       "Foo",
+		Labels:     map[string]string{"env": "prod", "team": "core"},
+		Attributes: attributes,
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a user: %s", err)
+	}
+	if diff := cmp.Diff(attributes, user1.GetAttributes(), protocmp.Transform()); diff != "" {
+		t.Fatalf("Attributes were not as expected:\n%s", diff)
+	}
+
+	addSrv := &addUsersSrvFake{
+		ctx: metadata.NewIncomingContext(ctx, metadata.Pairs(users.ReturnUsersKey, "true")),
+		reqs: []*userspb.AddUserRequest{
+			{Role: userspb.Role_GUEST, Name: "Bar", Labels: map[string]string{"env": "dev", "team": "core"}},
+			{Role: userspb.Role_GUEST, Name: "Baz"},
+		},
+	}
+	err = directory.AddUsers(addSrv)
+	if err != nil {
+		t.Fatalf("Failed to add users: %s", err)
+	}
+	user2, user3 := addSrv.resp.GetUsers()[0], addSrv.resp.GetUsers()[1]
+
+	t.Run("Getting a user with labels", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := directory.GetUser(ctx, &userspb.GetUserRequest{
+			Id: user1.GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to get user: %s", err)
+		}
+		if diff := cmp.Diff(user1, got, protocmp.Transform()); diff != "" {
+			t.Fatalf("User was not as expected:\n%s", diff)
+		}
+	})
+
+	// Not run in parallel, since other subtests add users.
+	t.Run("Selecting users by labels", func(t *testing.T) {
+		tests := []struct {
+			selector string
+			want     []*userspb.User
+		}{
+			{selector: "team=core", want: []*userspb.User{user1, user2}},
+			{selector: "team=core,env=prod", want: []*userspb.User{user1}},
+			{selector: "env!=prod", want: []*userspb.User{user2, user3}},
+			{selector: "!team", want: []*userspb.User{user3}},
+		}
+		for _, tt := range tests {
+			srv := &listUsersSrvFake{ctx: ctx}
+			err := directory.ListUsers(&userspb.ListUsersRequest{
+				LabelSelector: tt.selector,
+			}, srv)
+			if err != nil {
+				t.Fatalf("Failed to list users with %q: %s", tt.selector, err)
+			}
+			if diff := cmp.Diff(tt.want, srv.users, protocmp.Transform()); diff != "" {
+				t.Errorf("Users selected by %q were not as expected:\n%s", tt.selector, diff)
+			}
+		}
+	})
+
+	t.Run("Adding a user with invalid labels", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role:   userspb.Role_MEMBER,
+			Name:   "Invalid",
+			Labels: map[string]string{"Not a key": "value"},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when adding user with invalid labels: %s", err)
+		}
+	})
+
+	t.Run("Updating labels", func(t *testing.T) {
+		t.Parallel()
+
+		user, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role:   userspb.Role_MEMBER,
+			Name:   "Updated",
+			Labels: map[string]string{"stage": "old"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+		updated, err := directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{
+				Id:     user.GetId(),
+				Labels: map[string]string{"stage": "new"},
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"labels"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update user: %s", err)
+		}
+		if diff := cmp.Diff(map[string]string{"stage": "new"}, updated.GetLabels()); diff != "" {
+			t.Fatalf("Labels were not as expected:\n%s", diff)
+		}
+	})
+}
+
+func TestUserEmail(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	user, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+		Role:  userspb.Role_MEMBER,
+		Name:  "Foo",
+		Email: "Foo@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a user: %s", err)
+	}
+	if user.GetEmail() != "Foo@example.com" {
+		t.Fatalf("Email was not as expected: %q", user.GetEmail())
+	}
+
+	t.Run("Getting a user by email ignores case", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := directory.GetUserByEmail(ctx, &userspb.GetUserByEmailRequest{
+			Email: "foo@EXAMPLE.com",
+		})
+		if err != nil {
+			t.Fatalf("Failed to get user by email: %s", err)
+		}
+		if diff := cmp.Diff(user, got, protocmp.Transform()); diff != "" {
+			t.Fatalf("User was not as expected:\n%s", diff)
+		}
+	})
+	t.Run("Getting a missing email", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := directory.GetUserByEmail(ctx, &userspb.GetUserByEmailRequest{
+			Email: "missing@example.com",
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected NotFound, got %v", err)
+		}
+	})
+	t.Run("Adding a duplicate email", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role:  userspb.Role_GUEST,
+			Name:  "Bar",
+			Email: "FOO@example.com",
+		})
+		if status.Code(err) != codes.AlreadyExists {
+			t.Fatalf("Expected AlreadyExists, got %v", err)
+		}
+	})
+	t.Run("Updating to a duplicate email", func(t *testing.T) {
+		t.Parallel()
+
+		other, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role:  userspb.Role_GUEST,
+			Name:  "Baz",
+			Email: "baz@example.com",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+		_, err = directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+			User: &userspb.User{
+				Id:    other.GetId(),
+				Email: "foo@example.com",
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}},
+		})
+		if status.Code(err) != codes.AlreadyExists {
+			t.Fatalf("Expected AlreadyExists, got %v", err)
+		}
+	})
+	t.Run("Adding users without email", func(t *testing.T) {
+		t.Parallel()
+
+		for i := 0; i < 2; i++ {
+			_, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+				Role: userspb.Role_GUEST,
+				Name: "No email",
+			})
+			if err != nil {
+				t.Fatalf("Failed to add a user: %s", err)
+			}
+		}
+	})
+	t.Run("Adding an invalid email", func(t *testing.T) {
+		t.Parallel()
+
+		for _, email := range []string{"foo", "Foo <foo@example.com>", "foo@"} {
+			_, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+				Role:  userspb.Role_GUEST,
+				Name:  "Invalid",
+				Email: email,
+			})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Expected InvalidArgument for %q, got %v", email, err)
+			}
+		}
+	})
+}
+
+func TestRoles(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	t.Run("Built-in roles", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := directory.ListRoles(ctx, &userspb.ListRolesRequest{})
+		if err != nil {
+			t.Fatalf("Failed to list roles: %s", err)
+		}
+		var builtin []string
+		for _, role := range resp.GetRoles() {
+			if role.GetBuiltin() {
+				builtin = append(builtin, role.GetName())
+			}
+		}
+		if diff := cmp.Diff([]string{"admin", "guest", "member"}, builtin); diff != "" {
+			t.Fatalf("Built-in roles were not as expected:\n%s", diff)
+		}
+
+		_, err = directory.UpdateRole(ctx, &userspb.UpdateRoleRequest{
+			Role: &userspb.RoleDefinition{
+				Name:        "admin",
+				Description: "Changed",
+			},
+		})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("Expected FailedPrecondition updating a built-in role, got %v", err)
+		}
+		_, err = directory.DeleteRole(ctx, &userspb.DeleteRoleRequest{
+			Name: "guest",
+		})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("Expected FailedPrecondition deleting a built-in role, got %v", err)
+		}
+	})
+	t.Run("Assigning custom roles", func(t *testing.T) {
+		t.Parallel()
+
+		auditor, err := directory.CreateRole(ctx, &userspb.CreateRoleRequest{
+			Name:        "auditor",
+			Permissions: []string{"audit.*"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create role: %s", err)
+		}
+		_, err = directory.CreateRole(ctx, &userspb.CreateRoleRequest{
+			Name: "auditor",
+		})
+		if status.Code(err) != codes.AlreadyExists {
+			t.Fatalf("Expected AlreadyExists for a duplicate role, got %v", err)
+		}
+		support, err := directory.CreateRole(ctx, &userspb.CreateRoleRequest{
+			Name:        "support",
+			Permissions: []string{"users.update"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create role: %s", err)
+		}
+
+		user, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_GUEST,
+			Name: "Roles",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user: %s", err)
+		}
+		for _, role := range []string{"auditor", "support", "support"} {
+			_, err = directory.AssignRole(ctx, &userspb.AssignRoleRequest{
+				UserId: user.GetId(),
+				Role:   role,
+			})
+			if err != nil {
+				t.Fatalf("Failed to assign role %q: %s", role, err)
+			}
+		}
+		_, err = directory.AssignRole(ctx, &userspb.AssignRoleRequest{
+			UserId: user.GetId(),
+			Role:   "missing",
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected NotFound assigning a missing role, got %v", err)
+		}
+
+		roles, err := directory.ListUserRoles(ctx, &userspb.ListUserRolesRequest{
+			UserId: user.GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to list user roles: %s", err)
+		}
+		var names []string
+		for _, role := range roles.GetRoles() {
+			names = append(names, role.GetName())
+		}
+		if diff := cmp.Diff([]string{"auditor", "guest", "support"}, names); diff != "" {
+			t.Fatalf("User roles were not as expected:\n%s", diff)
+		}
+
+		for permission, want := range map[string]bool{
+			"users.get":     true,
+			"users.update":  true,
+			"audit.list":    true,
+			"groups.create": false,
+		} {
+			resp, err := directory.CheckPermission(ctx, &userspb.CheckPermissionRequest{
+				UserId:     user.GetId(),
+				Permission: permission,
+			})
+			if err != nil {
+				t.Fatalf("Failed to check permission: %s", err)
+			}
+			if resp.GetAllowed() != want {
+				t.Errorf("Expected permission %q to be allowed: %t, got %t", permission, want, resp.GetAllowed())
+			}
+		}
+
+		_, err = directory.DeleteRole(ctx, &userspb.DeleteRoleRequest{
+			Name: "support",
+		})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("Expected FailedPrecondition deleting an assigned role, got %v", err)
+		}
+		_, err = directory.UnassignRole(ctx, &userspb.UnassignRoleRequest{
+			UserId: user.GetId(),
+			Role:   "support",
+		})
+		if err != nil {
+			t.Fatalf("Failed to unassign role: %s", err)
+		}
+		_, err = directory.DeleteRole(ctx, &userspb.DeleteRoleRequest{
+			Name: "support",
+			Etag: support.GetEtag(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete role: %s", err)
+		}
+
+		updated, err := directory.UpdateRole(ctx, &userspb.UpdateRoleRequest{
+			Role: &userspb.RoleDefinition{
+				Name:        "auditor",
+				Permissions: []string{"audit.list"},
+				Etag:        auditor.GetEtag(),
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"permissions"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update role: %s", err)
+		}
+		if diff := cmp.Diff([]string{"audit.list"}, updated.GetPermissions()); diff != "" {
+			t.Fatalf("Permissions were not as expected:\n%s", diff)
+		}
+
+		// Soft deleted users have no permissions.
+		_, err = directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+			Id: user.GetId(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete user: %s", err)
+		}
+		resp, err := directory.CheckPermission(ctx, &userspb.CheckPermissionRequest{
+			UserId:     user.GetId(),
+			Permission: "audit.list",
+		})
+		if err != nil {
+			t.Fatalf("Failed to check permission: %s", err)
+		}
+		if resp.GetAllowed() {
+			t.Fatal("Expected a deleted user to have no permissions")
+		}
+	})
+}
+
+func TestUserStats(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	for _, role := range []userspb.Role{userspb.Role_GUEST, userspb.Role_MEMBER, userspb.Role_MEMBER} {
+		_, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: role,
+			Name: "Foo",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+	}
+
+	t.Run("Counting all users", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := directory.CountUsers(ctx, new(userspb.ListUsersRequest))
+		if err != nil {
+			t.Fatalf("Failed to count users: %s", err)
+		}
+		if resp.GetCount() != 3 {
+			t.Errorf("Got %d users, wanted 3", resp.GetCount())
+		}
+	})
+
+	t.Run("Counting filtered users", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := directory.CountUsers(ctx, &userspb.ListUsersRequest{
+			Filter: "role = MEMBER",
+		})
+		if err != nil {
+			t.Fatalf("Failed to count users: %s", err)
+		}
+		if resp.GetCount() != 2 {
+			t.Errorf("Got %d users, wanted 2", resp.GetCount())
+		}
+	})
+
+	t.Run("Getting stats", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := directory.GetUserStats(ctx, &userspb.GetUserStatsRequest{
+			Bucket: userspb.TimeBucket_HOUR,
+		})
+		if err != nil {
+			t.Fatalf("Failed to get user stats: %s", err)
+		}
+		if resp.GetCount() != 3 {
+			t.Errorf("Got %d users, wanted 3", resp.GetCount())
+		}
+		wantRoles := []*userspb.RoleCount{
+			{Role: userspb.Role_GUEST, Count: 1},
+			{Role: userspb.Role_MEMBER, Count: 2},
+		}
+		if diff := cmp.Diff(wantRoles, resp.GetRoleCounts(), protocmp.Transform()); diff != "" {
+			t.Errorf("Role counts were not as expected:\n%s", diff)
+		}
+		var histogramCount int64
+		for _, bucket := range resp.GetCreationHistogram() {
+			histogramCount += bucket.GetCount()
+			start := bucket.GetStartTime().AsTime()
+			if start.After(time.Now()) || time.Since(start) > time.Hour {
+				t.Errorf("Bucket start %s was not within the last hour", start)
+			}
+		}
+		if histogramCount != 3 {
+			t.Errorf("Got %d users in histogram, wanted 3", histogramCount)
+		}
+	})
+}
+
+func TestWatchUsers(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	directory, err := users.NewDirectory(log, startDatabase(t, log))
+	if err != nil {
+		t.Fatalf("Failed to create a new directory: %s", err)
+	}
+	t.Cleanup(func() {
+		err = directory.Close()
+		if err != nil {
+			t.Errorf("Failed to close directory: %s", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	watchCtx, watchCancel := context.WithCancel(ctx)
+	srv := &watchUsersSrvFake{
+		ctx:    watchCtx,
+		events: make(chan *userspb.UserEvent, 10),
+	}
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- directory.WatchUsers(new(userspb.WatchUsersRequest), srv)
+	}()
+
+	// Give the watcher some time to start listening
+	time.Sleep(time.Second)
+
+	user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+		Role: userspb.Role_MEMBER,
+		Name: "Foo",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a user: %s", err)
+	}
+	user2, err := directory.UpdateUser(ctx, &userspb.UpdateUserRequest{
+		User: &userspb.User{
+			Id:   user1.GetId(),
+			Name: "Bar",
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update user: %s", err)
+	}
+	user3, err := directory.DeleteUser(ctx, &userspb.DeleteUserRequest{
+		Id: user1.GetId(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete user: %s", err)
+	}
+
+	wantEvents := []*userspb.UserEvent{
+		{Type: userspb.UserEventType_CREATED, User: user1},
+		{Type: userspb.UserEventType_UPDATED, User: user2},
+		{Type: userspb.UserEventType_DELETED, User: user3},
+	}
+	for _, want := range wantEvents {
+		select {
+		case got := <-srv.events:
+			if diff := cmp.Diff(want, got, protocmp.Transform(), protocmp.IgnoreFields(&userspb.UserEvent{}, "event_time")); diff != "" {
+				t.Errorf("Event was not as expected:\n%s", diff)
+			}
+			if got.GetEventTime() == nil {
+				t.Error("EventTime was not set")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s event", want.GetType())
+		}
+	}
+
+	watchCancel()
+	err = <-watchErr
+	if status.Code(err) != codes.Canceled {
+		t.Errorf("Got error %v when cancelling watch, wanted Canceled", err)
+	}
+}
+
+func TestAddUsers(t *testing.T) {
 	t.Parallel()
 
 	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
@@ -202,140 +1913,228 @@ func TestListUsers(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	t.Cleanup(cancel)
 
-	user1, err := directory.AddUser(ctx, &userspb.AddUserRequest{
-		Role: userspb.Role_GUEST,
-		Name: "Foo",
-	})
-	if err != nil {
-		t.Fatalf("Failed to add a user: %s", err)
-	}
-
-	// Sleep so we have slightly different create times
-	time.Sleep(500 * time.Millisecond)
-
-	user2, err := directory.AddUser(ctx, &userspb.AddUserRequest{
-		Role: userspb.Role_MEMBER,
-		Name: "Bar",
-	})
-	if err != nil {
-		t.Fatalf("Failed to add a user: %s", err)
-	}
-
-	// Sleep so we have slightly different create times
-	time.Sleep(500 * time.Millisecond)
-
-	user3, err := directory.AddUser(ctx, &userspb.AddUserRequest{
-		Role: userspb.Role_ADMIN,
-		Name: "Baz",
-	})
-	if err != nil {
-		t.Fatalf("Failed to add a user: %s", err)
-	}
-
-	t.Run("Returning all users", func(t *testing.T) {
+	numUsers := 10
+	t.Run(fmt.Sprintf("Add %d users", numUsers), func(t *testing.T) {
 		t.Parallel()
 
-		srv := &listUsersSrvFake{
+		addSrv := &addUsersSrvFake{
 			ctx: ctx,
 		}
+		for i := 0; i < numUsers; i++ {
+			addSrv.reqs = append(addSrv.reqs, &userspb.AddUserRequest{
+				Role: userspb.Role_MEMBER,
+				Name: "Foo",
+			})
+		}
 
-		err := directory.ListUsers(new(userspb.ListUsersRequest), srv)
+		err = directory.AddUsers(addSrv)
 		if err != nil {
-			t.Fatalf("Failed to list users: %s", err)
+			t.Fatalf("Failed to add users: %s", err)
 		}
-
-		if len(srv.users) != 3 {
-			t.Fatal("Did not receive 3 users as expected")
+		if addSrv.resp.GetCount() != int64(numUsers) {
+			t.Fatalf("Expected count %d, got %d", numUsers, addSrv.resp.GetCount())
 		}
-		if diff := cmp.Diff(srv.users[0], user1, protocmp.Transform()); diff != "" {
-			t.Errorf("First user didn't match user1: %s", diff)
+		if len(addSrv.resp.GetUsers()) != 0 {
+			t.Fatalf("Got %d users without requesting them", len(addSrv.resp.GetUsers()))
 		}
-		if diff := cmp.Diff(srv.users[1], user2, protocmp.Transform()); diff != "" {
-			t.Errorf("Second user didn't match user2: %s", diff)
+
+		listSrv := &listUsersSrvFake{
+			ctx: ctx,
 		}
-		if diff := cmp.Diff(srv.users[2], user3, protocmp.Transform()); diff != "" {
-			t.Errorf("Third user didn't match user3: %s", diff)
+		err = directory.ListUsers(&userspb.ListUsersRequest{
+			NamePrefix: "Foo",
+		}, listSrv)
+		if err != nil {
+			t.Fatalf("Failed to list users: %s", err)
+		}
+		if len(listSrv.users) != numUsers {
+			t.Fatalf("Expected %d users, got %d", numUsers, len(listSrv.users))
 		}
 	})
 
-	t.Run("Filtering by age", func(t *testing.T) {
+	t.Run("Returning the added users", func(t *testing.T) {
 		t.Parallel()
 
-		srv := &listUsersSrvFake{
-			ctx: ctx,
+		addSrv := &addUsersSrvFake{
+			ctx: metadata.NewIncomingContext(ctx, metadata.Pairs(users.ReturnUsersKey, "true")),
+			reqs: []*userspb.AddUserRequest{
+				{Role: userspb.Role_ADMIN, Name: "Returned 1"},
+				{Role: userspb.Role_GUEST, Name: "Returned 2"},
+			},
 		}
-
-		olderThan := time.Since(user2.GetCreateTime().AsTime())
-
-		err := directory.ListUsers(&userspb.ListUsersRequest{
-			OlderThan: durationpb.New(olderThan),
-		}, srv)
+		err := directory.AddUsers(addSrv)
 		if err != nil {
-			t.Fatalf("Failed to list users: %s", err)
+			t.Fatalf("Failed to add users: %s", err)
 		}
-
-		if len(srv.users) != 2 {
-			t.Fatal("Did not receive 2 users as expected")
+		if addSrv.resp.GetCount() != 2 {
+			t.Fatalf("Expected count 2, got %d", addSrv.resp.GetCount())
 		}
-		if diff := cmp.Diff(srv.users[0], user1, protocmp.Transform()); diff != "" {
-			t.Errorf("First user didn't match user1: %s", diff)
+		if len(addSrv.resp.GetUsers()) != 2 {
+			t.Fatalf("Expected 2 users, got %d", len(addSrv.resp.GetUsers()))
 		}
-		if diff := cmp.Diff(srv.users[1], user2, protocmp.Transform()); diff != "" {
-			t.Errorf("Second user didn't match user2: %s", diff)
+		for i, want := range []string{"Returned 1", "Returned 2"} {
+			user := addSrv.resp.GetUsers()[i]
+			if user.GetName() != want {
+				t.Errorf("Got user %d name %q, wanted %q", i, user.GetName(), want)
+			}
+			got, err := directory.GetUser(ctx, &userspb.GetUserRequest{
+				Id: user.GetId(),
+			})
+			if err != nil {
+				t.Fatalf("Failed to get added user: %s", err)
+			}
+			if diff := cmp.Diff(user, got, protocmp.Transform()); diff != "" {
+				t.Errorf("Added user differed from stored user:\n%s", diff)
+			}
 		}
 	})
 
-	t.Run("Filtering by create time", func(t *testing.T) {
+	t.Run("Failing on an invalid user", func(t *testing.T) {
 		t.Parallel()
 
-		srv := &listUsersSrvFake{
+		addSrv := &addUsersSrvFake{
 			ctx: ctx,
+			reqs: []*userspb.AddUserRequest{
+				{Role: userspb.Role_ADMIN, Name: "Atomic"},
+				{Role: userspb.Role(10), Name: "Atomic"},
+			},
+		}
+		err := directory.AddUsers(addSrv)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when adding invalid user: %s", err)
+		}
+		if !strings.Contains(err.Error(), "user 1") {
+			t.Errorf("Error %q did not identify the invalid user", err)
 		}
 
-		err := directory.ListUsers(&userspb.ListUsersRequest{
-			CreatedSince: user1.GetCreateTime(),
-		}, srv)
+		listSrv := &listUsersSrvFake{
+			ctx: ctx,
+		}
+		err = directory.ListUsers(&userspb.ListUsersRequest{
+			NamePrefix: "Atomic",
+		}, listSrv)
 		if err != nil {
 			t.Fatalf("Failed to list users: %s", err)
 		}
+		if len(listSrv.users) != 0 {
+			t.Fatalf("Expected no users to be added, got %d", len(listSrv.users))
+		}
+	})
 
-		if len(srv.users) != 2 {
-			t.Fatal("Did not receive 2 users as expected")
+	t.Run("Reporting invalid users", func(t *testing.T) {
+		t.Parallel()
+
+		addSrv := &addUsersSrvFake{
+			ctx: metadata.NewIncomingContext(ctx, metadata.Pairs(
+				users.ReturnUsersKey, "true",
+				users.ValidationModeKey, users.ValidationModeReport,
+			)),
+			reqs: []*userspb.AddUserRequest{
+				{Role: userspb.Role(10), Name: "Reported"},
+				{Role: userspb.Role_MEMBER, Name: "Reported"},
+				{Role: userspb.Role(11), Name: "Reported"},
+			},
 		}
-		if diff := cmp.Diff(srv.users[0], user2, protocmp.Transform()); diff != "" {
-			t.Errorf("First user didn't match user2: %s", diff)
+		err := directory.AddUsers(addSrv)
+		if err != nil {
+			t.Fatalf("Failed to add users: %s", err)
 		}
-		if diff := cmp.Diff(srv.users[1], user3, protocmp.Transform()); diff != "" {
-			t.Errorf("Second user didn't match user3: %s", diff)
+		if addSrv.resp.GetCount() != 1 {
+			t.Fatalf("Expected count 1, got %d", addSrv.resp.GetCount())
+		}
+		if len(addSrv.resp.GetUsers()) != 1 || addSrv.resp.GetUsers()[0].GetRole() != userspb.Role_MEMBER {
+			t.Fatalf("Added users were not as expected: %v", addSrv.resp.GetUsers())
+		}
+		var gotIndexes []int64
+		for _, failure := range addSrv.resp.GetFailures() {
+			gotIndexes = append(gotIndexes, failure.GetIndex())
+			if failure.GetReason() == "" {
+				t.Errorf("Failure %d had no reason", failure.GetIndex())
+			}
+		}
+		if diff := cmp.Diff([]int64{0, 2}, gotIndexes); diff != "" {
+			t.Errorf("Failures were not as expected:\n%s", diff)
 		}
 	})
 
-	t.Run("Filtering by age and create time", func(t *testing.T) {
+	t.Run("Handling conflicting IDs", func(t *testing.T) {
 		t.Parallel()
 
-		srv := &listUsersSrvFake{
-			ctx: ctx,
+		existing, err := directory.AddUser(ctx, &userspb.AddUserRequest{
+			Role: userspb.Role_GUEST,
+			Name: "Conflicting",
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a user: %s", err)
+		}
+		reqs := func() []*userspb.AddUserRequest {
+			return []*userspb.AddUserRequest{
+				{Id: existing.GetId(), Role: userspb.Role_ADMIN, Name: "Conflicting updated"},
+				{Role: userspb.Role_MEMBER, Name: "Not conflicting"},
+			}
 		}
 
-		olderThan := time.Since(user2.GetCreateTime().AsTime())
+		addSrv := &addUsersSrvFake{
+			ctx:  ctx,
+			reqs: reqs(),
+		}
+		err = directory.AddUsers(addSrv)
+		if status.Code(err) != codes.AlreadyExists {
+			t.Fatalf("Did not get correct error when adding conflicting user: %s", err)
+		}
 
-		err := directory.ListUsers(&userspb.ListUsersRequest{
-			CreatedSince: user1.GetCreateTime(),
-			OlderThan:    durationpb.New(olderThan),
-		}, srv)
+		addSrv = &addUsersSrvFake{
+			ctx: metadata.NewIncomingContext(ctx, metadata.Pairs(
+				users.ReturnUsersKey, "true",
+				users.ConflictModeKey, users.ConflictModeIgnore,
+			)),
+			reqs: reqs(),
+		}
+		err = directory.AddUsers(addSrv)
 		if err != nil {
-			t.Fatalf("Failed to list users: %s", err)
+			t.Fatalf("Failed to add users: %s", err)
 		}
-		if len(srv.users) != 1 {
-			t.Fatal("Did not receive 2 users as expected")
+		if addSrv.resp.GetCount() != 1 {
+			t.Fatalf("Expected count 1, got %d", addSrv.resp.GetCount())
 		}
-		if diff := cmp.Diff(srv.users[0], user2, protocmp.Transform()); diff != "" {
-			t.Errorf("First user didn't match user2: %s", diff)
+		if diff := cmp.Diff(existing, addSrv.resp.GetUsers()[0], protocmp.Transform()); diff != "" {
+			t.Fatalf("Ignored user was not as expected:\n%s", diff)
+		}
+
+		addSrv = &addUsersSrvFake{
+			ctx: metadata.NewIncomingContext(ctx, metadata.Pairs(
+				users.ReturnUsersKey, "true",
+				users.ConflictModeKey, users.ConflictModeUpdate,
+			)),
+			reqs: reqs()[:1],
+		}
+		err = directory.AddUsers(addSrv)
+		if err != nil {
+			t.Fatalf("Failed to add users: %s", err)
+		}
+		if addSrv.resp.GetCount() != 1 {
+			t.Fatalf("Expected count 1, got %d", addSrv.resp.GetCount())
+		}
+		updated := addSrv.resp.GetUsers()[0]
+		if updated.GetRole() != userspb.Role_ADMIN || updated.GetName() != "Conflicting updated" {
+			t.Fatalf("Updated user was not as expected: %v", updated)
+		}
+	})
+
+	t.Run("Using an invalid validation mode", func(t *testing.T) {
+		t.Parallel()
+
+		addSrv := &addUsersSrvFake{
+			ctx: metadata.NewIncomingContext(ctx, metadata.Pairs(users.ValidationModeKey, "lenient")),
+		}
+		err := directory.AddUsers(addSrv)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when using invalid validation mode: %s", err)
 		}
 	})
 }
 
-func TestAddUsers(t *testing.T) {
+func TestImportUsers(t *testing.T) {
 	t.Parallel()
 
 	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
@@ -353,34 +2152,186 @@ func TestAddUsers(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	t.Cleanup(cancel)
 
-	numUsers := 10
-	t.Run(fmt.Sprintf("Add %d users", numUsers), func(t *testing.T) {
+	chunk := func(importID string, n int64, names ...string) *userspb.ImportUsersRequest {
+		req := &userspb.ImportUsersRequest{
+			ImportId: importID,
+			Chunk:    n,
+		}
+		for _, name := range names {
+			req.Users = append(req.Users, &userspb.AddUserRequest{
+				Role: userspb.Role_MEMBER,
+				Name: name,
+			})
+		}
+		return req
+	}
+
+	t.Run("Resuming an interrupted import", func(t *testing.T) {
 		t.Parallel()
 
-		addSrv := &addUsersSrvFake{
+		srv := &importUsersSrvFake{
 			ctx: ctx,
+			reqs: []*userspb.ImportUsersRequest{
+				chunk("resumed", 0, "Import 1", "Import 2"),
+				chunk("resumed", 1, "Import 3"),
+			},
 		}
-		for i := 0; i < numUsers; i++ {
-			addSrv.reqs = append(addSrv.reqs, &userspb.AddUserRequest{
-				Role: userspb.Role_MEMBER,
-				Name: "Foo",
+		err := directory.ImportUsers(srv)
+		if err != nil {
+			t.Fatalf("Failed to import users: %s", err)
+		}
+		if len(srv.resps) != 2 {
+			t.Fatalf("Expected 2 acknowledgements, got %d", len(srv.resps))
+		}
+		first, second := srv.resps[0], srv.resps[1]
+		if first.GetFirstRow() != 0 || first.GetRowCount() != 2 || first.GetCount() != 2 || len(first.GetIds()) != 2 {
+			t.Errorf("First acknowledgement was not as expected: %v", first)
+		}
+		if second.GetFirstRow() != 2 || second.GetRowCount() != 1 || second.GetCount() != 1 || len(second.GetIds()) != 1 {
+			t.Errorf("Second acknowledgement was not as expected: %v", second)
+		}
+		for i, id := range append(first.GetIds(), second.GetIds()...) {
+			user, err := directory.GetUser(ctx, &userspb.GetUserRequest{
+				Id: id,
 			})
+			if err != nil {
+				t.Fatalf("Failed to get imported user: %s", err)
+			}
+			want := fmt.Sprintf("Import %d", i+1)
+			if user.GetName() != want {
+				t.Errorf("Got name %q, wanted %q", user.GetName(), want)
+			}
 		}
 
-		err = directory.AddUsers(addSrv)
+		// Simulate a client that didn't see the last acknowledgement.
+		srv = &importUsersSrvFake{
+			ctx: ctx,
+			reqs: []*userspb.ImportUsersRequest{
+				chunk("resumed", 1, "Import 3"),
+				chunk("resumed", 2, "Import 4"),
+			},
+		}
+		err = directory.ImportUsers(srv)
 		if err != nil {
-			t.Fatalf("Failed to add users: %s", err)
+			t.Fatalf("Failed to resume import: %s", err)
+		}
+		if len(srv.resps) != 2 {
+			t.Fatalf("Expected 2 acknowledgements, got %d", len(srv.resps))
+		}
+		want := proto.Clone(second).(*userspb.ImportUsersResponse)
+		want.AlreadyCommitted = true
+		if diff := cmp.Diff(want, srv.resps[0], protocmp.Transform()); diff != "" {
+			t.Errorf("Replayed acknowledgement was not as expected:\n%s", diff)
+		}
+		if srv.resps[1].GetFirstRow() != 3 || srv.resps[1].GetAlreadyCommitted() {
+			t.Errorf("Resumed acknowledgement was not as expected: %v", srv.resps[1])
 		}
 
 		listSrv := &listUsersSrvFake{
 			ctx: ctx,
 		}
-		err = directory.ListUsers(new(userspb.ListUsersRequest), listSrv)
+		err = directory.ListUsers(&userspb.ListUsersRequest{
+			NamePrefix: "Import ",
+		}, listSrv)
 		if err != nil {
 			t.Fatalf("Failed to list users: %s", err)
 		}
-		if len(listSrv.users) != numUsers {
-			t.Fatalf("Expected %d users, got %d", numUsers, len(listSrv.users))
+		if len(listSrv.users) != 4 {
+			t.Fatalf("Expected 4 users, got %d", len(listSrv.users))
+		}
+	})
+
+	t.Run("Resuming with different users", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &importUsersSrvFake{
+			ctx:  ctx,
+			reqs: []*userspb.ImportUsersRequest{chunk("changed", 0, "Changed 1")},
+		}
+		err := directory.ImportUsers(srv)
+		if err != nil {
+			t.Fatalf("Failed to import users: %s", err)
+		}
+
+		srv = &importUsersSrvFake{
+			ctx:  ctx,
+			reqs: []*userspb.ImportUsersRequest{chunk("changed", 0, "Changed 2")},
+		}
+		err = directory.ImportUsers(srv)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when resuming with different users: %s", err)
+		}
+		if len(srv.resps) != 0 {
+			t.Fatalf("Expected no acknowledgements, got %d", len(srv.resps))
+		}
+	})
+
+	t.Run("Skipping a chunk", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &importUsersSrvFake{
+			ctx: ctx,
+			reqs: []*userspb.ImportUsersRequest{
+				chunk("skipped", 0, "Skipped 1"),
+				chunk("skipped", 2, "Skipped 2"),
+			},
+		}
+		err := directory.ImportUsers(srv)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("Did not get correct error when skipping a chunk: %s", err)
+		}
+		if len(srv.resps) != 1 {
+			t.Fatalf("Expected 1 acknowledgement, got %d", len(srv.resps))
+		}
+	})
+
+	t.Run("Reporting invalid users", func(t *testing.T) {
+		t.Parallel()
+
+		req := chunk("reported", 0, "Reported 1", "Reported 2")
+		req.Users[1].Role = userspb.Role(10)
+		srv := &importUsersSrvFake{
+			ctx:  metadata.NewIncomingContext(ctx, metadata.Pairs(users.ValidationModeKey, users.ValidationModeReport)),
+			reqs: []*userspb.ImportUsersRequest{req},
+		}
+		err := directory.ImportUsers(srv)
+		if err != nil {
+			t.Fatalf("Failed to import users: %s", err)
+		}
+		if len(srv.resps) != 1 {
+			t.Fatalf("Expected 1 acknowledgement, got %d", len(srv.resps))
+		}
+		if srv.resps[0].GetCount() != 1 || len(srv.resps[0].GetFailures()) != 1 || srv.resps[0].GetFailures()[0].GetIndex() != 1 {
+			t.Errorf("Acknowledgement was not as expected: %v", srv.resps[0])
+		}
+	})
+
+	t.Run("Sending unsupported metadata", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &importUsersSrvFake{
+			ctx:  metadata.NewIncomingContext(ctx, metadata.Pairs(users.ReturnUsersKey, "true")),
+			reqs: []*userspb.ImportUsersRequest{chunk("unsupported", 0, "Unsupported")},
+		}
+		err := directory.ImportUsers(srv)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when sending unsupported metadata: %s", err)
+		}
+		if len(srv.resps) != 0 {
+			t.Fatalf("Expected no acknowledgements, got %d", len(srv.resps))
+		}
+	})
+
+	t.Run("Sending an empty chunk", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &importUsersSrvFake{
+			ctx:  ctx,
+			reqs: []*userspb.ImportUsersRequest{chunk("empty", 0)},
+		}
+		err := directory.ImportUsers(srv)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Did not get correct error when sending an empty chunk: %s", err)
 		}
 	})
 }
@@ -461,9 +2412,11 @@ type addUsersSrvFake struct {
 	grpc.ServerStream
 	reqs []*userspb.AddUserRequest
 	ctx  context.Context
+	resp *userspb.AddUsersResponse
 }
 
-func (a *addUsersSrvFake) SendAndClose(_ *emptypb.Empty) error {
+func (a *addUsersSrvFake) SendAndClose(resp *userspb.AddUsersResponse) error {
+	a.resp = resp
 	return nil
 }
 
@@ -482,13 +2435,61 @@ func (a *addUsersSrvFake) Context() context.Context {
 	return a.ctx
 }
 
+type importUsersSrvFake struct {
+	grpc.ServerStream
+	ctx   context.Context
+	reqs  []*userspb.ImportUsersRequest
+	resps []*userspb.ImportUsersResponse
+}
+
+func (i *importUsersSrvFake) Recv() (*userspb.ImportUsersRequest, error) {
+	if len(i.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := i.reqs[0]
+	i.reqs = i.reqs[1:]
+	return req, nil
+}
+
+func (i *importUsersSrvFake) Send(resp *userspb.ImportUsersResponse) error {
+	i.resps = append(i.resps, resp)
+	return nil
+}
+
+// Context returns the context for this stream.
+func (i *importUsersSrvFake) Context() context.Context {
+	return i.ctx
+}
+
+type watchUsersSrvFake struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *userspb.UserEvent
+}
+
+func (w *watchUsersSrvFake) Send(event *userspb.UserEvent) error {
+	w.events <- event
+	return nil
+}
+
+// Context returns the context for this stream.
+func (w *watchUsersSrvFake) Context() context.Context {
+	return w.ctx
+}
+
 type listUsersSrvFake struct {
 	grpc.ServerStream
 	ctx   context.Context
 	users []*userspb.User
+	// failAfter simulates a broken stream after this
+	// many users have been sent, if set.
+	failAfter int
 }
 
 func (l *listUsersSrvFake) Send(user *userspb.User) error {
+	if l.failAfter > 0 && len(l.users) == l.failAfter {
+		return io.ErrUnexpectedEOF
+	}
 	l.users = append(l.users, user)
 	return nil
 }
@@ -0,0 +1,484 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+const (
+	// userChangesChannel is the channel notified by the
+	// notify_user_change trigger.
+	userChangesChannel = "user_changes"
+	// watcherBufferSize is the number of events buffered for
+	// each watcher. Watchers that fall further behind are dropped.
+	watcherBufferSize = 128
+	maxListenBackoff  = 30 * time.Second
+)
+
+// WatchUsers streams changes to users as they happen.
+func (d Directory) WatchUsers(req *userspb.WatchUsersRequest, srv userspb.UserService_WatchUsersServer) error {
+	return d.userServer().WatchUsers(req, srv)
+}
+
+// WatchUserEvents calls fn for each change to users, as they happen,
+// until fn fails or the context is cancelled.
+func (d Directory) WatchUserEvents(ctx context.Context, fn func(*userspb.UserEvent) error) error {
+	return d.watchers.watch(ctx, fn)
+}
+
+// listenFunc listens for changes to users, calling ready once it is
+// listening and emit for each change, until an error occurs or the
+// context is cancelled.
+type listenFunc func(ctx context.Context, ready func(), emit func(*userspb.UserEvent)) error
+
+type watcher struct {
+	events chan *userspb.UserEvent
+	// err is set before events is closed.
+	err error
+}
+
+// watchHub fans out changes from a single listener to all watchers. The
+// listener is started when the first watcher subscribes, and reconnects
+// with a backoff if it fails. Since changes may be missed while it is
+// disconnected, all watchers are dropped when it fails.
+type watchHub struct {
+	logger *slog.Logger
+	listen listenFunc
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu        sync.Mutex
+	started   bool
+	listening bool
+	// ready is closed when the listener starts listening.
+	ready    chan struct{}
+	watchers map[*watcher]struct{}
+}
+
+func newWatchHub(logger *slog.Logger, listen listenFunc) *watchHub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watchHub{
+		logger:   logger,
+		listen:   listen,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		ready:    make(chan struct{}),
+		watchers: map[*watcher]struct{}{},
+	}
+}
+
+// subscribe adds a watcher, waiting for the listener to be listening so
+// that no changes made after subscribe returns are missed.
+func (h *watchHub) subscribe(ctx context.Context) (*watcher, error) {
+	for {
+		h.mu.Lock()
+		if !h.started {
+			h.started = true
+			go h.run()
+		}
+		if h.listening {
+			w := &watcher{
+				events: make(chan *userspb.UserEvent, watcherBufferSize),
+			}
+			h.watchers[w] = struct{}{}
+			h.mu.Unlock()
+			return w, nil
+		}
+		ready := h.ready
+		h.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-h.ctx.Done():
+			return nil, status.Error(codes.Unavailable, "server is closing")
+		}
+	}
+}
+
+// watch calls fn for each event emitted after it starts watching, until
+// fn fails, the watcher is dropped or the context is cancelled.
+func (h *watchHub) watch(ctx context.Context, fn func(*userspb.UserEvent) error) error {
+	w, err := h.subscribe(ctx)
+	if err != nil {
+		return err
+	}
+	defer h.unsubscribe(w)
+
+	for {
+		select {
+		case event, ok := <-w.events:
+			if !ok {
+				return w.err
+			}
+			err = fn(event)
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+func (h *watchHub) unsubscribe(w *watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.watchers, w)
+}
+
+func (h *watchHub) run() {
+	defer close(h.done)
+	backoff := time.Second
+	for {
+		err := h.listen(h.ctx, h.setListening, h.emit)
+		h.dropWatchers(status.Error(codes.Unavailable, "lost track of user changes, please list users and watch again"))
+		if h.ctx.Err() != nil {
+			return
+		}
+		h.logger.Error("Failed to listen for user changes", "error", err, "retry_in", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-h.ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, maxListenBackoff)
+	}
+}
+
+func (h *watchHub) setListening() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listening = true
+	close(h.ready)
+}
+
+func (h *watchHub) emit(event *userspb.UserEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		select {
+		case w.events <- event:
+		default:
+			w.err = status.Error(codes.ResourceExhausted, "watcher fell behind, please list users and watch again")
+			close(w.events)
+			delete(h.watchers, w)
+		}
+	}
+}
+
+func (h *watchHub) dropWatchers(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		w.err = err
+		close(w.events)
+		delete(h.watchers, w)
+	}
+	if h.listening {
+		h.listening = false
+		h.ready = make(chan struct{})
+	}
+}
+
+// close stops the listener, if started, and drops all watchers.
+func (h *watchHub) close() {
+	h.cancel()
+	h.mu.Lock()
+	started := h.started
+	h.mu.Unlock()
+	if started {
+		<-h.done
+	}
+}
+
+// listenLocal is the listener of stores that emit the changes they make
+// to the hub themselves, since they are the only writers.
+func listenLocal(ctx context.Context, ready func(), _ func(*userspb.UserEvent)) error {
+	ready()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// userEvent returns the event reporting the change to the user, made
+// at the time provided, for stores emitting their own changes.
+func userEvent(eventType userspb.UserEventType, user *userspb.User, eventTime time.Time) *userspb.UserEvent {
+	return &userspb.UserEvent{
+		Type: eventType,
+		// The user is returned to the caller too.
+		User:      proto.Clone(user).(*userspb.User),
+		EventTime: timestamppb.New(eventTime),
+	}
+}
+
+// listenPostgres listens for changes using LISTEN/NOTIFY, on a dedicated
+// connection.
+func listenPostgres(config *pgx.ConnConfig) listenFunc {
+	return func(ctx context.Context, ready func(), emit func(*userspb.UserEvent)) error {
+		conn, err := pgx.ConnectConfig(ctx, config)
+		if err != nil {
+			return fmt.Errorf("connecting: %w", err)
+		}
+		defer conn.Close(context.Background())
+
+		_, err = conn.Exec(ctx, "LISTEN "+userChangesChannel)
+		if err != nil {
+			return fmt.Errorf("listening: %w", err)
+		}
+		ready()
+
+		for {
+			n, err := conn.WaitForNotification(ctx)
+			if err != nil {
+				return fmt.Errorf("waiting for notification: %w", err)
+			}
+			var payload struct {
+				Op   string          `json:"op"`
+				Time string          `json:"time"`
+				User json.RawMessage `json:"user"`
+				// Truncated is set if the labels and attributes were
+				// left out, to fit the notification size limit.
+				Truncated bool `json:"truncated"`
+			}
+			err = json.Unmarshal([]byte(n.Payload), &payload)
+			if err != nil {
+				return fmt.Errorf("decoding notification: %w", err)
+			}
+			event := new(userspb.UserEvent)
+			event.User, err = jsonUserToProto(payload.User)
+			if err != nil {
+				return fmt.Errorf("decoding notification user: %w", err)
+			}
+			if payload.Truncated && payload.Op != "DELETE" {
+				event.User, err = lookupTruncatedUser(ctx, conn, event.GetUser())
+				if err != nil {
+					return fmt.Errorf("looking up truncated user: %w", err)
+				}
+			}
+			deleted := event.GetUser().GetDeleteTime() != nil
+			switch payload.Op {
+			case "INSERT":
+				event.Type = userspb.UserEventType_CREATED
+			case "UPDATE":
+				// Soft deletes are the only updates that set
+				// the delete time, since deleted users can't be updated.
+				if deleted {
+					event.Type = userspb.UserEventType_DELETED
+				} else {
+					event.Type = userspb.UserEventType_UPDATED
+				}
+			case "DELETE":
+				if deleted {
+					// Purged or force deleted after being soft deleted,
+					// which was already reported.
+					continue
+				}
+				event.Type = userspb.UserEventType_DELETED
+			default:
+				return fmt.Errorf("unexpected operation %q", payload.Op)
+			}
+			eventTime, err := parseJSONTime(payload.Time)
+			if err != nil {
+				return fmt.Errorf("decoding notification time: %w", err)
+			}
+			event.EventTime = timestamppb.New(eventTime)
+			emit(event)
+		}
+	}
+}
+
+// lookupTruncatedUser looks up the labels and attributes of a user left
+// out of a notification. Since the user may have changed since, they are
+// only used if the user is still at the same version.
+func lookupTruncatedUser(ctx context.Context, conn *pgx.Conn, user *userspb.User) (*userspb.User, error) {
+	version, err := parseEtag(user.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+	var labels, attributes json.RawMessage
+	err = conn.QueryRow(
+		ctx,
+		"SELECT labels, attributes FROM users WHERE id = $1 AND version = $2",
+		user.GetId(), version,
+	).Scan(&labels, &attributes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, nil
+		}
+		return nil, err
+	}
+	user.Labels, err = decodeLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+	user.Attributes, err = decodeAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// listenCockroachDB listens for changes using a core changefeed, on a
+// dedicated connection. Changefeeds require rangefeeds to be enabled with
+// the kv.rangefeed.enabled cluster setting.
+func listenCockroachDB(config *pgx.ConnConfig) listenFunc {
+	return func(ctx context.Context, ready func(), emit func(*userspb.UserEvent)) error {
+		conn, err := pgx.ConnectConfig(ctx, config)
+		if err != nil {
+			return fmt.Errorf("connecting: %w", err)
+		}
+		defer conn.Close(context.Background())
+
+		rows, err := conn.Query(ctx, "EXPERIMENTAL CHANGEFEED FOR users WITH diff, updated")
+		if err != nil {
+			return fmt.Errorf("starting changefeed: %w", err)
+		}
+		defer rows.Close()
+		ready()
+
+		for rows.Next() {
+			var table string
+			var key, value []byte
+			err = rows.Scan(&table, &key, &value)
+			if err != nil {
+				return fmt.Errorf("scanning changefeed row: %w", err)
+			}
+			var payload struct {
+				After   json.RawMessage `json:"after"`
+				Before  json.RawMessage `json:"before"`
+				Updated string          `json:"updated"`
+			}
+			err = json.Unmarshal(value, &payload)
+			if err != nil {
+				return fmt.Errorf("decoding changefeed row: %w", err)
+			}
+			event := new(userspb.UserEvent)
+			var before, after *userspb.User
+			if !isJSONNull(payload.Before) {
+				before, err = jsonUserToProto(payload.Before)
+				if err != nil {
+					return fmt.Errorf("decoding changefeed user: %w", err)
+				}
+			}
+			if !isJSONNull(payload.After) {
+				after, err = jsonUserToProto(payload.After)
+				if err != nil {
+					return fmt.Errorf("decoding changefeed user: %w", err)
+				}
+			}
+			switch {
+			case after == nil:
+				if before.GetDeleteTime() != nil {
+					// Purged or force deleted after being soft deleted,
+					// which was already reported.
+					continue
+				}
+				event.Type = userspb.UserEventType_DELETED
+				event.User = before
+			case before == nil:
+				event.Type = userspb.UserEventType_CREATED
+				event.User = after
+			case before.GetDeleteTime() == nil && after.GetDeleteTime() != nil:
+				event.Type = userspb.UserEventType_DELETED
+				event.User = after
+			default:
+				event.Type = userspb.UserEventType_UPDATED
+				event.User = after
+			}
+			// The updated timestamp is an HLC timestamp, of the form
+			// <wall time nanoseconds>.<logical>.
+			wallTime, _, _ := strings.Cut(payload.Updated, ".")
+			nanos, err := strconv.ParseInt(wallTime, 10, 64)
+			if err != nil {
+				return fmt.Errorf("decoding changefeed timestamp: %w", err)
+			}
+			event.EventTime = timestamppb.New(time.Unix(0, nanos))
+			emit(event)
+		}
+		err = rows.Err()
+		if err != nil {
+			return fmt.Errorf("reading changefeed: %w", err)
+		}
+		return fmt.Errorf("changefeed ended unexpectedly")
+	}
+}
+
+func isJSONNull(msg json.RawMessage) bool {
+	return len(msg) == 0 || string(msg) == "null"
+}
+
+// jsonUser is a row of the users table encoded as JSON,
+// as done by row_to_json or changefeeds.
+type jsonUser struct {
+	ID         string          `json:"id"`
+	Role       Role            `json:"role"`
+	CreateTime string          `json:"create_time"`
+	Name       string          `json:"name"`
+	DeleteTime *string         `json:"delete_time"`
+	Version    int64           `json:"version"`
+	Labels     json.RawMessage `json:"labels"`
+	Attributes json.RawMessage `json:"attributes"`
+	Email      *string         `json:"email"`
+}
+
+func jsonUserToProto(msg json.RawMessage) (*userspb.User, error) {
+	var ju jsonUser
+	err := json.Unmarshal(msg, &ju)
+	if err != nil {
+		return nil, err
+	}
+	var pgUser User
+	err = pgUser.ID.Set(ju.ID)
+	if err != nil {
+		return nil, err
+	}
+	pgUser.CreateTime, err = parseJSONTime(ju.CreateTime)
+	if err != nil {
+		return nil, err
+	}
+	pgUser.Role = ju.Role
+	pgUser.Name = ju.Name
+	pgUser.Version = ju.Version
+	pgUser.Labels = ju.Labels
+	pgUser.Attributes = ju.Attributes
+	if ju.Email != nil {
+		pgUser.Email.String, pgUser.Email.Valid = *ju.Email, true
+	}
+	if ju.DeleteTime != nil {
+		pgUser.DeleteTime.Time, err = parseJSONTime(*ju.DeleteTime)
+		if err != nil {
+			return nil, err
+		}
+		pgUser.DeleteTime.Valid = true
+	}
+	return userPostgresToProto(pgUser)
+}
+
+// parseJSONTime parses a timestamp as encoded in JSON by the database.
+func parseJSONTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		// Some versions use a space instead of a T.
+		return time.Parse("2006-01-02 15:04:05.999999999Z07:00", s)
+	}
+	return t, nil
+}
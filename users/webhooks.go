@@ -0,0 +1,569 @@
+package users
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgtype"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+const (
+	defaultWebhookTimeout      = 10 * time.Second
+	defaultMaxDeliveryAttempts = 10
+	// deliveryRetention is how long finished deliveries are kept.
+	deliveryRetention = 30 * 24 * time.Hour
+
+	minWebhookSecretLength = 16
+	maxWebhookSecretLength = 256
+	maxWebhookURLLength    = 2048
+	// webhookConcurrency is the maximum number of deliveries
+	// attempted at once.
+	webhookConcurrency = 8
+)
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which
+// some cloud providers serve their metadata services from.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// WithMaxDeliveryAttempts sets how many times an event is posted to a
+// webhook before the delivery is given up as dead. Defaults to 10.
+func WithMaxDeliveryAttempts(attempts int32) Option {
+	return func(d *Directory) {
+		d.maxDeliveryAttempts = attempts
+	}
+}
+
+// WithPrivateWebhooks allows webhooks to post to loopback, link-local and
+// private addresses, which are rejected by default to stop webhooks from
+// reaching internal services. Only use it for tests and trusted deployments.
+func WithPrivateWebhooks() Option {
+	return func(d *Directory) {
+		d.privateWebhooks = true
+	}
+}
+
+// webhookEventTypes maps the webhook event types to the outbox event types.
+var webhookEventTypes = map[userspb.WebhookEventType]string{
+	userspb.WebhookEventType_USER_CREATED:   EventUserCreated,
+	userspb.WebhookEventType_USER_UPDATED:   EventUserUpdated,
+	userspb.WebhookEventType_USER_DELETED:   EventUserDeleted,
+	userspb.WebhookEventType_USER_UNDELETED: EventUserUndeleted,
+	userspb.WebhookEventType_USER_PURGED:    EventUserPurged,
+}
+
+// webhookEventType returns the webhook event type of the outbox event type.
+func webhookEventType(eventType string) userspb.WebhookEventType {
+	for webhookType, outboxType := range webhookEventTypes {
+		if outboxType == eventType {
+			return webhookType
+		}
+	}
+	return userspb.WebhookEventType_WEBHOOK_EVENT_TYPE_UNSPECIFIED
+}
+
+// WebhookSignature returns the signature of an event posted to a webhook
+// with the secret at the time, as sent in the Webhook-Signature header.
+// Receivers should compare it to the header in constant time, with
+// hmac.Equal, and reject old timestamps, to prevent replays.
+func WebhookSignature(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliveryState returns the name of the state in the database.
+func deliveryState(state userspb.DeliveryState) string {
+	return strings.ToLower(state.String())
+}
+
+// webhookColumns are the columns of the webhooks table, in the order
+// expected by scanWebhook.
+var webhookColumns = []string{
+	"id",
+	"url",
+	"event_types",
+	"secret",
+	"create_time",
+}
+
+// scanWebhook scans a row selected with webhookColumns.
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var pgWebhook Webhook
+	err := row.Scan(
+		&pgWebhook.ID,
+		&pgWebhook.Url,
+		&pgWebhook.EventTypes,
+		&pgWebhook.Secret,
+		&pgWebhook.CreateTime,
+	)
+	return pgWebhook, err
+}
+
+// webhookPostgresToProto converts the webhook, leaving out the secret.
+func webhookPostgresToProto(pgWebhook Webhook) (*userspb.Webhook, error) {
+	var webhookID string
+	err := pgWebhook.ID.AssignTo(&webhookID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	var eventTypes []string
+	err = json.Unmarshal(pgWebhook.EventTypes, &eventTypes)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to decode event types: %s", err.Error())
+	}
+	webhook := &userspb.Webhook{
+		Id:         webhookID,
+		Url:        pgWebhook.Url,
+		CreateTime: timestamppb.New(pgWebhook.CreateTime),
+	}
+	for _, eventType := range eventTypes {
+		webhook.EventTypes = append(webhook.EventTypes, webhookEventType(eventType))
+	}
+	return webhook, nil
+}
+
+// deliveryColumns are the columns of the webhook_deliveries table, other
+// than the payload, in the order expected by scanDelivery.
+var deliveryColumns = []string{
+	"id",
+	"webhook_id",
+	"event_id",
+	"event_type",
+	"state",
+	"attempts",
+	"next_attempt_time",
+	"last_status_code",
+	"last_error",
+	"create_time",
+	"update_time",
+}
+
+// scanDelivery scans a row selected with deliveryColumns.
+func scanDelivery(row rowScanner) (WebhookDelivery, error) {
+	var pgDelivery WebhookDelivery
+	err := row.Scan(
+		&pgDelivery.ID,
+		&pgDelivery.WebhookID,
+		&pgDelivery.EventID,
+		&pgDelivery.EventType,
+		&pgDelivery.State,
+		&pgDelivery.Attempts,
+		&pgDelivery.NextAttemptTime,
+		&pgDelivery.LastStatusCode,
+		&pgDelivery.LastError,
+		&pgDelivery.CreateTime,
+		&pgDelivery.UpdateTime,
+	)
+	return pgDelivery, err
+}
+
+func deliveryPostgresToProto(pgDelivery WebhookDelivery) (*userspb.WebhookDelivery, error) {
+	delivery := &userspb.WebhookDelivery{
+		EventId:        pgDelivery.EventID,
+		EventType:      webhookEventType(pgDelivery.EventType),
+		State:          userspb.DeliveryState(userspb.DeliveryState_value[strings.ToUpper(pgDelivery.State)]),
+		Attempts:       pgDelivery.Attempts,
+		LastStatusCode: pgDelivery.LastStatusCode,
+		LastError:      pgDelivery.LastError,
+		CreateTime:     timestamppb.New(pgDelivery.CreateTime),
+		UpdateTime:     timestamppb.New(pgDelivery.UpdateTime),
+	}
+	err := pgDelivery.ID.AssignTo(&delivery.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	err = pgDelivery.WebhookID.AssignTo(&delivery.WebhookId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to assign UUID to string: %s", err.Error())
+	}
+	if delivery.State == userspb.DeliveryState_PENDING {
+		delivery.NextAttemptTime = timestamppb.New(pgDelivery.NextAttemptTime)
+	}
+	return delivery, nil
+}
+
+// validateWebhookURL checks that the URL is an absolute http or https URL.
+// Unless private is set, URLs of loopback, link-local and private hosts
+// are rejected too. Hosts whose names resolve to such addresses are
+// rejected when dialed, by webhookDialControl.
+func validateWebhookURL(rawURL string, private bool) error {
+	if len(rawURL) > maxWebhookURLLength {
+		return status.Errorf(codes.InvalidArgument, "URL must be at most %d characters", maxWebhookURLLength)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return status.Errorf(codes.InvalidArgument, "invalid URL %q, must be an http or https URL", rawURL)
+	}
+	if private {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return status.Errorf(codes.InvalidArgument, "invalid URL %q, must not be a local address", rawURL)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !publicAddr(ip) {
+		return status.Errorf(codes.InvalidArgument, "invalid URL %q, must not be a local or private address", rawURL)
+	}
+	return nil
+}
+
+// publicAddr reports whether the address may be posted to by webhooks,
+// rejecting unspecified, loopback, link-local, multicast and private
+// addresses, which may reach internal services.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// webhookDialControl stops webhooks from connecting to addresses that
+// aren't public, whatever the name of the host resolved to.
+func webhookDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(ip) {
+		return fmt.Errorf("webhook address %s is not public", ip)
+	}
+	return nil
+}
+
+// newWebhookClient returns the client posting to webhooks. Unless private
+// is set, it only connects to public addresses, and ignores any proxy,
+// so that the addresses it connects to are those of the webhooks.
+func newWebhookClient(private bool) *http.Client {
+	if private {
+		return &http.Client{Timeout: defaultWebhookTimeout}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   webhookDialControl,
+	}).DialContext
+	return &http.Client{
+		Timeout:   defaultWebhookTimeout,
+		Transport: transport,
+	}
+}
+
+// encodeWebhookEventTypes validates the event types and encodes them as
+// a JSON array of outbox event types.
+func encodeWebhookEventTypes(types []userspb.WebhookEventType) (json.RawMessage, error) {
+	if len(types) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one event type must be set")
+	}
+	seen := map[userspb.WebhookEventType]bool{}
+	eventTypes := make([]string, 0, len(types))
+	for _, webhookType := range types {
+		eventType, ok := webhookEventTypes[webhookType]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid event type %s", webhookType)
+		}
+		if seen[webhookType] {
+			continue
+		}
+		seen[webhookType] = true
+		eventTypes = append(eventTypes, eventType)
+	}
+	b, err := json.Marshal(eventTypes)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error encoding event types: %s", err.Error())
+	}
+	return b, nil
+}
+
+// webhookSecret returns the requested secret, or generates one.
+func webhookSecret(secret string) (string, error) {
+	if secret == "" {
+		b := make([]byte, 32)
+		_, err := rand.Read(b)
+		if err != nil {
+			return "", status.Errorf(codes.Internal, "unexpected error generating secret: %s", err.Error())
+		}
+		return hex.EncodeToString(b), nil
+	}
+	if len(secret) < minWebhookSecretLength || len(secret) > maxWebhookSecretLength {
+		return "", status.Errorf(codes.InvalidArgument, "secret must be between %d and %d characters", minWebhookSecretLength, maxWebhookSecretLength)
+	}
+	return secret, nil
+}
+
+// parseWebhookID parses the ID of a webhook.
+func parseWebhookID(id string) (pgtype.UUID, error) {
+	var webhookID pgtype.UUID
+	err := webhookID.Set(id)
+	if err != nil {
+		return webhookID, status.Error(codes.InvalidArgument, "invalid UUID provided")
+	}
+	return webhookID, nil
+}
+
+// CreateWebhook creates a webhook, returning it with its secret.
+func (d Directory) CreateWebhook(ctx context.Context, req *userspb.CreateWebhookRequest) (*userspb.Webhook, error) {
+	err := validateWebhookURL(req.GetUrl(), d.privateWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	eventTypes, err := encodeWebhookEventTypes(req.GetEventTypes())
+	if err != nil {
+		return nil, err
+	}
+	secret, err := webhookSecret(req.GetSecret())
+	if err != nil {
+		return nil, err
+	}
+	pgWebhook, err := d.querier.CreateWebhook(ctx, CreateWebhookParams{
+		Url:        req.GetUrl(),
+		EventTypes: eventTypes,
+		Secret:     secret,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error creating webhook: %s", err.Error())
+	}
+	webhook, err := webhookPostgresToProto(pgWebhook)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = pgWebhook.Secret
+	return webhook, nil
+}
+
+// GetWebhook gets the webhook, if found.
+func (d Directory) GetWebhook(ctx context.Context, req *userspb.GetWebhookRequest) (*userspb.Webhook, error) {
+	webhookID, err := parseWebhookID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	pgWebhook, err := d.querier.GetWebhook(ctx, webhookID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "webhook not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error getting webhook: %s", err.Error())
+	}
+	return webhookPostgresToProto(pgWebhook)
+}
+
+// DeleteWebhook deletes the webhook, if found, along with its deliveries.
+func (d Directory) DeleteWebhook(ctx context.Context, req *userspb.DeleteWebhookRequest) (*userspb.Webhook, error) {
+	webhookID, err := parseWebhookID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	pgWebhook, err := d.querier.DeleteWebhook(ctx, webhookID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "webhook not found")
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error deleting webhook: %s", err.Error())
+	}
+	return webhookPostgresToProto(pgWebhook)
+}
+
+// ListWebhooks lists webhooks, in order of creation.
+func (d Directory) ListWebhooks(ctx context.Context, req *userspb.ListWebhooksRequest) (*userspb.ListWebhooksResponse, error) {
+	q := d.sb.Select(
+		webhookColumns...,
+	).From(
+		"webhooks",
+	)
+	pgWebhooks, next, err := queryPage(ctx, d, q, req, req.GetPageSize(), req.GetPageToken(), scanWebhook, func(pgWebhook Webhook) pageToken {
+		return pageToken{
+			CreateTime: pgWebhook.CreateTime,
+			ID:         pgWebhook.ID.Bytes[:],
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]*userspb.Webhook, 0, len(pgWebhooks))
+	for _, pgWebhook := range pgWebhooks {
+		webhook, err := webhookPostgresToProto(pgWebhook)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return &userspb.ListWebhooksResponse{
+		Webhooks:      webhooks,
+		NextPageToken: next,
+	}, nil
+}
+
+// ListDeliveries lists deliveries of events to webhooks, in order of creation.
+func (d Directory) ListDeliveries(ctx context.Context, req *userspb.ListDeliveriesRequest) (*userspb.ListDeliveriesResponse, error) {
+	q := d.sb.Select(
+		deliveryColumns...,
+	).From(
+		"webhook_deliveries",
+	)
+	if req.GetWebhookId() != "" {
+		webhookID, err := parseWebhookID(req.GetWebhookId())
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where(squirrel.Eq{
+			"webhook_id": webhookID,
+		})
+	}
+	if req.GetState() != userspb.DeliveryState_DELIVERY_STATE_UNSPECIFIED {
+		if _, ok := userspb.DeliveryState_name[int32(req.GetState())]; !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown state %d", req.GetState())
+		}
+		q = q.Where(squirrel.Eq{
+			"state": deliveryState(req.GetState()),
+		})
+	}
+	pgDeliveries, next, err := queryPage(ctx, d, q, req, req.GetPageSize(), req.GetPageToken(), scanDelivery, func(pgDelivery WebhookDelivery) pageToken {
+		return pageToken{
+			CreateTime: pgDelivery.CreateTime,
+			ID:         pgDelivery.ID.Bytes[:],
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]*userspb.WebhookDelivery, 0, len(pgDeliveries))
+	for _, pgDelivery := range pgDeliveries {
+		delivery, err := deliveryPostgresToProto(pgDelivery)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return &userspb.ListDeliveriesResponse{
+		Deliveries:    deliveries,
+		NextPageToken: next,
+	}, nil
+}
+
+// deliverLoop attempts the pending deliveries on every tick, until the
+// context is cancelled. It runs alongside the relay publishing the outbox
+// events, so that slow webhooks don't hold up publishing.
+func (d Directory) deliverLoop(ctx context.Context) {
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := d.deliverPending(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					d.logger.Error("Failed to deliver webhooks", "error", err)
+				}
+				break
+			}
+			if n < relayBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverPending attempts a batch of pending deliveries, returning the
+// number of deliveries attempted. Up to webhookConcurrency deliveries are
+// attempted at once, so that a slow webhook doesn't hold up the others.
+// Failed deliveries are retried after a backoff, until they have been
+// attempted maxDeliveryAttempts times.
+func (d Directory) deliverPending(ctx context.Context) (int, error) {
+	pgDeliveries, err := d.querier.ListPendingWebhookDeliveries(ctx, relayBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, webhookConcurrency)
+	for _, pgDelivery := range pgDeliveries {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(pgDelivery ListPendingWebhookDeliveriesRow) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := d.deliver(ctx, pgDelivery)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(pgDelivery)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	return len(pgDeliveries), nil
+}
+
+// deliver posts the event of the delivery to its webhook, and records
+// the attempt.
+func (d Directory) deliver(ctx context.Context, pgDelivery ListPendingWebhookDeliveriesRow) error {
+	now := time.Now()
+	header := http.Header{}
+	header.Set("Idempotency-Key", strconv.FormatInt(pgDelivery.EventID, 10))
+	header.Set("Webhook-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	header.Set("Webhook-Signature", WebhookSignature(pgDelivery.Secret, now, pgDelivery.Payload))
+	statusCode, err := postJSON(ctx, d.webhookClient, pgDelivery.Url, pgDelivery.Payload, header)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	params := UpdateWebhookDeliveryParams{
+		ID:              pgDelivery.ID,
+		State:           deliveryState(userspb.DeliveryState_SUCCEEDED),
+		NextAttemptTime: now,
+		LastStatusCode:  int32(statusCode),
+	}
+	if err != nil {
+		attempts := pgDelivery.Attempts + 1
+		params.LastError = err.Error()
+		if attempts >= d.maxDeliveryAttempts {
+			params.State = deliveryState(userspb.DeliveryState_DEAD)
+			d.logger.Warn("Giving up webhook delivery",
+				"event_id", pgDelivery.EventID, "url", pgDelivery.Url, "attempts", attempts, "error", err)
+		} else {
+			params.State = deliveryState(userspb.DeliveryState_PENDING)
+			params.NextAttemptTime = now.Add(retryBackoff(attempts))
+		}
+	}
+	return d.querier.UpdateWebhookDelivery(ctx, params)
+}
@@ -0,0 +1,136 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	userspb "github.com/johanbrandhorst/grpc-postgres/proto"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	t.Parallel()
+
+	timestamp := time.Unix(1700000000, 0)
+	body := []byte(`{"id":1}`)
+	got := WebhookSignature("0123456789abcdef", timestamp, body)
+	if !strings.HasPrefix(got, "sha256=") || len(got) != len("sha256=")+64 {
+		t.Fatalf("Unexpected signature format %q", got)
+	}
+	if WebhookSignature("0123456789abcdef", timestamp, body) != got {
+		t.Error("Expected the signature to be deterministic")
+	}
+	for name, other := range map[string]string{
+		"secret":    WebhookSignature("fedcba9876543210", timestamp, body),
+		"timestamp": WebhookSignature("0123456789abcdef", timestamp.Add(time.Second), body),
+		"body":      WebhookSignature("0123456789abcdef", timestamp, []byte(`{"id":2}`)),
+	} {
+		if other == got {
+			t.Errorf("Expected the signature to change with the %s", name)
+		}
+	}
+}
+
+func TestEncodeWebhookEventTypes(t *testing.T) {
+	t.Parallel()
+
+	got, err := encodeWebhookEventTypes([]userspb.WebhookEventType{
+		userspb.WebhookEventType_USER_CREATED,
+		userspb.WebhookEventType_USER_DELETED,
+		userspb.WebhookEventType_USER_CREATED,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode event types: %s", err)
+	}
+	var eventTypes []string
+	err = json.Unmarshal(got, &eventTypes)
+	if err != nil {
+		t.Fatalf("Failed to decode event types: %s", err)
+	}
+	if diff := cmp.Diff([]string{EventUserCreated, EventUserDeleted}, eventTypes); diff != "" {
+		t.Errorf("Event types were not as expected:\n%s", diff)
+	}
+
+	for _, types := range [][]userspb.WebhookEventType{
+		nil,
+		{userspb.WebhookEventType_WEBHOOK_EVENT_TYPE_UNSPECIFIED},
+		{userspb.WebhookEventType(100)},
+	} {
+		_, err := encodeWebhookEventTypes(types)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for event types %v, got %v", types, err)
+		}
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	t.Parallel()
+
+	for _, valid := range []string{"https://example.com/hooks?id=1", "http://93.184.216.34:8080/hook", "https://[2606:4700::1111]/hook"} {
+		if err := validateWebhookURL(valid, false); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", valid, err)
+		}
+	}
+	private := []string{
+		"http://localhost:8080/hook",
+		"http://api.localhost/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1/hook",
+		"http://172.16.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://100.100.100.200/hook",
+		"http://0.0.0.0/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://[fd00::1]/hook",
+	}
+	for _, invalid := range append([]string{"", "example.com/hook", "ftp://example.com", "https://", "://"}, private...) {
+		if err := validateWebhookURL(invalid, false); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %q, got %v", invalid, err)
+		}
+	}
+	for _, valid := range private {
+		if err := validateWebhookURL(valid, true); err != nil {
+			t.Errorf("Expected %q to be valid when private webhooks are allowed, got %v", valid, err)
+		}
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	t.Parallel()
+
+	for _, address := range []string{"93.184.216.34:443", "[2606:4700::1111]:443"} {
+		if err := webhookDialControl("tcp", address, nil); err != nil {
+			t.Errorf("Expected dialing %s to be allowed, got %v", address, err)
+		}
+	}
+	for _, address := range []string{"127.0.0.1:80", "[::1]:80", "169.254.169.254:80", "10.1.2.3:443", "[::ffff:192.168.0.1]:80"} {
+		if err := webhookDialControl("tcp", address, nil); err == nil {
+			t.Errorf("Expected dialing %s to be rejected", address)
+		}
+	}
+
+	// Names resolving to private addresses are rejected when dialed.
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the webhook not to be posted to")
+	}))
+	t.Cleanup(receiver.Close)
+	u, err := url.Parse(receiver.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	_, err = postJSON(context.Background(), newWebhookClient(false), "http://localhost:"+u.Port(), []byte("{}"), http.Header{})
+	if err == nil {
+		t.Error("Expected posting to localhost to fail")
+	}
+}